@@ -0,0 +1,188 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"firebase.google.com/go/internal"
+)
+
+// Modes of the email action links generated by Firebase Auth. The mode is specified in the mode query
+// parameter of each link, and is available as the Mode field of ActionLink.
+const (
+	ActionModeVerifyEmail          = "verifyEmail"
+	ActionModeResetPassword        = "resetPassword"
+	ActionModeSignIn               = "signIn"
+	ActionModeRecoverEmail         = "recoverEmail"
+	ActionModeVerifyAndChangeEmail = "verifyAndChangeEmail"
+)
+
+// ActionLink represents the parameters of an email action link.
+//
+// Email action links are generated by functions like PasswordResetLink(), and are typically received
+// by a custom email action handler. See
+// https://firebase.google.com/docs/auth/custom-email-handler for more details.
+type ActionLink struct {
+	Mode        string
+	OOBCode     string
+	ContinueURL string
+	Lang        string
+	APIKey      string
+}
+
+// ParseActionLink parses the given email action link.
+//
+// Both the direct links generated by Firebase Auth, and Dynamic Links that wrap them (i.e. links
+// generated with ActionCodeSettings.DynamicLinkDomain) are supported. ParseActionLink returns an
+// error if the link does not contain a mode and an out-of-band code.
+func ParseActionLink(link string) (*ActionLink, error) {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return nil, fmt.Errorf("malformed action link: %q", link)
+	}
+	query := parsed.Query()
+	if query.Get("oobCode") == "" {
+		if inner := query.Get("link"); inner != "" {
+			if innerURL, err := url.Parse(inner); err == nil {
+				query = innerURL.Query()
+			}
+		}
+	}
+
+	result := &ActionLink{
+		Mode:        query.Get("mode"),
+		OOBCode:     query.Get("oobCode"),
+		ContinueURL: query.Get("continueUrl"),
+		Lang:        query.Get("lang"),
+		APIKey:      query.Get("apiKey"),
+	}
+	if result.Mode == "" {
+		return nil, fmt.Errorf("action link does not specify a mode: %q", link)
+	}
+	if result.OOBCode == "" {
+		return nil, fmt.Errorf("action link does not specify an oobCode: %q", link)
+	}
+	return result, nil
+}
+
+// ActionCodeInfo contains the details of an email action code.
+//
+// Operation is the type of the action code, such as "PASSWORD_RESET" or "VERIFY_EMAIL". Email is the
+// email address the code was issued for, and NewEmail is the new email address of the user for the
+// "VERIFY_AND_CHANGE_EMAIL" and "RECOVER_EMAIL" operations.
+type ActionCodeInfo struct {
+	Operation string `json:"requestType"`
+	Email     string `json:"email"`
+	NewEmail  string `json:"newEmail"`
+}
+
+// CheckActionCode checks the validity of the given email action code, and returns its details.
+//
+// The action code is not consumed by this call.
+func (c *userManagementClient) CheckActionCode(ctx context.Context, oobCode string) (*ActionCodeInfo, error) {
+	if oobCode == "" {
+		return nil, errors.New("oobCode must not be empty")
+	}
+
+	payload := map[string]interface{}{
+		"oobCode": oobCode,
+	}
+	resp, err := c.postWithoutProject(ctx, "/accounts:resetPassword", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Status != http.StatusOK {
+		return nil, handleHTTPError(resp)
+	}
+
+	var result ActionCodeInfo
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ApplyActionCode applies the given email action code.
+//
+// This completes email verification, email change and email recovery flows. The action code is consumed
+// by this call.
+func (c *userManagementClient) ApplyActionCode(ctx context.Context, oobCode string) error {
+	if oobCode == "" {
+		return errors.New("oobCode must not be empty")
+	}
+
+	payload := map[string]interface{}{
+		"oobCode": oobCode,
+	}
+	resp, err := c.postWithoutProject(ctx, "/accounts:update", payload)
+	if err != nil {
+		return err
+	}
+
+	if resp.Status != http.StatusOK {
+		return handleHTTPError(resp)
+	}
+	return nil
+}
+
+// ConfirmPasswordReset completes a password reset flow by setting a new password for the user that the
+// given email action code was issued for. The action code is consumed by this call.
+func (c *userManagementClient) ConfirmPasswordReset(ctx context.Context, oobCode, newPassword string) error {
+	if oobCode == "" {
+		return errors.New("oobCode must not be empty")
+	}
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"oobCode":     oobCode,
+		"newPassword": newPassword,
+	}
+	resp, err := c.postWithoutProject(ctx, "/accounts:resetPassword", payload)
+	if err != nil {
+		return err
+	}
+
+	if resp.Status != http.StatusOK {
+		return handleHTTPError(resp)
+	}
+	return nil
+}
+
+// postWithoutProject makes a POST request to an endpoint that is not scoped to a project. The project
+// is inferred from the credentials of the client.
+func (c *userManagementClient) postWithoutProject(
+	ctx context.Context,
+	path string,
+	payload interface{},
+) (*internal.Response, error) {
+
+	req := &internal.Request{
+		Method: http.MethodPost,
+		URL:    strings.TrimSuffix(c.baseURL, "/projects") + path,
+		Body:   internal.NewJSONEntity(payload),
+		Opts:   []internal.HTTPOption{internal.WithHeader("X-Client-Version", c.version)},
+	}
+	return c.httpClient.Do(ctx, req)
+}
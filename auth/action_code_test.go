@@ -0,0 +1,204 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+const testOOBCode = "test-oob-code"
+
+var testActionHandlerLink = "https://mock-project.firebaseapp.com/__/auth/action?" + url.Values{
+	"mode":        []string{"resetPassword"},
+	"oobCode":     []string{testOOBCode},
+	"apiKey":      []string{"test-api-key"},
+	"continueUrl": []string{"https://example.com/?a=1&b=2#c=3"},
+	"lang":        []string{"fr"},
+}.Encode()
+
+func TestParseActionLink(t *testing.T) {
+	want := &ActionLink{
+		Mode:        ActionModeResetPassword,
+		OOBCode:     testOOBCode,
+		ContinueURL: "https://example.com/?a=1&b=2#c=3",
+		Lang:        "fr",
+		APIKey:      "test-api-key",
+	}
+
+	dynamicLink := "https://custom.page.link/?" + url.Values{
+		"link": []string{testActionHandlerLink},
+		"apn":  []string{"com.example.android"},
+	}.Encode()
+
+	for _, link := range []string{testActionHandlerLink, dynamicLink} {
+		got, err := ParseActionLink(link)
+		if err != nil {
+			t.Fatalf("ParseActionLink(%q) = %v", link, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseActionLink(%q) = %#v; want = %#v", link, got, want)
+		}
+	}
+}
+
+func TestParseActionLinkMinimal(t *testing.T) {
+	got, err := ParseActionLink("https://example.com/action?mode=verifyEmail&oobCode=code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ActionLink{
+		Mode:    ActionModeVerifyEmail,
+		OOBCode: "code",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseActionLink() = %#v; want = %#v", got, want)
+	}
+}
+
+func TestParseActionLinkError(t *testing.T) {
+	cases := []string{
+		"",
+		"%%not a url",
+		"https://example.com/action",
+		"https://example.com/action?mode=verifyEmail",
+		"https://example.com/action?oobCode=code",
+		"https://custom.page.link/?link=https%3A%2F%2Fexample.com%2Faction",
+	}
+	for _, link := range cases {
+		if got, err := ParseActionLink(link); got != nil || err == nil {
+			t.Errorf("ParseActionLink(%q) = (%v, %v); want = (nil, error)", link, got, err)
+		}
+	}
+}
+
+func TestCheckActionCode(t *testing.T) {
+	resp := `{
+		"email": "user@domain.com",
+		"newEmail": "new-user@domain.com",
+		"requestType": "VERIFY_AND_CHANGE_EMAIL"
+	}`
+	s := echoServer([]byte(resp), t)
+	defer s.Close()
+
+	info, err := s.Client.CheckActionCode(context.Background(), testOOBCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ActionCodeInfo{
+		Operation: "VERIFY_AND_CHANGE_EMAIL",
+		Email:     testEmail,
+		NewEmail:  testNewEmail,
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("CheckActionCode() = %#v; want = %#v", info, want)
+	}
+
+	wantReq := map[string]interface{}{
+		"oobCode": testOOBCode,
+	}
+	if err := checkActionCodeRequest(s, "/accounts:resetPassword", wantReq); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyActionCode(t *testing.T) {
+	s := echoServer([]byte(`{"email": "user@domain.com", "emailVerified": true}`), t)
+	defer s.Close()
+
+	if err := s.Client.ApplyActionCode(context.Background(), testOOBCode); err != nil {
+		t.Fatal(err)
+	}
+
+	wantReq := map[string]interface{}{
+		"oobCode": testOOBCode,
+	}
+	if err := checkActionCodeRequest(s, "/accounts:update", wantReq); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConfirmPasswordReset(t *testing.T) {
+	s := echoServer([]byte(`{"email": "user@domain.com", "requestType": "PASSWORD_RESET"}`), t)
+	defer s.Close()
+
+	if err := s.Client.ConfirmPasswordReset(context.Background(), testOOBCode, "newPassword"); err != nil {
+		t.Fatal(err)
+	}
+
+	wantReq := map[string]interface{}{
+		"oobCode":     testOOBCode,
+		"newPassword": "newPassword",
+	}
+	if err := checkActionCodeRequest(s, "/accounts:resetPassword", wantReq); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestActionCodeInvalidArgs(t *testing.T) {
+	client := &Client{}
+	if _, err := client.CheckActionCode(context.Background(), ""); err == nil {
+		t.Errorf("CheckActionCode('') = nil; want error")
+	}
+	if err := client.ApplyActionCode(context.Background(), ""); err == nil {
+		t.Errorf("ApplyActionCode('') = nil; want error")
+	}
+	if err := client.ConfirmPasswordReset(context.Background(), "", "newPassword"); err == nil {
+		t.Errorf("ConfirmPasswordReset('') = nil; want error")
+	}
+	if err := client.ConfirmPasswordReset(context.Background(), testOOBCode, "weak"); err == nil {
+		t.Errorf("ConfirmPasswordReset(weak password) = nil; want error")
+	}
+}
+
+func TestActionCodeError(t *testing.T) {
+	cases := map[string]func(error) bool{
+		"EXPIRED_OOB_CODE": IsExpiredActionCode,
+		"INVALID_OOB_CODE": IsInvalidActionCode,
+	}
+	s := echoServer(nil, t)
+	defer s.Close()
+	s.Client.httpClient.RetryConfig = nil
+	s.Status = http.StatusBadRequest
+
+	for code, check := range cases {
+		s.Resp = []byte(fmt.Sprintf(`{"error": {"message": %q}}`, code))
+		if _, err := s.Client.CheckActionCode(context.Background(), testOOBCode); err == nil || !check(err) {
+			t.Errorf("CheckActionCode(%q) = %v; want = %q", code, err, serverError[code])
+		}
+		if err := s.Client.ApplyActionCode(context.Background(), testOOBCode); err == nil || !check(err) {
+			t.Errorf("ApplyActionCode(%q) = %v; want = %q", code, err, serverError[code])
+		}
+		err := s.Client.ConfirmPasswordReset(context.Background(), testOOBCode, "newPassword")
+		if err == nil || !check(err) {
+			t.Errorf("ConfirmPasswordReset(%q) = %v; want = %q", code, err, serverError[code])
+		}
+	}
+}
+
+func checkActionCodeRequest(s *mockAuthServer, wantPath string, want map[string]interface{}) error {
+	req := s.Req[len(s.Req)-1]
+	if req.Method != http.MethodPost {
+		return fmt.Errorf("Method = %q; want = %q", req.Method, http.MethodPost)
+	}
+	if req.URL.Path != wantPath {
+		return fmt.Errorf("Path = %q; want = %q", req.URL.Path, wantPath)
+	}
+	return checkActionLinkRequest(want, s)
+}
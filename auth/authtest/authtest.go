@@ -0,0 +1,52 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package authtest provides test helpers for code that uses the auth package.
+package authtest
+
+import (
+	"context"
+	"sync"
+
+	"firebase.google.com/go/auth"
+)
+
+// FakeMailer is an auth.Mailer that records all messages instead of delivering them.
+type FakeMailer struct {
+	// Err, when set, is returned from all SendEmail() calls. Messages are not recorded in that case.
+	Err error
+
+	mu       sync.Mutex
+	messages []*auth.EmailMessage
+}
+
+// SendEmail records the given message.
+func (f *FakeMailer) SendEmail(ctx context.Context, msg *auth.EmailMessage) error {
+	if f.Err != nil {
+		return f.Err
+	}
+
+	cp := *msg
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, &cp)
+	return nil
+}
+
+// Messages returns all the messages recorded so far, in the order they were sent.
+func (f *FakeMailer) Messages() []*auth.EmailMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*auth.EmailMessage(nil), f.messages...)
+}
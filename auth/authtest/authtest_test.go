@@ -0,0 +1,46 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"firebase.google.com/go/auth"
+)
+
+func TestFakeMailer(t *testing.T) {
+	var m auth.Mailer = &FakeMailer{}
+	fake := m.(*FakeMailer)
+	msg := &auth.EmailMessage{To: "user@domain.com", Action: auth.PasswordResetAction, Link: "https://test.link"}
+	if err := m.SendEmail(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	msg.To = "modified@domain.com"
+
+	got := fake.Messages()
+	if len(got) != 1 || got[0].To != "user@domain.com" || got[0].Link != "https://test.link" {
+		t.Errorf("Messages() = %v; want = [%v]", got, msg)
+	}
+
+	fake.Err = errors.New("delivery failed")
+	if err := m.SendEmail(context.Background(), msg); err != fake.Err {
+		t.Errorf("SendEmail() = %v; want = %v", err, fake.Err)
+	}
+	if len(fake.Messages()) != 1 {
+		t.Errorf("Messages() = %d; want = 1", len(fake.Messages()))
+	}
+}
@@ -65,11 +65,22 @@ func (settings *ActionCodeSettings) toMap() (map[string]interface{}, error) {
 type linkType string
 
 const (
-	emailLinkSignIn   linkType = "EMAIL_SIGNIN"
-	emailVerification linkType = "VERIFY_EMAIL"
-	passwordReset     linkType = "PASSWORD_RESET"
+	emailLinkSignIn      linkType = "EMAIL_SIGNIN"
+	emailVerification    linkType = "VERIFY_EMAIL"
+	passwordReset        linkType = "PASSWORD_RESET"
+	verifyAndChangeEmail linkType = "VERIFY_AND_CHANGE_EMAIL"
+	recoverEmail         linkType = "RECOVER_EMAIL"
 )
 
+// emailActionRequest describes a single call to the sendOobCode API.
+type emailActionRequest struct {
+	linkType   linkType
+	email      string
+	newEmail   string
+	settings   *ActionCodeSettings
+	returnLink bool
+}
+
 // EmailVerificationLink generates the out-of-band email action link for email verification flows for the specified
 // email address.
 func (c *userManagementClient) EmailVerificationLink(ctx context.Context, email string) (string, error) {
@@ -103,24 +114,115 @@ func (c *userManagementClient) EmailSignInLink(
 	return c.generateEmailActionLink(ctx, emailLinkSignIn, email, settings)
 }
 
+// VerifyAndChangeEmailLink generates the out-of-band email action link for flows that change the email address
+// of a user. The link is sent to the new email address, and the change takes effect once the link is used.
+func (c *userManagementClient) VerifyAndChangeEmailLink(
+	ctx context.Context, email, newEmail string) (string, error) {
+	return c.VerifyAndChangeEmailLinkWithSettings(ctx, email, newEmail, nil)
+}
+
+// VerifyAndChangeEmailLinkWithSettings generates the out-of-band email action link for flows that change the
+// email address of a user, using the action code settings provided.
+func (c *userManagementClient) VerifyAndChangeEmailLinkWithSettings(
+	ctx context.Context, email, newEmail string, settings *ActionCodeSettings) (string, error) {
+	return c.sendOOBCode(ctx, &emailActionRequest{
+		linkType:   verifyAndChangeEmail,
+		email:      email,
+		newEmail:   newEmail,
+		settings:   settings,
+		returnLink: true,
+	})
+}
+
+// RecoverEmailLink generates the out-of-band email action link for email recovery flows for the specified email
+// address. Email recovery links allow a user to revert a recent change of their email address.
+func (c *userManagementClient) RecoverEmailLink(ctx context.Context, email string) (string, error) {
+	return c.RecoverEmailLinkWithSettings(ctx, email, nil)
+}
+
+// RecoverEmailLinkWithSettings generates the out-of-band email action link for email recovery flows for the
+// specified email address, using the action code settings provided.
+func (c *userManagementClient) RecoverEmailLinkWithSettings(
+	ctx context.Context, email string, settings *ActionCodeSettings) (string, error) {
+	return c.generateEmailActionLink(ctx, recoverEmail, email, settings)
+}
+
+// SendEmailVerification sends an email verification email to the specified email address, using the email
+// templates configured for the Firebase project. Settings are optional and may be nil.
+func (c *userManagementClient) SendEmailVerification(
+	ctx context.Context, email string, settings *ActionCodeSettings) error {
+	return c.sendEmailAction(ctx, emailVerification, email, settings)
+}
+
+// SendPasswordReset sends a password reset email to the specified email address, using the email templates
+// configured for the Firebase project. Settings are optional and may be nil.
+func (c *userManagementClient) SendPasswordReset(
+	ctx context.Context, email string, settings *ActionCodeSettings) error {
+	return c.sendEmailAction(ctx, passwordReset, email, settings)
+}
+
+// SendEmailSignIn sends an email link sign-in email to the specified email address, using the email templates
+// configured for the Firebase project. Settings are required.
+func (c *userManagementClient) SendEmailSignIn(
+	ctx context.Context, email string, settings *ActionCodeSettings) error {
+	return c.sendEmailAction(ctx, emailLinkSignIn, email, settings)
+}
+
+// SendVerifyAndChangeEmail sends an email address change verification email to the new email address, using
+// the email templates configured for the Firebase project. Settings are optional and may be nil.
+func (c *userManagementClient) SendVerifyAndChangeEmail(
+	ctx context.Context, email, newEmail string, settings *ActionCodeSettings) error {
+	_, err := c.sendOOBCode(ctx, &emailActionRequest{
+		linkType: verifyAndChangeEmail,
+		email:    email,
+		newEmail: newEmail,
+		settings: settings,
+	})
+	return err
+}
+
 func (c *userManagementClient) generateEmailActionLink(
 	ctx context.Context, linkType linkType, email string, settings *ActionCodeSettings) (string, error) {
+	return c.sendOOBCode(ctx, &emailActionRequest{
+		linkType:   linkType,
+		email:      email,
+		settings:   settings,
+		returnLink: true,
+	})
+}
+
+func (c *userManagementClient) sendEmailAction(
+	ctx context.Context, linkType linkType, email string, settings *ActionCodeSettings) error {
+	_, err := c.sendOOBCode(ctx, &emailActionRequest{
+		linkType: linkType,
+		email:    email,
+		settings: settings,
+	})
+	return err
+}
 
-	if email == "" {
+func (c *userManagementClient) sendOOBCode(ctx context.Context, req *emailActionRequest) (string, error) {
+	if req.email == "" {
 		return "", errors.New("email must not be empty")
 	}
 
-	if linkType == emailLinkSignIn && settings == nil {
+	if req.linkType == emailLinkSignIn && req.settings == nil {
 		return "", errors.New("ActionCodeSettings must not be nil when generating sign-in links")
 	}
 
 	payload := map[string]interface{}{
-		"requestType":   linkType,
-		"email":         email,
-		"returnOobLink": true,
+		"requestType":   req.linkType,
+		"email":         req.email,
+		"returnOobLink": req.returnLink,
+	}
+	if req.linkType == verifyAndChangeEmail {
+		if err := validateEmail(req.newEmail); err != nil {
+			return "", err
+		}
+		payload["newEmail"] = req.newEmail
 	}
-	if settings != nil {
-		settingsMap, err := settings.toMap()
+	if req.settings != nil {
+		settingsMap, err := req.settings.toMap()
 		if err != nil {
 			return "", err
 		}
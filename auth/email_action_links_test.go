@@ -27,6 +27,7 @@ const (
 	testActionLink       = "https://test.link"
 	testActionLinkFormat = `{"oobLink": %q}`
 	testEmail            = "user@domain.com"
+	testNewEmail         = "new-user@domain.com"
 )
 
 var testActionLinkResponse = []byte(fmt.Sprintf(testActionLinkFormat, testActionLink))
@@ -202,6 +203,199 @@ func TestEmailSignInLink(t *testing.T) {
 	}
 }
 
+func TestVerifyAndChangeEmailLink(t *testing.T) {
+	s := echoServer(testActionLinkResponse, t)
+	defer s.Close()
+
+	link, err := s.Client.VerifyAndChangeEmailLink(context.Background(), testEmail, testNewEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != testActionLink {
+		t.Errorf("VerifyAndChangeEmailLink() = %q; want = %q", link, testActionLink)
+	}
+
+	want := map[string]interface{}{
+		"requestType":   "VERIFY_AND_CHANGE_EMAIL",
+		"email":         testEmail,
+		"newEmail":      testNewEmail,
+		"returnOobLink": true,
+	}
+	if err := checkActionLinkRequest(want, s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyAndChangeEmailLinkWithSettings(t *testing.T) {
+	s := echoServer(testActionLinkResponse, t)
+	defer s.Close()
+
+	link, err := s.Client.VerifyAndChangeEmailLinkWithSettings(
+		context.Background(), testEmail, testNewEmail, testActionCodeSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != testActionLink {
+		t.Errorf("VerifyAndChangeEmailLinkWithSettings() = %q; want = %q", link, testActionLink)
+	}
+
+	want := map[string]interface{}{
+		"requestType":   "VERIFY_AND_CHANGE_EMAIL",
+		"email":         testEmail,
+		"newEmail":      testNewEmail,
+		"returnOobLink": true,
+	}
+	for k, v := range testActionCodeSettingsMap {
+		want[k] = v
+	}
+	if err := checkActionLinkRequest(want, s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyAndChangeEmailLinkInvalidNewEmail(t *testing.T) {
+	client := &Client{}
+	for _, newEmail := range []string{"", "not-an-email"} {
+		_, err := client.VerifyAndChangeEmailLink(context.Background(), testEmail, newEmail)
+		if err == nil {
+			t.Errorf("VerifyAndChangeEmailLink(%q) = nil; want error", newEmail)
+		}
+	}
+}
+
+func TestRecoverEmailLink(t *testing.T) {
+	s := echoServer(testActionLinkResponse, t)
+	defer s.Close()
+
+	link, err := s.Client.RecoverEmailLink(context.Background(), testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != testActionLink {
+		t.Errorf("RecoverEmailLink() = %q; want = %q", link, testActionLink)
+	}
+
+	want := map[string]interface{}{
+		"requestType":   "RECOVER_EMAIL",
+		"email":         testEmail,
+		"returnOobLink": true,
+	}
+	if err := checkActionLinkRequest(want, s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecoverEmailLinkWithSettings(t *testing.T) {
+	s := echoServer(testActionLinkResponse, t)
+	defer s.Close()
+
+	link, err := s.Client.RecoverEmailLinkWithSettings(context.Background(), testEmail, testActionCodeSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != testActionLink {
+		t.Errorf("RecoverEmailLinkWithSettings() = %q; want = %q", link, testActionLink)
+	}
+
+	want := map[string]interface{}{
+		"requestType":   "RECOVER_EMAIL",
+		"email":         testEmail,
+		"returnOobLink": true,
+	}
+	for k, v := range testActionCodeSettingsMap {
+		want[k] = v
+	}
+	if err := checkActionLinkRequest(want, s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendEmailAction(t *testing.T) {
+	s := echoServer([]byte(`{"email": "user@domain.com"}`), t)
+	defer s.Close()
+
+	cases := []struct {
+		name        string
+		send        func() error
+		requestType string
+	}{
+		{
+			name: "SendEmailVerification",
+			send: func() error {
+				return s.Client.SendEmailVerification(context.Background(), testEmail, testActionCodeSettings)
+			},
+			requestType: "VERIFY_EMAIL",
+		},
+		{
+			name: "SendPasswordReset",
+			send: func() error {
+				return s.Client.SendPasswordReset(context.Background(), testEmail, testActionCodeSettings)
+			},
+			requestType: "PASSWORD_RESET",
+		},
+		{
+			name: "SendEmailSignIn",
+			send: func() error {
+				return s.Client.SendEmailSignIn(context.Background(), testEmail, testActionCodeSettings)
+			},
+			requestType: "EMAIL_SIGNIN",
+		},
+	}
+	for _, tc := range cases {
+		if err := tc.send(); err != nil {
+			t.Fatalf("%s() = %v", tc.name, err)
+		}
+		want := map[string]interface{}{
+			"requestType":   tc.requestType,
+			"email":         testEmail,
+			"returnOobLink": false,
+		}
+		for k, v := range testActionCodeSettingsMap {
+			want[k] = v
+		}
+		if err := checkActionLinkRequest(want, s); err != nil {
+			t.Errorf("%s() request: %v", tc.name, err)
+		}
+	}
+}
+
+func TestSendVerifyAndChangeEmail(t *testing.T) {
+	s := echoServer([]byte(`{"email": "user@domain.com"}`), t)
+	defer s.Close()
+
+	if err := s.Client.SendVerifyAndChangeEmail(context.Background(), testEmail, testNewEmail, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"requestType":   "VERIFY_AND_CHANGE_EMAIL",
+		"email":         testEmail,
+		"newEmail":      testNewEmail,
+		"returnOobLink": false,
+	}
+	if err := checkActionLinkRequest(want, s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendEmailActionInvalidArgs(t *testing.T) {
+	client := &Client{}
+	if err := client.SendEmailVerification(context.Background(), "", nil); err == nil {
+		t.Errorf("SendEmailVerification('') = nil; want error")
+	}
+	if err := client.SendEmailSignIn(context.Background(), testEmail, nil); err == nil {
+		t.Errorf("SendEmailSignIn(nil) = nil; want error")
+	}
+	for _, tc := range invalidActionCodeSettings {
+		err := client.SendPasswordReset(context.Background(), testEmail, tc.settings)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("SendPasswordReset(%q) = %v; want = %q", tc.name, err, tc.want)
+		}
+	}
+	if err := client.SendVerifyAndChangeEmail(context.Background(), testEmail, "", nil); err == nil {
+		t.Errorf("SendVerifyAndChangeEmail('') = nil; want error")
+	}
+}
+
 func TestEmailActionLinkNoEmail(t *testing.T) {
 	client := &Client{}
 	_, err := client.EmailVerificationLink(context.Background(), "")
@@ -218,6 +412,16 @@ func TestEmailActionLinkNoEmail(t *testing.T) {
 	if err == nil {
 		t.Errorf("EmailSignInLink('') = nil; want error")
 	}
+
+	_, err = client.VerifyAndChangeEmailLink(context.Background(), "", testNewEmail)
+	if err == nil {
+		t.Errorf("VerifyAndChangeEmailLink('') = nil; want error")
+	}
+
+	_, err = client.RecoverEmailLink(context.Background(), "")
+	if err == nil {
+		t.Errorf("RecoverEmailLink('') = nil; want error")
+	}
 }
 
 func TestEmailVerificationLinkInvalidSettings(t *testing.T) {
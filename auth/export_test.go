@@ -0,0 +1,31 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+// Test helpers exported for the tests in the auth_test package, which cannot be placed in this
+// package because they use the authtest package.
+
+type MockAuthServer = mockAuthServer
+
+var (
+	EchoServer             = echoServer
+	CheckActionLinkRequest = checkActionLinkRequest
+
+	TestActionLink            = testActionLink
+	TestActionLinkResponse    = testActionLinkResponse
+	TestActionCodeSettings    = testActionCodeSettings
+	TestActionCodeSettingsMap = testActionCodeSettingsMap
+	TestEmail                 = testEmail
+)
@@ -15,15 +15,148 @@
 // Package hash contains a collection of password hash algorithms that can be used with the
 // auth.ImportUsers() API. Refer to https://firebase.google.com/docs/auth/admin/import-users for
 // more details about supported hash algorithms.
+//
+// Each hash algorithm also implements the Verifier interface, which can be used to check passwords
+// against existing hashes locally, before importing them into Firebase Auth.
 package hash // import "firebase.google.com/go/auth/hash"
 
 import (
 	"encoding/base64"
 	"errors"
+	"fmt"
 
 	"firebase.google.com/go/internal"
 )
 
+// InputOrder specifies the order in which the salt and the password are concatenated before
+// being hashed. It applies to the HMAC, MD5 and SHA hash algorithms.
+type InputOrder int
+
+const (
+	// InputOrderUnspecified uses the default order of Firebase Auth, which places the salt first.
+	InputOrderUnspecified InputOrder = iota
+
+	// InputOrderSaltFirst places the salt before the password.
+	InputOrderSaltFirst
+
+	// InputOrderPasswordFirst places the password before the salt.
+	InputOrderPasswordFirst
+)
+
+func (o InputOrder) config() (string, error) {
+	switch o {
+	case InputOrderUnspecified:
+		return "", nil
+	case InputOrderSaltFirst:
+		return "SALT_AND_PASSWORD", nil
+	case InputOrderPasswordFirst:
+		return "PASSWORD_AND_SALT", nil
+	default:
+		return "", fmt.Errorf("unknown input order: %d", o)
+	}
+}
+
+// Argon2Type specifies the variant of the Argon2 hash algorithm.
+type Argon2Type int
+
+const (
+	// Argon2TypeUnspecified is the zero value of Argon2Type. It is rejected by Argon2.Config(), so
+	// that the variant is always specified explicitly.
+	Argon2TypeUnspecified Argon2Type = iota
+
+	// Argon2ID represents the Argon2id variant.
+	Argon2ID
+
+	// Argon2I represents the Argon2i variant.
+	Argon2I
+
+	// Argon2D represents the Argon2d variant.
+	Argon2D
+)
+
+// Argon2Version specifies the version of the Argon2 hash algorithm.
+type Argon2Version int
+
+const (
+	// Argon2VersionUnspecified uses the default version of Firebase Auth, which is version 0x13.
+	Argon2VersionUnspecified Argon2Version = iota
+
+	// Argon2Version10 represents version 0x10 of the Argon2 hash algorithm.
+	Argon2Version10
+
+	// Argon2Version13 represents version 0x13 of the Argon2 hash algorithm.
+	Argon2Version13
+)
+
+// Argon2 represents the Argon2 hash algorithm.
+//
+// Type is required. HashLength must be between 1 and 256, Iterations must be between 1 and 16,
+// MemoryCostKib must be between 1 and 32768, and Parallelism must be between 1 and 16.
+// AssociatedData is optional.
+// Refer to https://cloud.google.com/identity-platform/docs/migrating-users for more details.
+type Argon2 struct {
+	Type           Argon2Type
+	Version        Argon2Version
+	HashLength     int
+	Iterations     int
+	MemoryCostKib  int
+	Parallelism    int
+	AssociatedData []byte
+}
+
+// Config returns the validated hash configuration.
+func (a Argon2) Config() (internal.HashConfig, error) {
+	var hashType string
+	switch a.Type {
+	case Argon2ID:
+		hashType = "ARGON2_ID"
+	case Argon2I:
+		hashType = "ARGON2_I"
+	case Argon2D:
+		hashType = "ARGON2_D"
+	case Argon2TypeUnspecified:
+		return nil, errors.New("argon2 type must be specified")
+	default:
+		return nil, fmt.Errorf("unknown argon2 type: %d", a.Type)
+	}
+	if a.HashLength < 1 || a.HashLength > 256 {
+		return nil, errors.New("hash length must be between 1 and 256")
+	}
+	if a.Iterations < 1 || a.Iterations > 16 {
+		return nil, errors.New("iterations must be between 1 and 16")
+	}
+	if a.MemoryCostKib < 1 || a.MemoryCostKib > 32768 {
+		return nil, errors.New("memory cost must be between 1 and 32768 KiB")
+	}
+	if a.Parallelism < 1 || a.Parallelism > 16 {
+		return nil, errors.New("parallelism must be between 1 and 16")
+	}
+
+	params := map[string]interface{}{
+		"hashType":        hashType,
+		"hashLengthBytes": a.HashLength,
+		"iterations":      a.Iterations,
+		"memoryCostKib":   a.MemoryCostKib,
+		"parallelism":     a.Parallelism,
+	}
+	switch a.Version {
+	case Argon2VersionUnspecified:
+	case Argon2Version10:
+		params["version"] = "VERSION_10"
+	case Argon2Version13:
+		params["version"] = "VERSION_13"
+	default:
+		return nil, fmt.Errorf("unknown argon2 version: %d", a.Version)
+	}
+	if len(a.AssociatedData) > 0 {
+		params["associatedData"] = base64.RawURLEncoding.EncodeToString(a.AssociatedData)
+	}
+	return internal.HashConfig{
+		"hashAlgorithm":    "ARGON2",
+		"argon2Parameters": params,
+	}, nil
+}
+
 // Bcrypt represents the BCRYPT hash algorithm.
 //
 // Refer to https://firebase.google.com/docs/auth/admin/import-users#import_users_with_bcrypt_hashed_passwords
@@ -93,70 +226,90 @@ func (s Scrypt) Config() (internal.HashConfig, error) {
 // HMACMD5 represents the HMAC SHA512 hash algorithm.
 //
 // Refer to https://firebase.google.com/docs/auth/admin/import-users#import_users_with_hmac_hashed_passwords
-// for more details. Key is required.
+// for more details. Key is required. InputOrder optionally specifies whether the salt is placed
+// before or after the password when computing the hash, and SaltSeparator optionally specifies
+// bytes inserted between them.
 type HMACMD5 struct {
-	Key []byte
+	Key           []byte
+	InputOrder    InputOrder
+	SaltSeparator []byte
 }
 
 // Config returns the validated hash configuration.
 func (h HMACMD5) Config() (internal.HashConfig, error) {
-	return hmacConfig("HMAC_MD5", h.Key)
+	return hmacConfig("HMAC_MD5", h.Key, h.InputOrder, h.SaltSeparator)
 }
 
 // HMACSHA1 represents the HMAC SHA512 hash algorithm.
 //
-// Key is required.
+// Key is required. InputOrder optionally specifies whether the salt is placed before or after the
+// password when computing the hash, and SaltSeparator optionally specifies bytes inserted between
+// them.
 // Refer to https://firebase.google.com/docs/auth/admin/import-users#import_users_with_hmac_hashed_passwords
 // for more details.
 type HMACSHA1 struct {
-	Key []byte
+	Key           []byte
+	InputOrder    InputOrder
+	SaltSeparator []byte
 }
 
 // Config returns the validated hash configuration.
 func (h HMACSHA1) Config() (internal.HashConfig, error) {
-	return hmacConfig("HMAC_SHA1", h.Key)
+	return hmacConfig("HMAC_SHA1", h.Key, h.InputOrder, h.SaltSeparator)
 }
 
 // HMACSHA256 represents the HMAC SHA512 hash algorithm.
 //
-// Key is required.
+// Key is required. InputOrder optionally specifies whether the salt is placed before or after the
+// password when computing the hash, and SaltSeparator optionally specifies bytes inserted between
+// them.
 // Refer to https://firebase.google.com/docs/auth/admin/import-users#import_users_with_hmac_hashed_passwords
 // for more details.
 type HMACSHA256 struct {
-	Key []byte
+	Key           []byte
+	InputOrder    InputOrder
+	SaltSeparator []byte
 }
 
 // Config returns the validated hash configuration.
 func (h HMACSHA256) Config() (internal.HashConfig, error) {
-	return hmacConfig("HMAC_SHA256", h.Key)
+	return hmacConfig("HMAC_SHA256", h.Key, h.InputOrder, h.SaltSeparator)
 }
 
 // HMACSHA512 represents the HMAC SHA512 hash algorithm.
 //
-// Key is required.
+// Key is required. InputOrder optionally specifies whether the salt is placed before or after the
+// password when computing the hash, and SaltSeparator optionally specifies bytes inserted between
+// them.
 // Refer to https://firebase.google.com/docs/auth/admin/import-users#import_users_with_hmac_hashed_passwords
 // for more details.
 type HMACSHA512 struct {
-	Key []byte
+	Key           []byte
+	InputOrder    InputOrder
+	SaltSeparator []byte
 }
 
 // Config returns the validated hash configuration.
 func (h HMACSHA512) Config() (internal.HashConfig, error) {
-	return hmacConfig("HMAC_SHA512", h.Key)
+	return hmacConfig("HMAC_SHA512", h.Key, h.InputOrder, h.SaltSeparator)
 }
 
 // MD5 represents the MD5 hash algorithm.
 //
-// Rounds must be between 0 and 120000.
+// Rounds must be between 0 and 120000. InputOrder optionally specifies whether the salt is placed
+// before or after the password when computing the hash, and SaltSeparator optionally specifies
+// bytes inserted between them.
 // Refer to https://firebase.google.com/docs/auth/admin/import-users#import_users_with_md5_sha_and_pbkdf_hashed_passwords
 // for more details.
 type MD5 struct {
-	Rounds int
+	Rounds        int
+	InputOrder    InputOrder
+	SaltSeparator []byte
 }
 
 // Config returns the validated hash configuration.
 func (h MD5) Config() (internal.HashConfig, error) {
-	return basicConfig("MD5", h.Rounds)
+	return orderedConfig("MD5", h.Rounds, h.InputOrder, h.SaltSeparator)
 }
 
 // PBKDF2SHA256 represents the PBKDF2SHA256 hash algorithm.
@@ -173,6 +326,20 @@ func (h PBKDF2SHA256) Config() (internal.HashConfig, error) {
 	return basicConfig("PBKDF2_SHA256", h.Rounds)
 }
 
+// PBKDF2SHA512 represents the PBKDF2SHA512 hash algorithm.
+//
+// Rounds must be between 0 and 120000.
+// Refer to https://firebase.google.com/docs/auth/admin/import-users#import_users_with_md5_sha_and_pbkdf_hashed_passwords
+// for more details.
+type PBKDF2SHA512 struct {
+	Rounds int
+}
+
+// Config returns the validated hash configuration.
+func (h PBKDF2SHA512) Config() (internal.HashConfig, error) {
+	return basicConfig("PBKDF2_SHA512", h.Rounds)
+}
+
 // PBKDFSHA1 represents the PBKDFSHA1 hash algorithm.
 //
 // Rounds must be between 0 and 120000.
@@ -189,54 +356,67 @@ func (h PBKDFSHA1) Config() (internal.HashConfig, error) {
 
 // SHA1 represents the SHA1 hash algorithm.
 //
-// Rounds must be between 0 and 120000.
+// Rounds must be between 0 and 120000. InputOrder optionally specifies whether the salt is placed
+// before or after the password when computing the hash, and SaltSeparator optionally specifies
+// bytes inserted between them.
 // Refer to https://firebase.google.com/docs/auth/admin/import-users#import_users_with_md5_sha_and_pbkdf_hashed_passwords
 // for more details.
 type SHA1 struct {
-	Rounds int
+	Rounds        int
+	InputOrder    InputOrder
+	SaltSeparator []byte
 }
 
 // Config returns the validated hash configuration.
 func (h SHA1) Config() (internal.HashConfig, error) {
-	return basicConfig("SHA1", h.Rounds)
+	return orderedConfig("SHA1", h.Rounds, h.InputOrder, h.SaltSeparator)
 }
 
 // SHA256 represents the SHA256 hash algorithm.
 //
-// Rounds must be between 0 and 120000.
+// Rounds must be between 0 and 120000. InputOrder optionally specifies whether the salt is placed
+// before or after the password when computing the hash, and SaltSeparator optionally specifies
+// bytes inserted between them.
 // Refer to https://firebase.google.com/docs/auth/admin/import-users#import_users_with_md5_sha_and_pbkdf_hashed_passwords
 // for more details.
 type SHA256 struct {
-	Rounds int
+	Rounds        int
+	InputOrder    InputOrder
+	SaltSeparator []byte
 }
 
 // Config returns the validated hash configuration.
 func (h SHA256) Config() (internal.HashConfig, error) {
-	return basicConfig("SHA256", h.Rounds)
+	return orderedConfig("SHA256", h.Rounds, h.InputOrder, h.SaltSeparator)
 }
 
 // SHA512 represents the SHA512 hash algorithm.
 //
-// Rounds must be between 0 and 120000.
+// Rounds must be between 0 and 120000. InputOrder optionally specifies whether the salt is placed
+// before or after the password when computing the hash, and SaltSeparator optionally specifies
+// bytes inserted between them.
 // Refer to https://firebase.google.com/docs/auth/admin/import-users#import_users_with_md5_sha_and_pbkdf_hashed_passwords
 // for more details.
 type SHA512 struct {
-	Rounds int
+	Rounds        int
+	InputOrder    InputOrder
+	SaltSeparator []byte
 }
 
 // Config returns the validated hash configuration.
 func (h SHA512) Config() (internal.HashConfig, error) {
-	return basicConfig("SHA512", h.Rounds)
+	return orderedConfig("SHA512", h.Rounds, h.InputOrder, h.SaltSeparator)
 }
 
-func hmacConfig(name string, key []byte) (internal.HashConfig, error) {
+func hmacConfig(name string, key []byte, order InputOrder, sep []byte) (internal.HashConfig, error) {
 	if len(key) == 0 {
 		return nil, errors.New("signer key not specified")
 	}
-	return internal.HashConfig{
+	conf := internal.HashConfig{
 		"hashAlgorithm": name,
 		"signerKey":     base64.RawURLEncoding.EncodeToString(key),
-	}, nil
+	}
+	return withSaltOptions(conf, order, sep)
 }
 
 func basicConfig(name string, rounds int) (internal.HashConfig, error) {
@@ -248,3 +428,25 @@ func basicConfig(name string, rounds int) (internal.HashConfig, error) {
 		"rounds":        rounds,
 	}, nil
 }
+
+func orderedConfig(name string, rounds int, order InputOrder, sep []byte) (internal.HashConfig, error) {
+	conf, err := basicConfig(name, rounds)
+	if err != nil {
+		return nil, err
+	}
+	return withSaltOptions(conf, order, sep)
+}
+
+func withSaltOptions(conf internal.HashConfig, order InputOrder, sep []byte) (internal.HashConfig, error) {
+	hashOrder, err := order.config()
+	if err != nil {
+		return nil, err
+	}
+	if hashOrder != "" {
+		conf["passwordHashOrder"] = hashOrder
+	}
+	if len(sep) > 0 {
+		conf["saltSeparator"] = base64.RawURLEncoding.EncodeToString(sep)
+	}
+	return conf, nil
+}
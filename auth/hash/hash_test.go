@@ -67,56 +67,56 @@ var validHashes = []struct {
 		},
 	},
 	{
-		alg: HMACMD5{signerKey},
+		alg: HMACMD5{Key: signerKey},
 		want: internal.HashConfig{
 			"hashAlgorithm": "HMAC_MD5",
 			"signerKey":     base64.RawURLEncoding.EncodeToString(signerKey),
 		},
 	},
 	{
-		alg: HMACSHA1{signerKey},
+		alg: HMACSHA1{Key: signerKey},
 		want: internal.HashConfig{
 			"hashAlgorithm": "HMAC_SHA1",
 			"signerKey":     base64.RawURLEncoding.EncodeToString(signerKey),
 		},
 	},
 	{
-		alg: HMACSHA256{signerKey},
+		alg: HMACSHA256{Key: signerKey},
 		want: internal.HashConfig{
 			"hashAlgorithm": "HMAC_SHA256",
 			"signerKey":     base64.RawURLEncoding.EncodeToString(signerKey),
 		},
 	},
 	{
-		alg: HMACSHA512{signerKey},
+		alg: HMACSHA512{Key: signerKey},
 		want: internal.HashConfig{
 			"hashAlgorithm": "HMAC_SHA512",
 			"signerKey":     base64.RawURLEncoding.EncodeToString(signerKey),
 		},
 	},
 	{
-		alg: MD5{42},
+		alg: MD5{Rounds: 42},
 		want: internal.HashConfig{
 			"hashAlgorithm": "MD5",
 			"rounds":        42,
 		},
 	},
 	{
-		alg: SHA1{42},
+		alg: SHA1{Rounds: 42},
 		want: internal.HashConfig{
 			"hashAlgorithm": "SHA1",
 			"rounds":        42,
 		},
 	},
 	{
-		alg: SHA256{42},
+		alg: SHA256{Rounds: 42},
 		want: internal.HashConfig{
 			"hashAlgorithm": "SHA256",
 			"rounds":        42,
 		},
 	},
 	{
-		alg: SHA512{42},
+		alg: SHA512{Rounds: 42},
 		want: internal.HashConfig{
 			"hashAlgorithm": "SHA512",
 			"rounds":        42,
@@ -136,6 +136,104 @@ var validHashes = []struct {
 			"rounds":        42,
 		},
 	},
+	{
+		alg: PBKDF2SHA512{42},
+		want: internal.HashConfig{
+			"hashAlgorithm": "PBKDF2_SHA512",
+			"rounds":        42,
+		},
+	},
+	{
+		alg: HMACSHA256{Key: signerKey, InputOrder: InputOrderSaltFirst},
+		want: internal.HashConfig{
+			"hashAlgorithm":     "HMAC_SHA256",
+			"signerKey":         base64.RawURLEncoding.EncodeToString(signerKey),
+			"passwordHashOrder": "SALT_AND_PASSWORD",
+		},
+	},
+	{
+		alg: HMACMD5{Key: signerKey, InputOrder: InputOrderPasswordFirst},
+		want: internal.HashConfig{
+			"hashAlgorithm":     "HMAC_MD5",
+			"signerKey":         base64.RawURLEncoding.EncodeToString(signerKey),
+			"passwordHashOrder": "PASSWORD_AND_SALT",
+		},
+	},
+	{
+		alg: SHA512{Rounds: 42, InputOrder: InputOrderSaltFirst},
+		want: internal.HashConfig{
+			"hashAlgorithm":     "SHA512",
+			"rounds":            42,
+			"passwordHashOrder": "SALT_AND_PASSWORD",
+		},
+	},
+	{
+		alg: MD5{Rounds: 42, InputOrder: InputOrderPasswordFirst},
+		want: internal.HashConfig{
+			"hashAlgorithm":     "MD5",
+			"rounds":            42,
+			"passwordHashOrder": "PASSWORD_AND_SALT",
+		},
+	},
+	{
+		alg: HMACSHA1{Key: signerKey, SaltSeparator: []byte(":")},
+		want: internal.HashConfig{
+			"hashAlgorithm": "HMAC_SHA1",
+			"signerKey":     base64.RawURLEncoding.EncodeToString(signerKey),
+			"saltSeparator": base64.RawURLEncoding.EncodeToString([]byte(":")),
+		},
+	},
+	{
+		alg: SHA1{Rounds: 42, InputOrder: InputOrderPasswordFirst, SaltSeparator: []byte(":")},
+		want: internal.HashConfig{
+			"hashAlgorithm":     "SHA1",
+			"rounds":            42,
+			"passwordHashOrder": "PASSWORD_AND_SALT",
+			"saltSeparator":     base64.RawURLEncoding.EncodeToString([]byte(":")),
+		},
+	},
+	{
+		alg: Argon2{
+			Type:          Argon2ID,
+			HashLength:    32,
+			Iterations:    2,
+			MemoryCostKib: 256,
+			Parallelism:   1,
+		},
+		want: internal.HashConfig{
+			"hashAlgorithm": "ARGON2",
+			"argon2Parameters": map[string]interface{}{
+				"hashType":        "ARGON2_ID",
+				"hashLengthBytes": 32,
+				"iterations":      2,
+				"memoryCostKib":   256,
+				"parallelism":     1,
+			},
+		},
+	},
+	{
+		alg: Argon2{
+			Type:           Argon2D,
+			Version:        Argon2Version10,
+			HashLength:     256,
+			Iterations:     16,
+			MemoryCostKib:  32768,
+			Parallelism:    16,
+			AssociatedData: []byte("data"),
+		},
+		want: internal.HashConfig{
+			"hashAlgorithm": "ARGON2",
+			"argon2Parameters": map[string]interface{}{
+				"hashType":        "ARGON2_D",
+				"version":         "VERSION_10",
+				"hashLengthBytes": 256,
+				"iterations":      16,
+				"memoryCostKib":   32768,
+				"parallelism":     16,
+				"associatedData":  base64.RawURLEncoding.EncodeToString([]byte("data")),
+			},
+		},
+	},
 }
 
 var invalidHashes = []struct {
@@ -202,19 +300,19 @@ var invalidHashes = []struct {
 	},
 	{
 		name: "MD5: rounds too low",
-		alg:  MD5{-1},
+		alg:  MD5{Rounds: -1},
 	},
 	{
 		name: "SHA1: rounds too low",
-		alg:  SHA1{-1},
+		alg:  SHA1{Rounds: -1},
 	},
 	{
 		name: "SHA256: rounds too low",
-		alg:  SHA256{-1},
+		alg:  SHA256{Rounds: -1},
 	},
 	{
 		name: "SHA512: rounds too low",
-		alg:  SHA512{-1},
+		alg:  SHA512{Rounds: -1},
 	},
 	{
 		name: "PBKDFSHA1: rounds too low",
@@ -226,19 +324,19 @@ var invalidHashes = []struct {
 	},
 	{
 		name: "MD5: rounds too high",
-		alg:  MD5{120001},
+		alg:  MD5{Rounds: 120001},
 	},
 	{
 		name: "SHA1: rounds too high",
-		alg:  SHA1{120001},
+		alg:  SHA1{Rounds: 120001},
 	},
 	{
 		name: "SHA256: rounds too high",
-		alg:  SHA256{120001},
+		alg:  SHA256{Rounds: 120001},
 	},
 	{
 		name: "SHA512: rounds too high",
-		alg:  SHA512{120001},
+		alg:  SHA512{Rounds: 120001},
 	},
 	{
 		name: "PBKDFSHA1: rounds too high",
@@ -248,6 +346,66 @@ var invalidHashes = []struct {
 		name: "PBKDF2SHA256: rounds too high",
 		alg:  PBKDF2SHA256{120001},
 	},
+	{
+		name: "PBKDF2SHA512: rounds too low",
+		alg:  PBKDF2SHA512{-1},
+	},
+	{
+		name: "PBKDF2SHA512: rounds too high",
+		alg:  PBKDF2SHA512{120001},
+	},
+	{
+		name: "HMAC_SHA256: invalid input order",
+		alg:  HMACSHA256{Key: signerKey, InputOrder: 42},
+	},
+	{
+		name: "SHA256: invalid input order",
+		alg:  SHA256{Rounds: 42, InputOrder: 42},
+	},
+	{
+		name: "ARGON2: unspecified type",
+		alg:  Argon2{HashLength: 32, Iterations: 2, MemoryCostKib: 256, Parallelism: 1},
+	},
+	{
+		name: "ARGON2: invalid type",
+		alg:  Argon2{Type: 42, HashLength: 32, Iterations: 2, MemoryCostKib: 256, Parallelism: 1},
+	},
+	{
+		name: "ARGON2: invalid version",
+		alg:  Argon2{Type: Argon2ID, Version: 42, HashLength: 32, Iterations: 2, MemoryCostKib: 256, Parallelism: 1},
+	},
+	{
+		name: "ARGON2: hash length too low",
+		alg:  Argon2{Type: Argon2ID, Iterations: 2, MemoryCostKib: 256, Parallelism: 1},
+	},
+	{
+		name: "ARGON2: hash length too high",
+		alg:  Argon2{Type: Argon2ID, HashLength: 257, Iterations: 2, MemoryCostKib: 256, Parallelism: 1},
+	},
+	{
+		name: "ARGON2: iterations too low",
+		alg:  Argon2{Type: Argon2ID, HashLength: 32, MemoryCostKib: 256, Parallelism: 1},
+	},
+	{
+		name: "ARGON2: iterations too high",
+		alg:  Argon2{Type: Argon2ID, HashLength: 32, Iterations: 17, MemoryCostKib: 256, Parallelism: 1},
+	},
+	{
+		name: "ARGON2: memory cost too low",
+		alg:  Argon2{Type: Argon2ID, HashLength: 32, Iterations: 2, Parallelism: 1},
+	},
+	{
+		name: "ARGON2: memory cost too high",
+		alg:  Argon2{Type: Argon2ID, HashLength: 32, Iterations: 2, MemoryCostKib: 32769, Parallelism: 1},
+	},
+	{
+		name: "ARGON2: parallelism too low",
+		alg:  Argon2{Type: Argon2ID, HashLength: 32, Iterations: 2, MemoryCostKib: 256},
+	},
+	{
+		name: "ARGON2: parallelism too high",
+		alg:  Argon2{Type: Argon2ID, HashLength: 32, Iterations: 2, MemoryCostKib: 256, Parallelism: 17},
+	},
 }
 
 func TestValidHash(t *testing.T) {
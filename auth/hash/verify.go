@@ -0,0 +1,318 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hash
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	gohash "hash"
+
+	"firebase.google.com/go/internal"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrPasswordMismatch is returned by Verify when the password does not match the given hash.
+var ErrPasswordMismatch = errors.New("password does not match the hash")
+
+// Verifier is implemented by all hash algorithms in this package.
+//
+// Verify checks a plain text password against a password hash and salt, using the same semantics
+// Firebase Auth applies to users imported with that hash configuration. This makes it possible to
+// validate a sample of legacy user records locally before calling ImportUsers(). Verify returns
+// ErrPasswordMismatch when the password does not match, and any other error when the hash
+// configuration itself is invalid.
+type Verifier interface {
+	Verify(password, hash, salt []byte) error
+}
+
+// Hash computes the Argon2 hash of the given password and salt.
+//
+// Only the Argon2id and Argon2i variants of version 0x13 without AssociatedData can be computed
+// locally. Hash returns an error for all other configurations, even though they are supported by
+// ImportUsers().
+func (a Argon2) Hash(password, salt []byte) ([]byte, error) {
+	if _, err := a.Config(); err != nil {
+		return nil, err
+	}
+	if a.Version == Argon2Version10 || len(a.AssociatedData) > 0 {
+		return nil, errors.New("argon2 version 0x10 and associated data are not supported locally")
+	}
+	var (
+		iterations = uint32(a.Iterations)
+		memory     = uint32(a.MemoryCostKib)
+		threads    = uint8(a.Parallelism)
+		keyLen     = uint32(a.HashLength)
+	)
+	switch a.Type {
+	case Argon2ID:
+		return argon2.IDKey(password, salt, iterations, memory, threads, keyLen), nil
+	case Argon2I:
+		return argon2.Key(password, salt, iterations, memory, threads, keyLen), nil
+	default:
+		return nil, errors.New("argon2d is not supported locally")
+	}
+}
+
+// Verify checks a password against an Argon2 hash and salt.
+func (a Argon2) Verify(password, hash, salt []byte) error {
+	return verify(a.Hash, password, hash, salt)
+}
+
+// Verify checks a password against a bcrypt hash. The salt is encoded in the bcrypt hash, and
+// hence the salt argument is ignored.
+func (b Bcrypt) Verify(password, hash, salt []byte) error {
+	err := bcrypt.CompareHashAndPassword(hash, password)
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+// Hash computes the standard scrypt hash of the given password and salt.
+func (s StandardScrypt) Hash(password, salt []byte) ([]byte, error) {
+	if _, err := s.Config(); err != nil {
+		return nil, err
+	}
+	return scrypt.Key(password, salt, s.MemoryCost, s.BlockSize, s.Parallelization, s.DerivedKeyLength)
+}
+
+// Verify checks a password against a standard scrypt hash and salt.
+func (s StandardScrypt) Verify(password, hash, salt []byte) error {
+	return verify(s.Hash, password, hash, salt)
+}
+
+// Hash computes the Firebase scrypt hash of the given password and salt.
+//
+// The password is first stretched with scrypt, using the salt followed by the SaltSeparator as
+// the scrypt salt. The derived key is then used to encrypt the signer Key with AES-256 in CTR mode.
+func (s Scrypt) Hash(password, salt []byte) ([]byte, error) {
+	if _, err := s.Config(); err != nil {
+		return nil, err
+	}
+	combinedSalt := append(append([]byte{}, salt...), s.SaltSeparator...)
+	derivedKey, err := scrypt.Key(password, combinedSalt, 1<<uint(s.MemoryCost), s.Rounds, 1, 64)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(derivedKey[:32])
+	if err != nil {
+		return nil, err
+	}
+	result := make([]byte, len(s.Key))
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(result, s.Key)
+	return result, nil
+}
+
+// Verify checks a password against a Firebase scrypt hash and salt.
+func (s Scrypt) Verify(password, hash, salt []byte) error {
+	return verify(s.Hash, password, hash, salt)
+}
+
+// Hash computes the HMAC MD5 digest of the salt and the password, concatenated in InputOrder
+// with the SaltSeparator between them.
+func (h HMACMD5) Hash(password, salt []byte) ([]byte, error) {
+	return hmacHash(h, md5.New, h.Key, h.InputOrder, h.SaltSeparator, password, salt)
+}
+
+// Verify checks a password against an HMAC MD5 hash and salt.
+func (h HMACMD5) Verify(password, hash, salt []byte) error {
+	return verify(h.Hash, password, hash, salt)
+}
+
+// Hash computes the HMAC SHA1 digest of the salt and the password, concatenated in InputOrder
+// with the SaltSeparator between them.
+func (h HMACSHA1) Hash(password, salt []byte) ([]byte, error) {
+	return hmacHash(h, sha1.New, h.Key, h.InputOrder, h.SaltSeparator, password, salt)
+}
+
+// Verify checks a password against an HMAC SHA1 hash and salt.
+func (h HMACSHA1) Verify(password, hash, salt []byte) error {
+	return verify(h.Hash, password, hash, salt)
+}
+
+// Hash computes the HMAC SHA256 digest of the salt and the password, concatenated in InputOrder
+// with the SaltSeparator between them.
+func (h HMACSHA256) Hash(password, salt []byte) ([]byte, error) {
+	return hmacHash(h, sha256.New, h.Key, h.InputOrder, h.SaltSeparator, password, salt)
+}
+
+// Verify checks a password against an HMAC SHA256 hash and salt.
+func (h HMACSHA256) Verify(password, hash, salt []byte) error {
+	return verify(h.Hash, password, hash, salt)
+}
+
+// Hash computes the HMAC SHA512 digest of the salt and the password, concatenated in InputOrder
+// with the SaltSeparator between them.
+func (h HMACSHA512) Hash(password, salt []byte) ([]byte, error) {
+	return hmacHash(h, sha512.New, h.Key, h.InputOrder, h.SaltSeparator, password, salt)
+}
+
+// Verify checks a password against an HMAC SHA512 hash and salt.
+func (h HMACSHA512) Verify(password, hash, salt []byte) error {
+	return verify(h.Hash, password, hash, salt)
+}
+
+// Hash computes the MD5 digest of the salt and the password, concatenated in InputOrder with
+// the SaltSeparator between them, and rehashes the result until Rounds digests have been
+// computed. A Rounds value of 0 is treated as 1.
+func (h MD5) Hash(password, salt []byte) ([]byte, error) {
+	return roundsHash(h, md5.New, h.Rounds, h.InputOrder, h.SaltSeparator, password, salt)
+}
+
+// Verify checks a password against an MD5 hash and salt.
+func (h MD5) Verify(password, hash, salt []byte) error {
+	return verify(h.Hash, password, hash, salt)
+}
+
+// Hash computes the PBKDF2 key of the password and salt using SHA256 and the configured
+// number of Rounds. A Rounds value of 0 is treated as 1.
+func (h PBKDF2SHA256) Hash(password, salt []byte) ([]byte, error) {
+	return pbkdf2Hash(h, sha256.New, sha256.Size, h.Rounds, password, salt)
+}
+
+// Verify checks a password against a PBKDF2 SHA256 hash and salt.
+func (h PBKDF2SHA256) Verify(password, hash, salt []byte) error {
+	return verify(h.Hash, password, hash, salt)
+}
+
+// Hash computes the PBKDF2 key of the password and salt using SHA512 and the configured
+// number of Rounds. A Rounds value of 0 is treated as 1.
+func (h PBKDF2SHA512) Hash(password, salt []byte) ([]byte, error) {
+	return pbkdf2Hash(h, sha512.New, sha512.Size, h.Rounds, password, salt)
+}
+
+// Verify checks a password against a PBKDF2 SHA512 hash and salt.
+func (h PBKDF2SHA512) Verify(password, hash, salt []byte) error {
+	return verify(h.Hash, password, hash, salt)
+}
+
+// Hash computes the PBKDF2 key of the password and salt using SHA1 and the configured
+// number of Rounds. A Rounds value of 0 is treated as 1.
+func (h PBKDFSHA1) Hash(password, salt []byte) ([]byte, error) {
+	return pbkdf2Hash(h, sha1.New, sha1.Size, h.Rounds, password, salt)
+}
+
+// Verify checks a password against a PBKDF SHA1 hash and salt.
+func (h PBKDFSHA1) Verify(password, hash, salt []byte) error {
+	return verify(h.Hash, password, hash, salt)
+}
+
+// Hash computes the SHA1 digest of the salt and the password, concatenated in InputOrder with
+// the SaltSeparator between them, and rehashes the result until Rounds digests have been
+// computed. A Rounds value of 0 is treated as 1.
+func (h SHA1) Hash(password, salt []byte) ([]byte, error) {
+	return roundsHash(h, sha1.New, h.Rounds, h.InputOrder, h.SaltSeparator, password, salt)
+}
+
+// Verify checks a password against a SHA1 hash and salt.
+func (h SHA1) Verify(password, hash, salt []byte) error {
+	return verify(h.Hash, password, hash, salt)
+}
+
+// Hash computes the SHA256 digest of the salt and the password, concatenated in InputOrder with
+// the SaltSeparator between them, and rehashes the result until Rounds digests have been
+// computed. A Rounds value of 0 is treated as 1.
+func (h SHA256) Hash(password, salt []byte) ([]byte, error) {
+	return roundsHash(h, sha256.New, h.Rounds, h.InputOrder, h.SaltSeparator, password, salt)
+}
+
+// Verify checks a password against a SHA256 hash and salt.
+func (h SHA256) Verify(password, hash, salt []byte) error {
+	return verify(h.Hash, password, hash, salt)
+}
+
+// Hash computes the SHA512 digest of the salt and the password, concatenated in InputOrder with
+// the SaltSeparator between them, and rehashes the result until Rounds digests have been
+// computed. A Rounds value of 0 is treated as 1.
+func (h SHA512) Hash(password, salt []byte) ([]byte, error) {
+	return roundsHash(h, sha512.New, h.Rounds, h.InputOrder, h.SaltSeparator, password, salt)
+}
+
+// Verify checks a password against a SHA512 hash and salt.
+func (h SHA512) Verify(password, hash, salt []byte) error {
+	return verify(h.Hash, password, hash, salt)
+}
+
+type configurer interface {
+	Config() (internal.HashConfig, error)
+}
+
+func verify(hashFunc func(password, salt []byte) ([]byte, error), password, hash, salt []byte) error {
+	got, err := hashFunc(password, salt)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(got, hash) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func hmacHash(
+	c configurer, h func() gohash.Hash, key []byte, order InputOrder, sep, password, salt []byte) ([]byte, error) {
+	if _, err := c.Config(); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(h, key)
+	writeOrdered(mac, order, sep, password, salt)
+	return mac.Sum(nil), nil
+}
+
+func roundsHash(
+	c configurer, h func() gohash.Hash, rounds int, order InputOrder, sep, password, salt []byte) ([]byte, error) {
+	if _, err := c.Config(); err != nil {
+		return nil, err
+	}
+	d := h()
+	writeOrdered(d, order, sep, password, salt)
+	result := d.Sum(nil)
+	for i := 1; i < rounds; i++ {
+		d.Reset()
+		d.Write(result)
+		result = d.Sum(nil)
+	}
+	return result, nil
+}
+
+func pbkdf2Hash(
+	c configurer, h func() gohash.Hash, keyLen, rounds int, password, salt []byte) ([]byte, error) {
+	if _, err := c.Config(); err != nil {
+		return nil, err
+	}
+	if rounds == 0 {
+		rounds = 1
+	}
+	return pbkdf2.Key(password, salt, rounds, keyLen, h), nil
+}
+
+func writeOrdered(h gohash.Hash, order InputOrder, sep, password, salt []byte) {
+	first, second := salt, password
+	if order == InputOrderPasswordFirst {
+		first, second = password, salt
+	}
+	h.Write(first)
+	h.Write(sep)
+	h.Write(second)
+}
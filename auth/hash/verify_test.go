@@ -0,0 +1,299 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hash
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	testPassword = []byte("password")
+	testSalt     = []byte("NaCl")
+)
+
+// Test vector from https://github.com/firebase/scrypt.
+var firebaseScrypt = struct {
+	alg      Scrypt
+	password []byte
+	salt     string
+	hash     string
+}{
+	alg: Scrypt{
+		Key: decodeStd(
+			"jxspr8Ki0RYycVU8zykbdLGjFQ3McFUH0uiiTvC8pVMXAn210wjLNmdZJzxUECKbm0QsEmYUSDzZvpjeJ9WmXA=="),
+		SaltSeparator: decodeStd("Bw=="),
+		Rounds:        8,
+		MemoryCost:    14,
+	},
+	password: []byte("user1password"),
+	salt:     "42xEC+ixf3L2lw==",
+	hash:     "lSrfV15cpx95/sZS2W9c9Kp6i/LVgQNDNC/qzrCnh1SAyZvqmZqAjTdn3aoItz+VHjoZilo78198JAdRuid5lQ==",
+}
+
+var verifyHashes = []struct {
+	name string
+	alg  Verifier
+	hash string
+}{
+	{
+		name: "STANDARD_SCRYPT",
+		alg: StandardScrypt{
+			BlockSize:        8,
+			DerivedKeyLength: 64,
+			MemoryCost:       1024,
+			Parallelization:  1,
+		},
+		hash: "J7QYxnTHadElAfux9TusMt9lFMDyjQQ4crFIs0iWGnkFemhhzDVTJGqg3bY7wHRFC5JAIlR6eZU41gM5aDXdYg==",
+	},
+	{
+		name: "HMAC_MD5",
+		alg:  HMACMD5{Key: signerKey},
+		hash: "FUI2YC/six/KDEMF0LzUgw==",
+	},
+	{
+		name: "HMAC_SHA1",
+		alg:  HMACSHA1{Key: signerKey},
+		hash: "y7Z0UDkAFAoqU4AbbJYMGQQxvDQ=",
+	},
+	{
+		name: "HMAC_SHA256",
+		alg:  HMACSHA256{Key: signerKey},
+		hash: "st3fXuRtERiJhuM60Cno00td++fFTcwrN+6U1FBfsaE=",
+	},
+	{
+		name: "HMAC_SHA512",
+		alg:  HMACSHA512{Key: signerKey},
+		hash: "6lju7S+1F7U6K8eD3utkm2/Y1UMy2rdeI3XrOo/yyegzHOmx+T+cylpxa+fOBcxOBCH0UPB04kC0cFBxUwenxQ==",
+	},
+	{
+		name: "MD5",
+		alg:  MD5{Rounds: 42},
+		hash: "ub/d3wcVlwFQP2nVUblrMA==",
+	},
+	{
+		name: "SHA1",
+		alg:  SHA1{Rounds: 42},
+		hash: "8lpwAxic/8m76ujpjpocmMaQguc=",
+	},
+	{
+		name: "SHA256",
+		alg:  SHA256{Rounds: 42},
+		hash: "00NvdTCnquBsIdQSP+4koo6KckLsLzpeycv+QR6Bloo=",
+	},
+	{
+		name: "SHA512",
+		alg:  SHA512{Rounds: 42},
+		hash: "WaYKmy+78IJBWUqSpNT38PgKNJYdVo2WY2dtc42f0bHLBMClwmTMxZBLT/oWY5Yh2cAMw1wB049yvPfG7stiSw==",
+	},
+	{
+		name: "PBKDF_SHA1",
+		alg:  PBKDFSHA1{42},
+		hash: "Q4R497vAhEyVS7Calu1/nO3rqlI=",
+	},
+	{
+		name: "PBKDF2_SHA256",
+		alg:  PBKDF2SHA256{42},
+		hash: "QWEY3ZlLNMLbIa2xHWfQLBZPc4huXc2QWtWpW1xHxXA=",
+	},
+	{
+		name: "PBKDF2_SHA512",
+		alg:  PBKDF2SHA512{42},
+		hash: "rMmu/EqIuwil9ib7waozsIhv98t2/drnlE7IZgz4KQn8xaMb7k3kkA6V3UNZAcX++BggyfYhXV80lxHTaFj84A==",
+	},
+	{
+		name: "HMAC_SHA256: salt first",
+		alg:  HMACSHA256{Key: signerKey, InputOrder: InputOrderSaltFirst},
+		hash: "st3fXuRtERiJhuM60Cno00td++fFTcwrN+6U1FBfsaE=",
+	},
+	{
+		name: "HMAC_SHA256: password first",
+		alg:  HMACSHA256{Key: signerKey, InputOrder: InputOrderPasswordFirst},
+		hash: "Hjs63nEDhl2okkYzwJCe+GjazVkfsDGGvy8UAdSegWQ=",
+	},
+	{
+		name: "SHA256: salt first",
+		alg:  SHA256{Rounds: 42, InputOrder: InputOrderSaltFirst},
+		hash: "00NvdTCnquBsIdQSP+4koo6KckLsLzpeycv+QR6Bloo=",
+	},
+	{
+		name: "SHA256: password first",
+		alg:  SHA256{Rounds: 42, InputOrder: InputOrderPasswordFirst},
+		hash: "rx9c6MFTKRvgXpb4kn3N1uDpBnkXWJFiNUGx/i5bOgw=",
+	},
+	{
+		name: "HMAC_SHA256: salt separator",
+		alg:  HMACSHA256{Key: signerKey, SaltSeparator: []byte(":")},
+		hash: "WRt7kxO8CALW1exw7Tlm+3ePl0X7MvADqtMO+O8SW8k=",
+	},
+	{
+		name: "HMAC_SHA256: password first with salt separator",
+		alg:  HMACSHA256{Key: signerKey, InputOrder: InputOrderPasswordFirst, SaltSeparator: []byte(":")},
+		hash: "xbIv42vlrGIsbqA5r5YP3wXxBV2QbtyZUu6rd6yYQms=",
+	},
+	{
+		name: "SHA256: salt separator",
+		alg:  SHA256{Rounds: 42, SaltSeparator: []byte(":")},
+		hash: "J+TOhzI4+Pj6ni8GYBeSoa4uBZWWu3q8dYBUfPSjlrU=",
+	},
+	{
+		name: "SHA256: password first with salt separator",
+		alg:  SHA256{Rounds: 42, InputOrder: InputOrderPasswordFirst, SaltSeparator: []byte(":")},
+		hash: "cMiUMAqG0kRRf7BkWANMvED5jniBJ5u6GsmTTbD5RJc=",
+	},
+}
+
+// Test vector from the Argon2 reference implementation (https://github.com/P-H-C/phc-winner-argon2).
+var argon2i = struct {
+	alg      Argon2
+	password []byte
+	salt     []byte
+	hash     string
+}{
+	alg: Argon2{
+		Type:          Argon2I,
+		Version:       Argon2Version13,
+		HashLength:    32,
+		Iterations:    2,
+		MemoryCostKib: 256,
+		Parallelism:   1,
+	},
+	password: []byte("password"),
+	salt:     []byte("somesalt"),
+	hash:     "89e9029f4637b295beb027056a7336c414fadd43f6b208645281cb214a56452f",
+}
+
+func TestVerify(t *testing.T) {
+	for _, tc := range verifyHashes {
+		hash := decodeStd(tc.hash)
+		if err := tc.alg.Verify(testPassword, hash, testSalt); err != nil {
+			t.Errorf("%s; Verify() = %v; want = nil", tc.name, err)
+		}
+		if err := tc.alg.Verify([]byte("wrong"), hash, testSalt); err != ErrPasswordMismatch {
+			t.Errorf("%s; Verify(wrong password) = %v; want = %v", tc.name, err, ErrPasswordMismatch)
+		}
+		if err := tc.alg.Verify(testPassword, hash, []byte("wrong")); err != ErrPasswordMismatch {
+			t.Errorf("%s; Verify(wrong salt) = %v; want = %v", tc.name, err, ErrPasswordMismatch)
+		}
+	}
+}
+
+func TestVerifyFirebaseScrypt(t *testing.T) {
+	tc := firebaseScrypt
+	hash := decodeStd(tc.hash)
+	salt := decodeStd(tc.salt)
+	if err := tc.alg.Verify(tc.password, hash, salt); err != nil {
+		t.Errorf("Verify() = %v; want = nil", err)
+	}
+	if err := tc.alg.Verify([]byte("wrong"), hash, salt); err != ErrPasswordMismatch {
+		t.Errorf("Verify(wrong password) = %v; want = %v", err, ErrPasswordMismatch)
+	}
+
+	wrongKey := tc.alg
+	wrongKey.Key = signerKey
+	if err := wrongKey.Verify(tc.password, hash, salt); err != ErrPasswordMismatch {
+		t.Errorf("Verify(wrong key) = %v; want = %v", err, ErrPasswordMismatch)
+	}
+
+	wrongSeparator := tc.alg
+	wrongSeparator.SaltSeparator = nil
+	if err := wrongSeparator.Verify(tc.password, hash, salt); err != ErrPasswordMismatch {
+		t.Errorf("Verify(wrong separator) = %v; want = %v", err, ErrPasswordMismatch)
+	}
+}
+
+func TestVerifyBcrypt(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword(testPassword, bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (Bcrypt{}).Verify(testPassword, hash, nil); err != nil {
+		t.Errorf("Verify() = %v; want = nil", err)
+	}
+	if err := (Bcrypt{}).Verify([]byte("wrong"), hash, nil); err != ErrPasswordMismatch {
+		t.Errorf("Verify(wrong password) = %v; want = %v", err, ErrPasswordMismatch)
+	}
+	if err := (Bcrypt{}).Verify(testPassword, []byte("not a hash"), nil); err == nil || err == ErrPasswordMismatch {
+		t.Errorf("Verify(malformed hash) = %v; want = error", err)
+	}
+}
+
+func TestVerifyArgon2(t *testing.T) {
+	tc := argon2i
+	hash, err := hex.DecodeString(tc.hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.alg.Verify(tc.password, hash, tc.salt); err != nil {
+		t.Errorf("Verify() = %v; want = nil", err)
+	}
+	if err := tc.alg.Verify([]byte("wrong"), hash, tc.salt); err != ErrPasswordMismatch {
+		t.Errorf("Verify(wrong password) = %v; want = %v", err, ErrPasswordMismatch)
+	}
+
+	id := tc.alg
+	id.Type = Argon2ID
+	idHash, err := id.Hash(tc.password, tc.salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(idHash, hash) {
+		t.Errorf("Hash(argon2id) = Hash(argon2i); want different hashes")
+	}
+	if err := id.Verify(tc.password, idHash, tc.salt); err != nil {
+		t.Errorf("Verify(argon2id) = %v; want = nil", err)
+	}
+}
+
+func TestVerifyArgon2Unsupported(t *testing.T) {
+	base := argon2i.alg
+	d := base
+	d.Type = Argon2D
+	v10 := base
+	v10.Version = Argon2Version10
+	ad := base
+	ad.AssociatedData = []byte("data")
+
+	for _, alg := range []Argon2{d, v10, ad} {
+		if err := alg.Verify(testPassword, []byte("hash"), testSalt); err == nil || err == ErrPasswordMismatch {
+			t.Errorf("Verify(%#v) = %v; want = error", alg, err)
+		}
+	}
+}
+
+func TestVerifyInvalidHash(t *testing.T) {
+	for _, tc := range invalidHashes {
+		v, ok := tc.alg.(Verifier)
+		if !ok {
+			t.Fatalf("%s; %T does not implement Verifier", tc.name, tc.alg)
+		}
+		err := v.Verify(testPassword, []byte("hash"), testSalt)
+		if err == nil || err == ErrPasswordMismatch {
+			t.Errorf("%s; Verify() = %v; want = config error", tc.name, err)
+		}
+	}
+}
+
+func decodeStd(s string) []byte {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
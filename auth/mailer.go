@@ -0,0 +1,300 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"net/mail"
+	"net/smtp"
+	"regexp"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// EmailAction identifies the type of email action link contained in an EmailMessage.
+type EmailAction string
+
+const (
+	// EmailVerificationAction identifies email verification links.
+	EmailVerificationAction EmailAction = EmailAction(emailVerification)
+
+	// PasswordResetAction identifies password reset links.
+	PasswordResetAction EmailAction = EmailAction(passwordReset)
+
+	// EmailSignInAction identifies email link sign-in links.
+	EmailSignInAction EmailAction = EmailAction(emailLinkSignIn)
+)
+
+// EmailMessage represents an email that carries an email action link.
+//
+// The Client populates the To, Action, Link and Locale fields. Subject and Body are left empty, and
+// are expected to be filled in by a Mailer such as TemplateMailer before the message is delivered.
+type EmailMessage struct {
+	To      string
+	Action  EmailAction
+	Link    string
+	Locale  string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails containing email action links generated by the Client.
+//
+// A Mailer can be attached to a Client by calling WithMailer(). Implementations must be safe for
+// concurrent use.
+type Mailer interface {
+	SendEmail(ctx context.Context, msg *EmailMessage) error
+}
+
+// WithMailer returns a copy of this Client that uses the given Mailer to deliver email action links.
+//
+// The returned Client shares all other state with the original Client.
+func (c *Client) WithMailer(m Mailer) *Client {
+	cp := *c
+	cp.mailer = m
+	return &cp
+}
+
+// MailEmailVerificationLink generates an email verification link for the specified email address, and
+// delivers it using the Mailer of this Client. Locale is passed on to the Mailer, and settings may be nil.
+func (c *userManagementClient) MailEmailVerificationLink(
+	ctx context.Context, email string, settings *ActionCodeSettings, locale string) error {
+	return c.mailEmailActionLink(ctx, emailVerification, email, settings, locale)
+}
+
+// MailPasswordResetLink generates a password reset link for the specified email address, and delivers it
+// using the Mailer of this Client. Locale is passed on to the Mailer, and settings may be nil.
+func (c *userManagementClient) MailPasswordResetLink(
+	ctx context.Context, email string, settings *ActionCodeSettings, locale string) error {
+	return c.mailEmailActionLink(ctx, passwordReset, email, settings, locale)
+}
+
+// MailEmailSignInLink generates an email link sign-in link for the specified email address, and delivers
+// it using the Mailer of this Client. Locale is passed on to the Mailer, and settings are required.
+func (c *userManagementClient) MailEmailSignInLink(
+	ctx context.Context, email string, settings *ActionCodeSettings, locale string) error {
+	return c.mailEmailActionLink(ctx, emailLinkSignIn, email, settings, locale)
+}
+
+func (c *userManagementClient) mailEmailActionLink(
+	ctx context.Context, linkType linkType, email string, settings *ActionCodeSettings, locale string) error {
+	if c.mailer == nil {
+		return errors.New("mailer not specified; use WithMailer() to configure one")
+	}
+
+	link, err := c.generateEmailActionLink(ctx, linkType, email, settings)
+	if err != nil {
+		return err
+	}
+
+	return c.mailer.SendEmail(ctx, &EmailMessage{
+		To:     email,
+		Action: EmailAction(linkType),
+		Link:   link,
+		Locale: locale,
+	})
+}
+
+// TemplateMailer is a Mailer that renders the subject and body of each message from templates, and
+// then hands the message over to another Mailer for delivery.
+//
+// Templates are registered per action and locale by calling AddTemplate(). When rendering a message,
+// TemplateMailer first looks for a template registered for the exact locale of the message (e.g.
+// "fr-CA"), followed by its base language ("fr"), and finally the default locale ("").
+type TemplateMailer struct {
+	mailer    Mailer
+	mu        sync.RWMutex
+	templates map[templateKey]*emailTemplate
+}
+
+// EmailTemplateData is the data made available to the templates of a TemplateMailer.
+type EmailTemplateData struct {
+	Email  string
+	Action EmailAction
+	Link   string
+	Locale string
+}
+
+type templateKey struct {
+	action EmailAction
+	locale string
+}
+
+type emailTemplate struct {
+	subject *texttemplate.Template
+	body    *htmltemplate.Template
+}
+
+// NewTemplateMailer creates a new TemplateMailer that delivers rendered messages using the given Mailer.
+func NewTemplateMailer(m Mailer) *TemplateMailer {
+	return &TemplateMailer{
+		mailer:    m,
+		templates: make(map[templateKey]*emailTemplate),
+	}
+}
+
+// AddTemplate registers the subject and body templates to be used for the given action and locale.
+//
+// The subject is parsed as a text/template, and the body as an html/template. Both are executed with
+// an EmailTemplateData value. An empty locale registers the default templates for the action.
+func (t *TemplateMailer) AddTemplate(action EmailAction, locale, subject, body string) error {
+	name := fmt.Sprintf("%s:%s", action, locale)
+	st, err := texttemplate.New(name).Parse(subject)
+	if err != nil {
+		return err
+	}
+	bt, err := htmltemplate.New(name).Parse(body)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.templates[templateKey{action, locale}] = &emailTemplate{subject: st, body: bt}
+	return nil
+}
+
+// SendEmail renders the subject and body of the given message, and delivers it.
+func (t *TemplateMailer) SendEmail(ctx context.Context, msg *EmailMessage) error {
+	tmpl, err := t.lookup(msg.Action, msg.Locale)
+	if err != nil {
+		return err
+	}
+
+	data := &EmailTemplateData{
+		Email:  msg.To,
+		Action: msg.Action,
+		Link:   msg.Link,
+		Locale: msg.Locale,
+	}
+	var subject, body bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, data); err != nil {
+		return err
+	}
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return err
+	}
+
+	rendered := *msg
+	rendered.Subject = subject.String()
+	rendered.Body = body.String()
+	return t.mailer.SendEmail(ctx, &rendered)
+}
+
+func (t *TemplateMailer) lookup(action EmailAction, locale string) (*emailTemplate, error) {
+	candidates := []string{locale}
+	if idx := strings.IndexAny(locale, "-_"); idx > 0 {
+		candidates = append(candidates, locale[:idx])
+	}
+	candidates = append(candidates, "")
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, l := range candidates {
+		if tmpl, ok := t.templates[templateKey{action, l}]; ok {
+			return tmpl, nil
+		}
+	}
+	return nil, fmt.Errorf("no email template found for action %q and locale %q", action, locale)
+}
+
+// SMTPMailer is a Mailer that delivers messages as HTML emails through an SMTP server.
+//
+// The sender and recipient must be valid email addresses, optionally with display names, and the
+// locale of the message must be a language tag such as "fr-CA". Messages with any other values are
+// rejected, so that they cannot inject headers into the email.
+//
+// SMTPMailer does not render messages. It is typically wrapped in a TemplateMailer, which populates
+// the Subject and Body of each message before it reaches the SMTPMailer.
+type SMTPMailer struct {
+	// Addr is the address of the SMTP server, in the host:port form.
+	Addr string
+	// Auth is the optional authentication mechanism used to log into the SMTP server.
+	Auth smtp.Auth
+	// From is the email address used as the sender of all messages.
+	From string
+
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// SendEmail delivers the given message through the SMTP server.
+func (m *SMTPMailer) SendEmail(ctx context.Context, msg *EmailMessage) error {
+	if m.Addr == "" {
+		return errors.New("SMTP server address must not be empty")
+	}
+	if m.From == "" {
+		return errors.New("sender address must not be empty")
+	}
+	if msg.To == "" {
+		return errors.New("recipient address must not be empty")
+	}
+	if msg.Subject == "" || msg.Body == "" {
+		return errors.New("message subject and body must not be empty")
+	}
+	from, err := parseHeaderAddress("sender", m.From)
+	if err != nil {
+		return err
+	}
+	to, err := parseHeaderAddress("recipient", msg.To)
+	if err != nil {
+		return err
+	}
+	if !localePattern.MatchString(msg.Locale) {
+		return fmt.Errorf("invalid locale: %q", msg.Locale)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/html; charset=\"utf-8\"\r\n")
+	if msg.Locale != "" {
+		fmt.Fprintf(&b, "Content-Language: %s\r\n", msg.Locale)
+	}
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+
+	send := m.sendMail
+	if send == nil {
+		send = smtp.SendMail
+	}
+	return send(m.Addr, m.Auth, from.Address, []string{to.Address}, b.Bytes())
+}
+
+// localePattern matches the locales that can be written into the Content-Language header.
+var localePattern = regexp.MustCompile("^[A-Za-z0-9_-]*$")
+
+// parseHeaderAddress parses a single email address to be written into a message header. Addresses
+// containing line breaks are rejected, so that they cannot be used to inject additional headers.
+func parseHeaderAddress(kind, s string) (*mail.Address, error) {
+	if strings.ContainsAny(s, "\r\n") {
+		return nil, fmt.Errorf("%s address must not contain line breaks: %q", kind, s)
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s address %q: %v", kind, s, err)
+	}
+	return addr, nil
+}
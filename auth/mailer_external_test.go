@@ -0,0 +1,210 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"firebase.google.com/go/auth"
+	"firebase.google.com/go/auth/authtest"
+)
+
+func TestMailEmailActionLinks(t *testing.T) {
+	s := auth.EchoServer(auth.TestActionLinkResponse, t)
+	defer s.Close()
+
+	fake := &authtest.FakeMailer{}
+	client := s.Client.WithMailer(fake)
+	if err := s.Client.MailPasswordResetLink(context.Background(), auth.TestEmail, nil, ""); err == nil {
+		t.Errorf("WithMailer() modified the original client")
+	}
+
+	cases := []struct {
+		name   string
+		mail   func() error
+		action auth.EmailAction
+	}{
+		{
+			name: "MailEmailVerificationLink",
+			mail: func() error {
+				return client.MailEmailVerificationLink(context.Background(), auth.TestEmail, nil, "fr")
+			},
+			action: auth.EmailVerificationAction,
+		},
+		{
+			name: "MailPasswordResetLink",
+			mail: func() error {
+				return client.MailPasswordResetLink(context.Background(), auth.TestEmail, nil, "fr")
+			},
+			action: auth.PasswordResetAction,
+		},
+		{
+			name: "MailEmailSignInLink",
+			mail: func() error {
+				return client.MailEmailSignInLink(
+					context.Background(), auth.TestEmail, auth.TestActionCodeSettings, "fr")
+			},
+			action: auth.EmailSignInAction,
+		},
+	}
+	for idx, tc := range cases {
+		if err := tc.mail(); err != nil {
+			t.Fatalf("%s() = %v", tc.name, err)
+		}
+
+		msgs := fake.Messages()
+		if len(msgs) != idx+1 {
+			t.Fatalf("%s() sent = %d; want = %d", tc.name, len(msgs), idx+1)
+		}
+		want := &auth.EmailMessage{
+			To:     auth.TestEmail,
+			Action: tc.action,
+			Link:   auth.TestActionLink,
+			Locale: "fr",
+		}
+		if got := msgs[idx]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s() message = %#v; want = %#v", tc.name, got, want)
+		}
+
+		want2 := map[string]interface{}{
+			"requestType":   string(tc.action),
+			"email":         auth.TestEmail,
+			"returnOobLink": true,
+		}
+		if tc.action == auth.EmailSignInAction {
+			for k, v := range auth.TestActionCodeSettingsMap {
+				want2[k] = v
+			}
+		}
+		if err := auth.CheckActionLinkRequest(want2, s); err != nil {
+			t.Errorf("%s() request: %v", tc.name, err)
+		}
+	}
+}
+
+func TestMailEmailActionLinkErrors(t *testing.T) {
+	client := &auth.Client{}
+	if err := client.MailPasswordResetLink(context.Background(), auth.TestEmail, nil, ""); err == nil {
+		t.Errorf("MailPasswordResetLink(no mailer) = nil; want error")
+	}
+
+	fake := &authtest.FakeMailer{}
+	client = client.WithMailer(fake)
+	if err := client.MailPasswordResetLink(context.Background(), "", nil, ""); err == nil {
+		t.Errorf("MailPasswordResetLink('') = nil; want error")
+	}
+	if err := client.MailEmailSignInLink(context.Background(), auth.TestEmail, nil, ""); err == nil {
+		t.Errorf("MailEmailSignInLink(nil) = nil; want error")
+	}
+	if len(fake.Messages()) != 0 {
+		t.Errorf("Messages() = %d; want = 0", len(fake.Messages()))
+	}
+
+	s := auth.EchoServer(auth.TestActionLinkResponse, t)
+	defer s.Close()
+	fake.Err = errors.New("delivery failed")
+	client = s.Client.WithMailer(fake)
+	if err := client.MailPasswordResetLink(context.Background(), auth.TestEmail, nil, ""); err != fake.Err {
+		t.Errorf("MailPasswordResetLink() = %v; want = %v", err, fake.Err)
+	}
+}
+
+func TestTemplateMailer(t *testing.T) {
+	fake := &authtest.FakeMailer{}
+	tm := auth.NewTemplateMailer(fake)
+	templates := []struct {
+		locale  string
+		subject string
+		body    string
+	}{
+		{"", "Reset your password", `<a href="{{.Link}}">Reset</a> for {{.Email}}`},
+		{"fr", "Réinitialisez votre mot de passe", `<a href="{{.Link}}">Réinitialiser</a>`},
+		{"fr-CA", "Réinitialisez votre mot de passe (CA)", `<a href="{{.Link}}">Réinitialiser</a>`},
+	}
+	for _, tmpl := range templates {
+		if err := tm.AddTemplate(auth.PasswordResetAction, tmpl.locale, tmpl.subject, tmpl.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		locale  string
+		subject string
+		body    string
+	}{
+		{"", "Reset your password", `<a href="https://test.link?a=1&amp;b=2">Reset</a> for user@domain.com`},
+		{"de", "Reset your password", `<a href="https://test.link?a=1&amp;b=2">Reset</a> for user@domain.com`},
+		{"fr", "Réinitialisez votre mot de passe", `<a href="https://test.link?a=1&amp;b=2">Réinitialiser</a>`},
+		{"fr-FR", "Réinitialisez votre mot de passe", `<a href="https://test.link?a=1&amp;b=2">Réinitialiser</a>`},
+		{"fr-CA", "Réinitialisez votre mot de passe (CA)", `<a href="https://test.link?a=1&amp;b=2">Réinitialiser</a>`},
+	}
+	for idx, tc := range cases {
+		msg := &auth.EmailMessage{
+			To:     auth.TestEmail,
+			Action: auth.PasswordResetAction,
+			Link:   "https://test.link?a=1&b=2",
+			Locale: tc.locale,
+		}
+		if err := tm.SendEmail(context.Background(), msg); err != nil {
+			t.Fatalf("SendEmail(%q) = %v", tc.locale, err)
+		}
+		if msg.Subject != "" || msg.Body != "" {
+			t.Errorf("SendEmail(%q) modified the input message", tc.locale)
+		}
+
+		got := fake.Messages()[idx]
+		if got.Subject != tc.subject {
+			t.Errorf("SendEmail(%q) Subject = %q; want = %q", tc.locale, got.Subject, tc.subject)
+		}
+		if got.Body != tc.body {
+			t.Errorf("SendEmail(%q) Body = %q; want = %q", tc.locale, got.Body, tc.body)
+		}
+	}
+}
+
+func TestTemplateMailerErrors(t *testing.T) {
+	tm := auth.NewTemplateMailer(&authtest.FakeMailer{})
+	if err := tm.AddTemplate(auth.PasswordResetAction, "", "{{.Link", "body"); err == nil {
+		t.Errorf("AddTemplate(invalid subject) = nil; want error")
+	}
+	if err := tm.AddTemplate(auth.PasswordResetAction, "", "subject", "{{.Link"); err == nil {
+		t.Errorf("AddTemplate(invalid body) = nil; want error")
+	}
+	if err := tm.AddTemplate(auth.PasswordResetAction, "fr", "subject", "{{.Unknown}}"); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &auth.EmailMessage{
+		To:     auth.TestEmail,
+		Action: auth.EmailVerificationAction,
+		Link:   auth.TestActionLink,
+	}
+	if err := tm.SendEmail(context.Background(), msg); err == nil {
+		t.Errorf("SendEmail(no template) = nil; want error")
+	}
+
+	msg = &auth.EmailMessage{
+		To:     auth.TestEmail,
+		Action: auth.PasswordResetAction,
+		Link:   auth.TestActionLink,
+		Locale: "fr",
+	}
+	if err := tm.SendEmail(context.Background(), msg); err == nil {
+		t.Errorf("SendEmail(bad template) = nil; want error")
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"net/smtp"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSMTPMailer(t *testing.T) {
+	var (
+		gotAddr string
+		gotFrom string
+		gotTo   []string
+		gotMsg  string
+	)
+	m := &SMTPMailer{
+		Addr: "smtp.example.com:587",
+		From: "noreply@example.com",
+		sendMail: func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+			gotAddr, gotFrom, gotTo, gotMsg = addr, from, to, string(msg)
+			return nil
+		},
+	}
+
+	msg := &EmailMessage{
+		To:      testEmail,
+		Action:  PasswordResetAction,
+		Link:    testActionLink,
+		Locale:  "fr",
+		Subject: "Réinitialisez votre mot de passe",
+		Body:    "<p>Hello</p>",
+	}
+	if err := m.SendEmail(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if gotAddr != m.Addr {
+		t.Errorf("Addr = %q; want = %q", gotAddr, m.Addr)
+	}
+	if gotFrom != m.From {
+		t.Errorf("From = %q; want = %q", gotFrom, m.From)
+	}
+	if !reflect.DeepEqual(gotTo, []string{testEmail}) {
+		t.Errorf("To = %v; want = %v", gotTo, []string{testEmail})
+	}
+
+	wantLines := []string{
+		"From: <noreply@example.com>\r\n",
+		"To: <user@domain.com>\r\n",
+		"Subject: =?utf-8?q?R=C3=A9initialisez_votre_mot_de_passe?=\r\n",
+		"Content-Type: text/html; charset=\"utf-8\"\r\n",
+		"Content-Language: fr\r\n",
+		"\r\n\r\n<p>Hello</p>",
+	}
+	for _, line := range wantLines {
+		if !strings.Contains(gotMsg, line) {
+			t.Errorf("SendEmail() message = %q; want to contain %q", gotMsg, line)
+		}
+	}
+}
+
+func TestSMTPMailerErrors(t *testing.T) {
+	valid := &EmailMessage{To: testEmail, Subject: "subject", Body: "body"}
+	cases := []struct {
+		name   string
+		mailer *SMTPMailer
+		msg    *EmailMessage
+	}{
+		{"no-addr", &SMTPMailer{From: "noreply@example.com"}, valid},
+		{"no-from", &SMTPMailer{Addr: "smtp.example.com:587"}, valid},
+		{
+			"no-to",
+			&SMTPMailer{Addr: "smtp.example.com:587", From: "noreply@example.com"},
+			&EmailMessage{Subject: "subject", Body: "body"},
+		},
+		{
+			"invalid-from",
+			&SMTPMailer{Addr: "smtp.example.com:587", From: "noreply@example.com\r\nBcc: victim@example.com"},
+			valid,
+		},
+		{
+			"invalid-to",
+			&SMTPMailer{Addr: "smtp.example.com:587", From: "noreply@example.com"},
+			&EmailMessage{To: testEmail + "\nBcc: victim@example.com", Subject: "subject", Body: "body"},
+		},
+		{
+			"malformed-to",
+			&SMTPMailer{Addr: "smtp.example.com:587", From: "noreply@example.com"},
+			&EmailMessage{To: "not an address", Subject: "subject", Body: "body"},
+		},
+		{
+			"invalid-locale",
+			&SMTPMailer{Addr: "smtp.example.com:587", From: "noreply@example.com"},
+			&EmailMessage{To: testEmail, Locale: "fr\r\n\r\n<script>", Subject: "subject", Body: "body"},
+		},
+		{
+			"not-rendered",
+			&SMTPMailer{Addr: "smtp.example.com:587", From: "noreply@example.com"},
+			&EmailMessage{To: testEmail, Link: testActionLink},
+		},
+	}
+	for _, tc := range cases {
+		tc.mailer.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+			t.Errorf("%s; sendMail() called", tc.name)
+			return nil
+		}
+		if err := tc.mailer.SendEmail(context.Background(), tc.msg); err == nil {
+			t.Errorf("%s; SendEmail() = nil; want error", tc.name)
+		}
+	}
+}
@@ -348,8 +348,10 @@ func marshalCustomClaims(claims map[string]interface{}) (string, error) {
 
 const (
 	emailAlreadyExists       = "email-already-exists"
+	expiredActionCode        = "expired-action-code"
 	idTokenRevoked           = "id-token-revoked"
 	insufficientPermission   = "insufficient-permission"
+	invalidActionCode        = "invalid-action-code"
 	invalidDynamicLinkDomain = "invalid-dynamic-link-domain"
 	phoneNumberAlreadyExists = "phone-number-already-exists"
 	projectNotFound          = "project-not-found"
@@ -365,6 +367,11 @@ func IsEmailAlreadyExists(err error) bool {
 	return internal.HasErrorCode(err, emailAlreadyExists)
 }
 
+// IsExpiredActionCode checks if the given error was due to an expired email action code.
+func IsExpiredActionCode(err error) bool {
+	return internal.HasErrorCode(err, expiredActionCode)
+}
+
 // IsIDTokenRevoked checks if the given error was due to a revoked ID token.
 func IsIDTokenRevoked(err error) bool {
 	return internal.HasErrorCode(err, idTokenRevoked)
@@ -375,6 +382,11 @@ func IsInsufficientPermission(err error) bool {
 	return internal.HasErrorCode(err, insufficientPermission)
 }
 
+// IsInvalidActionCode checks if the given error was due to a malformed or already used email action code.
+func IsInvalidActionCode(err error) bool {
+	return internal.HasErrorCode(err, invalidActionCode)
+}
+
 // IsInvalidDynamicLinkDomain checks if the given error was due to an invalid dynamic link domain.
 func IsInvalidDynamicLinkDomain(err error) bool {
 	return internal.HasErrorCode(err, invalidDynamicLinkDomain)
@@ -420,8 +432,10 @@ var serverError = map[string]string{
 	"DUPLICATE_EMAIL":             emailAlreadyExists,
 	"DUPLICATE_LOCAL_ID":          uidAlreadyExists,
 	"EMAIL_EXISTS":                emailAlreadyExists,
+	"EXPIRED_OOB_CODE":            expiredActionCode,
 	"INSUFFICIENT_PERMISSION":     insufficientPermission,
 	"INVALID_DYNAMIC_LINK_DOMAIN": invalidDynamicLinkDomain,
+	"INVALID_OOB_CODE":            invalidActionCode,
 	"PERMISSION_DENIED":           insufficientPermission,
 	"PHONE_NUMBER_EXISTS":         phoneNumberAlreadyExists,
 	"PROJECT_NOT_FOUND":           projectNotFound,
@@ -506,6 +520,7 @@ type userManagementClient struct {
 	projectID  string
 	version    string
 	httpClient *internal.HTTPClient
+	mailer     Mailer
 }
 
 // GetUser gets the user data corresponding to the specified user ID.
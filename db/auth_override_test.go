@@ -104,3 +104,81 @@ func TestAuthOverrideRangeQuery(t *testing.T) {
 		},
 	})
 }
+
+func TestWithAuthOverride(t *testing.T) {
+	mock := &mockServer{Resp: "data"}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	cases := []struct {
+		ao   map[string]interface{}
+		want map[string]string
+	}{
+		{map[string]interface{}{"uid": "user1"}, map[string]string{"auth_variable_override": `{"uid":"user1"}`}},
+		{nil, map[string]string{"auth_variable_override": "null"}},
+		{map[string]interface{}{}, nil},
+	}
+	for _, tc := range cases {
+		mock.Reqs = nil
+		c, err := client.WithAuthOverride(tc.ao)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		if err := c.NewRef("peter").Get(context.Background(), &got); err != nil {
+			t.Fatal(err)
+		}
+		checkOnlyRequest(t, mock.Reqs, &testReq{
+			Method: "GET",
+			Path:   "/peter.json",
+			Query:  tc.want,
+		})
+	}
+	if client.authOverride != "" {
+		t.Errorf("WithAuthOverride() modified the original client: %q", client.authOverride)
+	}
+}
+
+func TestWithAuthOverrideReplacesExisting(t *testing.T) {
+	mock := &mockServer{}
+	srv := mock.Start(aoClient)
+	defer srv.Close()
+
+	c, err := aoClient.WithAuthOverride(map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.NewRef("peter").Set(context.Background(), "data"); err != nil {
+		t.Fatal(err)
+	}
+	checkOnlyRequest(t, mock.Reqs, &testReq{
+		Method: "PUT",
+		Body:   serialize("data"),
+		Path:   "/peter.json",
+		Query:  map[string]string{"print": "silent"},
+	})
+	if aoClient.authOverride != testAuthOverrides {
+		t.Errorf("WithAuthOverride() modified the original client: %q", aoClient.authOverride)
+	}
+}
+
+func TestWithAuthOverrideCache(t *testing.T) {
+	cached, err := client.WithCache(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cached.WithAuthOverride(map[string]interface{}{"uid": "user1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.cache != nil {
+		t.Errorf("WithAuthOverride() shared the cache of the original client")
+	}
+}
+
+func TestWithAuthOverrideError(t *testing.T) {
+	c, err := client.WithAuthOverride(map[string]interface{}{"uid": func() {}})
+	if c != nil || err == nil {
+		t.Errorf("WithAuthOverride() = (%v, %v); want = (nil, error)", c, err)
+	}
+}
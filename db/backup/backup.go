@@ -0,0 +1,231 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backup contains functions for backing up Firebase Realtime Database subtrees to files,
+// and restoring them.
+//
+// A backup is a sequence of records, each holding the value of one database node along with its
+// absolute path. Large subtrees are split into multiple records by listing their child keys, so
+// that no single read exceeds the size limits of the database. Values are read in the export
+// format, so that the priorities of the backed up nodes are restored along with them. Backups are
+// written either as newline-delimited JSON, with one record per line, or as a JSON array of
+// records.
+package backup
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"firebase.google.com/go/db"
+	"google.golang.org/api/iterator"
+)
+
+// priorityKey is the name of the child that holds the priority of a node.
+const priorityKey = ".priority"
+
+// Format is the file format of a backup.
+type Format string
+
+const (
+	// FormatNDJSON writes one JSON record per line.
+	FormatNDJSON Format = "ndjson"
+
+	// FormatJSON writes a single JSON array of records.
+	FormatJSON Format = "json"
+)
+
+// Record is the value of a single database node in a backup.
+type Record struct {
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Stats reports the progress of a backup or a restore.
+type Stats struct {
+	// Records is the number of records processed so far.
+	Records int
+
+	// Bytes is the total size of the values of the records processed so far.
+	Bytes int64
+
+	// Batches is the number of multi-location updates made by Restore() so far. Always 0 for
+	// Backup().
+	Batches int
+}
+
+// BackupOptions specifies how Backup() reads a database subtree.
+type BackupOptions struct {
+	// Format is the file format of the backup. Defaults to FormatNDJSON.
+	Format Format
+
+	// Depth is the number of levels below the backed-up node that are always split into their
+	// children. Each node at that depth is written as a separate record. Nodes that are still too
+	// large to read are split further. Defaults to 0, in which case the whole subtree is written
+	// as a single record if possible.
+	Depth int
+
+	// Progress, if set, is called after each record is written.
+	Progress func(s *Stats)
+}
+
+// Backup writes the subtree rooted at ref to w.
+//
+// Child nodes are listed with Ref.Keys(), and their values are read with Ref.GetExport().
+// Records are written in the order of their paths. A node that is split into several records has
+// its priority written as a separate record, with a path ending in ".priority", after the records
+// of its children. Nothing is written if the subtree is empty.
+func Backup(ctx context.Context, ref *db.Ref, w io.Writer, opts *BackupOptions) (*Stats, error) {
+	b := &backup{
+		ctx:   ctx,
+		bw:    bufio.NewWriter(w),
+		stats: &Stats{},
+	}
+	format := FormatNDJSON
+	if opts != nil {
+		if opts.Depth < 0 {
+			return nil, fmt.Errorf("depth must not be negative: %d", opts.Depth)
+		}
+		if opts.Format != "" {
+			format = opts.Format
+		}
+		b.depth = opts.Depth
+		b.progress = opts.Progress
+	}
+	switch format {
+	case FormatNDJSON:
+	case FormatJSON:
+		b.array = true
+	default:
+		return nil, fmt.Errorf("invalid backup format: %q", format)
+	}
+
+	if b.array {
+		if _, err := b.bw.WriteString("["); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.walk(ref, b.depth); err != nil {
+		return nil, err
+	}
+	if b.array {
+		if _, err := b.bw.WriteString("\n]\n"); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.bw.Flush(); err != nil {
+		return nil, err
+	}
+	return b.stats, nil
+}
+
+type backup struct {
+	ctx      context.Context
+	bw       *bufio.Writer
+	array    bool
+	depth    int
+	progress func(s *Stats)
+	stats    *Stats
+}
+
+// walk backs up the node at ref. Nodes above the configured depth, and nodes that are too large
+// to read at once, are backed up one child at a time.
+func (b *backup) walk(ref *db.Ref, depth int) error {
+	if depth <= 0 {
+		var v json.RawMessage
+		err := ref.GetExport(b.ctx, &v)
+		if err == nil {
+			return b.write(ref.Path, v)
+		}
+		if !isReadTooBig(err) {
+			return err
+		}
+	}
+
+	it := ref.Keys(b.ctx)
+	count := 0
+	for {
+		key, err := it.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return err
+		}
+		count++
+		if err := b.walk(ref.Child(key), depth-1); err != nil {
+			return err
+		}
+	}
+	if count == 0 {
+		// A node without children is a leaf value, or empty.
+		var v json.RawMessage
+		if err := ref.GetExport(b.ctx, &v); err != nil {
+			return err
+		}
+		return b.write(ref.Path, v)
+	}
+
+	// The priority comes last, since the database discards the priorities of empty nodes.
+	priority, err := ref.GetPriority(b.ctx)
+	if err != nil || priority == nil {
+		return err
+	}
+	v, err := json.Marshal(priority)
+	if err != nil {
+		return err
+	}
+	return b.write(priorityPath(ref.Path), v)
+}
+
+func priorityPath(path string) string {
+	return strings.TrimSuffix(path, "/") + "/" + priorityKey
+}
+
+func (b *backup) write(path string, v json.RawMessage) error {
+	if len(v) == 0 || string(v) == "null" {
+		return nil
+	}
+	line, err := json.Marshal(&Record{Path: path, Value: v})
+	if err != nil {
+		return err
+	}
+	if b.array {
+		sep := ",\n"
+		if b.stats.Records == 0 {
+			sep = "\n"
+		}
+		if _, err := b.bw.WriteString(sep); err != nil {
+			return err
+		}
+	} else {
+		line = append(line, '\n')
+	}
+	if _, err := b.bw.Write(line); err != nil {
+		return err
+	}
+	b.stats.Records++
+	b.stats.Bytes += int64(len(v))
+	if b.progress != nil {
+		b.progress(b.stats)
+	}
+	return nil
+}
+
+// isReadTooBig checks if the error was caused by a read exceeding the size limit of the database.
+func isReadTooBig(err error) bool {
+	return strings.Contains(err.Error(), "exceeds the maximum size")
+}
@@ -0,0 +1,410 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"firebase.google.com/go/db"
+	"firebase.google.com/go/db/dbtest"
+)
+
+var testData = map[string]interface{}{
+	"users": map[string]interface{}{
+		"alice": map[string]interface{}{"name": "Alice", "age": 30.0},
+		"bob":   map[string]interface{}{"name": "Bob", "age": 25.0},
+		"carol": "inactive",
+	},
+	"config": map[string]interface{}{"version": 2.0},
+}
+
+func newServer(t *testing.T) (*dbtest.Server, *db.Client) {
+	srv := dbtest.NewServer()
+	client, err := srv.NewClient(context.Background())
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return srv, client
+}
+
+func TestBackup(t *testing.T) {
+	srv, client := newServer(t)
+	defer srv.Close()
+	if err := srv.Set("/", testData); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	stats, err := Backup(context.Background(), client.NewRef("/users"), &buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"path":"/users","value":` + serialize(t, testData["users"]) + "}\n"
+	if buf.String() != want {
+		t.Errorf("Backup() = %q; want = %q", buf.String(), want)
+	}
+	if stats.Records != 1 || stats.Bytes == 0 || stats.Batches != 0 {
+		t.Errorf("Backup() = %+v; want = 1 record", stats)
+	}
+}
+
+func TestBackupDepth(t *testing.T) {
+	srv, client := newServer(t)
+	defer srv.Close()
+	if err := srv.Set("/", testData); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	var progress []int
+	stats, err := Backup(context.Background(), client.NewRef("/"), &buf, &BackupOptions{
+		Depth: 2,
+		Progress: func(s *Stats) {
+			progress = append(progress, s.Records)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPaths := []string{
+		"/config/version",
+		"/users/alice",
+		"/users/bob",
+		"/users/carol",
+	}
+	if got := recordPaths(t, buf.String()); !reflect.DeepEqual(got, wantPaths) {
+		t.Errorf("Backup() paths = %v; want = %v", got, wantPaths)
+	}
+	if stats.Records != len(wantPaths) {
+		t.Errorf("Backup() records = %d; want = %d", stats.Records, len(wantPaths))
+	}
+	if !reflect.DeepEqual(progress, []int{1, 2, 3, 4}) {
+		t.Errorf("Progress = %v; want = [1 2 3 4]", progress)
+	}
+}
+
+func TestBackupReadTooBig(t *testing.T) {
+	srv, client := newServer(t)
+	defer srv.Close()
+	if err := srv.Set("/", testData); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetMaxReadSize(40)
+
+	var buf bytes.Buffer
+	if _, err := Backup(context.Background(), client.NewRef("/"), &buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	wantPaths := []string{
+		"/config",
+		"/users/alice",
+		"/users/bob",
+		"/users/carol",
+	}
+	if got := recordPaths(t, buf.String()); !reflect.DeepEqual(got, wantPaths) {
+		t.Errorf("Backup() paths = %v; want = %v", got, wantPaths)
+	}
+}
+
+func TestBackupEmpty(t *testing.T) {
+	srv, client := newServer(t)
+	defer srv.Close()
+
+	for _, format := range []Format{FormatNDJSON, FormatJSON} {
+		var buf bytes.Buffer
+		stats, err := Backup(context.Background(), client.NewRef("/missing"), &buf, &BackupOptions{
+			Format: format,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Records != 0 {
+			t.Errorf("Backup(%s) records = %d; want = 0", format, stats.Records)
+		}
+		if format == FormatJSON {
+			var recs []*Record
+			if err := json.Unmarshal(buf.Bytes(), &recs); err != nil || len(recs) != 0 {
+				t.Errorf("Backup(%s) = %q; want = empty array", format, buf.String())
+			}
+		} else if buf.Len() != 0 {
+			t.Errorf("Backup(%s) = %q; want = empty", format, buf.String())
+		}
+	}
+}
+
+func TestBackupInvalidOptions(t *testing.T) {
+	srv, client := newServer(t)
+	defer srv.Close()
+
+	cases := []*BackupOptions{
+		{Format: "xml"},
+		{Depth: -1},
+	}
+	for _, tc := range cases {
+		var buf bytes.Buffer
+		if _, err := Backup(context.Background(), client.NewRef("/"), &buf, tc); err == nil {
+			t.Errorf("Backup(%+v) = nil; want error", tc)
+		}
+	}
+	if len(srv.Requests()) != 0 {
+		t.Errorf("Requests = %d; want = 0", len(srv.Requests()))
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []Format{FormatNDJSON, FormatJSON} {
+		src, srcClient := newServer(t)
+		defer src.Close()
+		if err := src.Set("/", testData); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if _, err := Backup(context.Background(), srcClient.NewRef("/"), &buf, &BackupOptions{
+			Format: format,
+			Depth:  2,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		dst, dstClient := newServer(t)
+		defer dst.Close()
+		if err := dst.Set("/other", "kept"); err != nil {
+			t.Fatal(err)
+		}
+		stats, err := Restore(context.Background(), dstClient, &buf, &RestoreOptions{BatchSize: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Records != 4 || stats.Batches != 2 {
+			t.Errorf("Restore(%s) = %+v; want = 4 records in 2 batches", format, stats)
+		}
+
+		want := map[string]interface{}{"other": "kept"}
+		for k, v := range testData {
+			want[k] = v
+		}
+		if got := dst.Get("/"); !reflect.DeepEqual(got, want) {
+			t.Errorf("Restore(%s) = %v; want = %v", format, got, want)
+		}
+	}
+}
+
+func TestRoundTripPriorities(t *testing.T) {
+	src, srcClient := newServer(t)
+	defer src.Close()
+	if err := src.Set("/", map[string]interface{}{
+		"users": map[string]interface{}{
+			".priority": 1.0,
+			"alice":     map[string]interface{}{"name": "Alice", ".priority": "a"},
+			"carol":     map[string]interface{}{".value": "inactive", ".priority": 3.0},
+		},
+		"motd":   map[string]interface{}{".value": "hello", ".priority": 5.0},
+		"config": map[string]interface{}{"version": 2.0},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := Backup(context.Background(), srcClient.NewRef("/"), &buf, &BackupOptions{
+		Depth: 2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	wantPaths := []string{
+		"/config/version",
+		"/motd",
+		"/users/alice",
+		"/users/carol",
+		"/users/.priority",
+	}
+	if got := recordPaths(t, buf.String()); !reflect.DeepEqual(got, wantPaths) {
+		t.Errorf("Backup() paths = %v; want = %v", got, wantPaths)
+	}
+
+	dst, dstClient := newServer(t)
+	defer dst.Close()
+	stats, err := Restore(context.Background(), dstClient, &buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Records != 5 || stats.Batches != 2 {
+		t.Errorf("Restore() = %+v; want = 5 records in 2 batches", stats)
+	}
+	if got, want := dst.Get("/"), src.Get("/"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Restore() = %v; want = %v", got, want)
+	}
+	priorities := map[string]interface{}{
+		"/users":       1.0,
+		"/users/alice": "a",
+		"/users/carol": 3.0,
+		"/motd":        5.0,
+		"/config":      nil,
+	}
+	for path, want := range priorities {
+		got, err := dstClient.NewRef(path).GetPriority(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("GetPriority(%q) = %v; want = %v", path, got, want)
+		}
+	}
+}
+
+func TestRestoreRemap(t *testing.T) {
+	srv, client := newServer(t)
+	defer srv.Close()
+
+	input := strings.Join([]string{
+		`{"path":"/users/alice","value":{"name":"Alice"}}`,
+		`{"path":"/users/bob/name","value":"Bob"}`,
+		`{"path":"/config","value":1}`,
+		`{"path":"/usersx","value":true}`,
+	}, "\n")
+	_, err := Restore(context.Background(), client, strings.NewReader(input), &RestoreOptions{
+		Remap: map[string]string{
+			"/users":     "/archive/users",
+			"/users/bob": "/bob",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"archive": map[string]interface{}{
+			"users": map[string]interface{}{
+				"alice": map[string]interface{}{"name": "Alice"},
+			},
+		},
+		"bob":    map[string]interface{}{"name": "Bob"},
+		"config": 1.0,
+		"usersx": true,
+	}
+	if got := srv.Get("/"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Restore() = %v; want = %v", got, want)
+	}
+}
+
+func TestRestoreOverlap(t *testing.T) {
+	srv, client := newServer(t)
+	defer srv.Close()
+
+	input := strings.Join([]string{
+		`{"path":"/a","value":{"x":1}}`,
+		`{"path":"/a/y","value":2}`,
+		`{"path":"/b","value":3}`,
+	}, "\n")
+	stats, err := Restore(context.Background(), client, strings.NewReader(input), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Batches != 2 {
+		t.Errorf("Restore() batches = %d; want = 2", stats.Batches)
+	}
+	want := map[string]interface{}{
+		"a": map[string]interface{}{"x": 1.0, "y": 2.0},
+		"b": 3.0,
+	}
+	if got := srv.Get("/"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Restore() = %v; want = %v", got, want)
+	}
+}
+
+func TestRestoreRoot(t *testing.T) {
+	srv, client := newServer(t)
+	defer srv.Close()
+	if err := srv.Set("/old", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	input := `{"path":"/","value":{"new":2}}`
+	if _, err := Restore(context.Background(), client, strings.NewReader(input), nil); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"new": 2.0}
+	if got := srv.Get("/"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Restore() = %v; want = %v", got, want)
+	}
+}
+
+func TestRestoreDryRun(t *testing.T) {
+	srv, client := newServer(t)
+	defer srv.Close()
+
+	input := `[{"path":"/a","value":1}, {"path":"/b","value":"two"}]`
+	stats, err := Restore(context.Background(), client, strings.NewReader(input), &RestoreOptions{
+		DryRun: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Records != 2 || stats.Bytes != 6 || stats.Batches != 0 {
+		t.Errorf("Restore() = %+v; want = {2 6 0}", stats)
+	}
+	if len(srv.Requests()) != 0 {
+		t.Errorf("Requests = %d; want = 0", len(srv.Requests()))
+	}
+}
+
+func TestRestoreInvalid(t *testing.T) {
+	srv, client := newServer(t)
+	defer srv.Close()
+
+	cases := []string{
+		`{"path":"/a","value":1`,
+		`{"value":1}`,
+		`{"path":"/a"}`,
+		`[{"path":"/a","value":1}`,
+		`not json`,
+	}
+	for _, tc := range cases {
+		if _, err := Restore(context.Background(), client, strings.NewReader(tc), nil); err == nil {
+			t.Errorf("Restore(%q) = nil; want error", tc)
+		}
+	}
+	if _, err := Restore(context.Background(), client, strings.NewReader(""), &RestoreOptions{
+		BatchSize: -1,
+	}); err == nil {
+		t.Errorf("Restore(BatchSize: -1) = nil; want error")
+	}
+	if len(srv.Requests()) != 0 {
+		t.Errorf("Requests = %d; want = 0", len(srv.Requests()))
+	}
+}
+
+func recordPaths(t *testing.T, s string) []string {
+	var paths []string
+	for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+		var rec Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("invalid record %q: %v", line, err)
+		}
+		paths = append(paths, rec.Path)
+	}
+	return paths
+}
+
+func serialize(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,189 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command dbbackup backs up Firebase Realtime Database subtrees to files, and restores them.
+//
+// Usage:
+//
+//	dbbackup backup -url https://<db>.firebaseio.com -path /users -out users.ndjson
+//	dbbackup restore -url https://<db>.firebaseio.com -in users.ndjson -remap /users=/archive/users
+//
+// Service account credentials are read from the file specified by the -credentials flag, or from
+// Application Default Credentials when the flag is not set.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"firebase.google.com/go"
+	"firebase.google.com/go/db"
+	"firebase.google.com/go/db/backup"
+	"google.golang.org/api/option"
+)
+
+const usage = `Usage:
+  dbbackup backup [flags]
+  dbbackup restore [flags]
+
+Run "dbbackup <command> -h" for the flags of each command.
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dbbackup: ")
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "backup":
+		err = runBackup(os.Args[2:])
+	case "restore":
+		err = runRestore(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	url := fs.String("url", "", "URL of the database (required)")
+	creds := fs.String("credentials", "", "path to a service account JSON file")
+	path := fs.String("path", "/", "path of the subtree to back up")
+	out := fs.String("out", "", "file to write the backup to (default: standard output)")
+	format := fs.String("format", string(backup.FormatNDJSON), "backup format: ndjson or json")
+	depth := fs.Int("depth", 0, "number of levels to always split into separate records")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	client, err := newClient(ctx, *url, *creds)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if *out != "" {
+		if f, err = os.Create(*out); err != nil {
+			return err
+		}
+		w = f
+	}
+
+	stats, err := backup.Backup(ctx, client.NewRef(*path), w, &backup.BackupOptions{
+		Format: backup.Format(*format),
+		Depth:  *depth,
+	})
+	if f != nil {
+		// A failed close may leave the backup file incomplete.
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("backed up %d records (%d bytes)", stats.Records, stats.Bytes)
+	return nil
+}
+
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	url := fs.String("url", "", "URL of the database (required)")
+	creds := fs.String("credentials", "", "path to a service account JSON file")
+	in := fs.String("in", "", "file to read the backup from (default: standard input)")
+	batch := fs.Int("batch", 0, "maximum number of records per update (default 100)")
+	dryRun := fs.Bool("dry-run", false, "validate the backup without writing to the database")
+	remap := remapFlag{}
+	fs.Var(remap, "remap", "restore the paths under `from=to` to a different path (repeatable)")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	client, err := newClient(ctx, *url, *creds)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	stats, err := backup.Restore(ctx, client, r, &backup.RestoreOptions{
+		BatchSize: *batch,
+		Remap:     remap,
+		DryRun:    *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		log.Printf("validated %d records (%d bytes)", stats.Records, stats.Bytes)
+	} else {
+		log.Printf("restored %d records (%d bytes) in %d updates", stats.Records, stats.Bytes, stats.Batches)
+	}
+	return nil
+}
+
+func newClient(ctx context.Context, url, creds string) (*db.Client, error) {
+	if url == "" {
+		return nil, fmt.Errorf("the -url flag is required")
+	}
+	var opts []option.ClientOption
+	if creds != "" {
+		opts = append(opts, option.WithCredentialsFile(creds))
+	}
+	app, err := firebase.NewApp(ctx, &firebase.Config{DatabaseURL: url}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return app.Database(ctx)
+}
+
+// remapFlag collects the from=to pairs of the -remap flag.
+type remapFlag map[string]string
+
+func (m remapFlag) String() string {
+	var pairs []string
+	for from, to := range m {
+		pairs = append(pairs, from+"="+to)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m remapFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return fmt.Errorf("remap must be of the form from=to: %q", s)
+	}
+	m[s[:i]] = s[i+1:]
+	return nil
+}
@@ -0,0 +1,290 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"firebase.google.com/go/db"
+)
+
+const (
+	defaultBatchSize     = 100
+	defaultMaxBatchBytes = 10 << 20
+)
+
+// RestoreOptions specifies how Restore() writes a backup to the database.
+type RestoreOptions struct {
+	// BatchSize is the maximum number of records written by a single multi-location update.
+	// Defaults to 100 when set to 0.
+	BatchSize int
+
+	// MaxBatchBytes is the maximum total size of the values written by a single multi-location
+	// update. Records larger than the limit are written on their own. Defaults to 10 MiB when set
+	// to 0.
+	MaxBatchBytes int
+
+	// Remap maps path prefixes in the backup to the paths they are restored to. For example,
+	// {"/users": "/archive/users"} restores "/users/alice" to "/archive/users/alice". When several
+	// prefixes match a path, the longest one is used. Paths that do not match any prefix are
+	// restored as they are.
+	Remap map[string]string
+
+	// DryRun reads and validates the backup without writing anything to the database.
+	DryRun bool
+
+	// Progress, if set, is called after each batch of records is written.
+	Progress func(s *Stats)
+}
+
+// Restore writes the records of a backup read from r to the database.
+//
+// Both backup formats are accepted. Records are written with multi-location updates made with
+// Ref.Update() on the root of the database, so the value of each restored path is replaced, while
+// the other paths of the database are left unchanged. Records that overlap with a record in the
+// current batch, including the priority of a node written in the current batch, are written in the
+// next batch. If Restore() fails part way through, the records counted in the returned Stats have
+// been written.
+func Restore(ctx context.Context, client *db.Client, r io.Reader, opts *RestoreOptions) (*Stats, error) {
+	rs := &restore{
+		ctx:           ctx,
+		root:          client.NewRef("/"),
+		batchSize:     defaultBatchSize,
+		maxBatchBytes: defaultMaxBatchBytes,
+		stats:         &Stats{},
+	}
+	if opts != nil {
+		if opts.BatchSize < 0 {
+			return nil, fmt.Errorf("batch size must not be negative: %d", opts.BatchSize)
+		} else if opts.MaxBatchBytes < 0 {
+			return nil, fmt.Errorf("max batch bytes must not be negative: %d", opts.MaxBatchBytes)
+		}
+		if opts.BatchSize > 0 {
+			rs.batchSize = opts.BatchSize
+		}
+		if opts.MaxBatchBytes > 0 {
+			rs.maxBatchBytes = opts.MaxBatchBytes
+		}
+		for from, to := range opts.Remap {
+			rs.remap = append(rs.remap, remapping{from: parsePath(from), to: parsePath(to)})
+		}
+		rs.dryRun = opts.DryRun
+		rs.progress = opts.Progress
+	}
+
+	rr, err := newRecordReader(r)
+	if err != nil {
+		return rs.stats, err
+	}
+	for {
+		rec, err := rr.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return rs.stats, err
+		}
+		if err := rs.add(rec); err != nil {
+			return rs.stats, err
+		}
+	}
+	return rs.stats, rs.flush()
+}
+
+type restore struct {
+	ctx           context.Context
+	root          *db.Ref
+	batchSize     int
+	maxBatchBytes int
+	remap         []remapping
+	dryRun        bool
+	progress      func(s *Stats)
+	stats         *Stats
+
+	batch      map[string]interface{}
+	batchBytes int
+}
+
+type remapping struct {
+	from, to []string
+}
+
+func (rs *restore) add(rec *Record) error {
+	if rec.Path == "" || len(rec.Value) == 0 {
+		return fmt.Errorf("invalid backup record: %v", rec)
+	}
+	segs := rs.remapPath(parsePath(rec.Path))
+	if len(segs) == 0 {
+		// The root of the database cannot be written with a multi-location update.
+		if err := rs.flush(); err != nil {
+			return err
+		}
+		return rs.write(func() error {
+			return rs.root.Set(rs.ctx, rec.Value)
+		}, 1, len(rec.Value))
+	}
+
+	path := strings.Join(segs, "/")
+	if rs.overlaps(path) || len(rs.batch) == rs.batchSize ||
+		(len(rs.batch) > 0 && rs.batchBytes+len(rec.Value) > rs.maxBatchBytes) {
+		if err := rs.flush(); err != nil {
+			return err
+		}
+	}
+	if rs.batch == nil {
+		rs.batch = make(map[string]interface{})
+	}
+	rs.batch[path] = rec.Value
+	rs.batchBytes += len(rec.Value)
+	return nil
+}
+
+func (rs *restore) flush() error {
+	if len(rs.batch) == 0 {
+		return nil
+	}
+	batch, size := rs.batch, rs.batchBytes
+	rs.batch, rs.batchBytes = nil, 0
+	return rs.write(func() error {
+		return rs.root.Update(rs.ctx, batch)
+	}, len(batch), size)
+}
+
+func (rs *restore) write(fn func() error, records, size int) error {
+	if !rs.dryRun {
+		if err := fn(); err != nil {
+			return err
+		}
+		rs.stats.Batches++
+	}
+	rs.stats.Records += records
+	rs.stats.Bytes += int64(size)
+	if rs.progress != nil {
+		rs.progress(rs.stats)
+	}
+	return nil
+}
+
+// overlaps checks if the given path is equal to, an ancestor of or a descendant of a path in the
+// current batch. The priority of a node overlaps with the node itself.
+func (rs *restore) overlaps(path string) bool {
+	segs := nodeOf(parsePath(path))
+	for p := range rs.batch {
+		other := nodeOf(parsePath(p))
+		if hasPrefix(segs, other) || hasPrefix(other, segs) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeOf returns the path of the node that the given path refers to. Paths ending in ".priority"
+// refer to the node holding the priority.
+func nodeOf(segs []string) []string {
+	if n := len(segs); n > 0 && segs[n-1] == priorityKey {
+		return segs[:n-1]
+	}
+	return segs
+}
+
+func (rs *restore) remapPath(segs []string) []string {
+	var match *remapping
+	for i, m := range rs.remap {
+		if hasPrefix(segs, m.from) && (match == nil || len(m.from) > len(match.from)) {
+			match = &rs.remap[i]
+		}
+	}
+	if match == nil {
+		return segs
+	}
+	return append(append([]string{}, match.to...), segs[len(match.from):]...)
+}
+
+// recordReader reads records from a backup in either format.
+type recordReader struct {
+	dec   *json.Decoder
+	array bool
+}
+
+func newRecordReader(r io.Reader) (*recordReader, error) {
+	br := bufio.NewReader(r)
+	var first byte
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return &recordReader{dec: json.NewDecoder(br)}, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b)) {
+			first = b
+			break
+		}
+	}
+	if err := br.UnreadByte(); err != nil {
+		return nil, err
+	}
+
+	rr := &recordReader{dec: json.NewDecoder(br), array: first == '['}
+	if rr.array {
+		if _, err := rr.dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+	return rr, nil
+}
+
+// next returns the next record, or io.EOF if there are no more records.
+func (rr *recordReader) next() (*Record, error) {
+	if rr.array && !rr.dec.More() {
+		if _, err := rr.dec.Token(); err != nil {
+			return nil, fmt.Errorf("invalid backup: %v", err)
+		}
+		return nil, io.EOF
+	}
+	var rec Record
+	if err := rr.dec.Decode(&rec); err == io.EOF && !rr.array {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("invalid backup record: %v", err)
+	}
+	return &rec, nil
+}
+
+func hasPrefix(segs, prefix []string) bool {
+	if len(prefix) > len(segs) {
+		return false
+	}
+	for i, s := range prefix {
+		if segs[i] != s {
+			return false
+		}
+	}
+	return true
+}
+
+func parsePath(path string) []string {
+	var segs []string
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segs = append(segs, s)
+		}
+	}
+	return segs
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"firebase.google.com/go/internal"
+)
+
+const permissionDenied = "permission-denied"
+
+// WriteBatch collects write operations on arbitrary database locations, and commits them
+// atomically as a single multi-location update.
+//
+// Either all the operations in a WriteBatch are applied, or none of them are. Operations may not
+// target overlapping locations: no location in a WriteBatch may be equal to, or nested within,
+// another location of the same WriteBatch. Errors in the operations are reported by Commit().
+//
+// A WriteBatch is not safe for concurrent use.
+type WriteBatch struct {
+	client *Client
+	paths  []string
+	values map[string]interface{}
+	err    error
+}
+
+// Batch returns a new WriteBatch.
+func (c *Client) Batch() *WriteBatch {
+	return &WriteBatch{
+		client: c,
+		values: make(map[string]interface{}),
+	}
+}
+
+// Set adds an operation that stores the value v at the given absolute path.
+func (b *WriteBatch) Set(path string, v interface{}) *WriteBatch {
+	b.add(path, v)
+	return b
+}
+
+// Update adds operations that set each of the specified child keys of the given absolute path to
+// the provided values. Similar to Ref.Update(), child keys may refer to nested locations.
+func (b *WriteBatch) Update(path string, v map[string]interface{}) *WriteBatch {
+	if len(v) == 0 {
+		b.setErr(fmt.Errorf("value argument must be a non-empty map: %q", path))
+		return b
+	}
+	for k, val := range v {
+		if len(parsePath(k)) == 0 {
+			b.setErr(fmt.Errorf("invalid child key in update: %q", k))
+			return b
+		}
+		b.add(fmt.Sprintf("%s/%s", path, k), val)
+	}
+	return b
+}
+
+// Delete adds an operation that removes the node at the given absolute path.
+func (b *WriteBatch) Delete(path string) *WriteBatch {
+	b.add(path, nil)
+	return b
+}
+
+// Commit applies all the operations in the WriteBatch atomically.
+//
+// Commit returns an error if the WriteBatch is empty, or if any of its operations are invalid. If
+// the operations are rejected by the security rules of the database, the returned error can be
+// checked with IsPermissionDenied().
+func (b *WriteBatch) Commit(ctx context.Context) error {
+	if b.err != nil {
+		return b.err
+	}
+	if len(b.values) == 0 {
+		return fmt.Errorf("batch must contain at least one operation")
+	}
+
+	resp, err := b.client.send(
+		ctx, "PATCH", "/", b.client.newEntity(b.values), internal.WithQueryParam("print", "silent"))
+	if err != nil {
+		return err
+	}
+	err = resp.CheckStatus(http.StatusNoContent)
+	if err != nil && resp.Status == http.StatusUnauthorized {
+		return internal.Error(permissionDenied, err.Error())
+	}
+	return err
+}
+
+// IsPermissionDenied checks if the given error was caused by a write being rejected by the
+// security rules of the database.
+func IsPermissionDenied(err error) bool {
+	return internal.HasErrorCode(err, permissionDenied)
+}
+
+func (b *WriteBatch) add(path string, v interface{}) {
+	if b.err != nil {
+		return
+	}
+	segs := parsePath(path)
+	if len(segs) == 0 {
+		b.setErr(fmt.Errorf("cannot write to the root of the database in a batch"))
+		return
+	}
+	key := strings.Join(segs, "/")
+	if strings.ContainsAny(key, invalidChars) {
+		b.setErr(fmt.Errorf("invalid path with illegal characters: %q", path))
+		return
+	}
+	if _, ok := b.values[key]; ok {
+		b.setErr(fmt.Errorf("path specified multiple times in batch: %q", key))
+		return
+	}
+	for i := 1; i < len(segs); i++ {
+		parent := strings.Join(segs[:i], "/")
+		if _, ok := b.values[parent]; ok {
+			b.setErr(fmt.Errorf("path %q overlaps with path %q in batch", key, parent))
+			return
+		}
+	}
+	prefix := key + "/"
+	for _, p := range b.paths {
+		if strings.HasPrefix(p, prefix) {
+			b.setErr(fmt.Errorf("path %q overlaps with path %q in batch", key, p))
+			return
+		}
+	}
+
+	b.paths = append(b.paths, key)
+	b.values[key] = v
+}
+
+func (b *WriteBatch) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
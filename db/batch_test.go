@@ -0,0 +1,139 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestBatchCommit(t *testing.T) {
+	mock := &mockServer{}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	err := client.Batch().
+		Set("/users/alice", &person{"Alice", 30}).
+		Update("users/bob", map[string]interface{}{"age": 20, "address/city": "London"}).
+		Delete("/posts/p1/").
+		Set("posts/p2/updated", ServerTimestamp).
+		Commit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkOnlyRequest(t, mock.Reqs, &testReq{
+		Method: "PATCH",
+		Path:   "/.json",
+		Body: serialize(map[string]interface{}{
+			"users/alice":            &person{"Alice", 30},
+			"users/bob/age":          20,
+			"users/bob/address/city": "London",
+			"posts/p1":               nil,
+			"posts/p2/updated":       ServerTimestamp,
+		}),
+		Query: map[string]string{"print": "silent"},
+	})
+}
+
+func TestBatchCommitWithAuthOverride(t *testing.T) {
+	mock := &mockServer{}
+	srv := mock.Start(aoClient)
+	defer srv.Close()
+
+	if err := aoClient.Batch().Delete("users/alice").Commit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	checkOnlyRequest(t, mock.Reqs, &testReq{
+		Method: "PATCH",
+		Path:   "/.json",
+		Body:   serialize(map[string]interface{}{"users/alice": nil}),
+		Query:  map[string]string{"print": "silent", "auth_variable_override": testAuthOverrides},
+	})
+}
+
+func TestInvalidBatch(t *testing.T) {
+	mock := &mockServer{}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	cases := []struct {
+		name  string
+		batch *WriteBatch
+	}{
+		{"Empty", client.Batch()},
+		{"Root", client.Batch().Set("/", 1)},
+		{"IllegalChars", client.Batch().Set("users/a.b", 1)},
+		{"IllegalKey", client.Batch().Update("users", map[string]interface{}{"a$b": 1})},
+		{"EmptyKey", client.Batch().Update("users", map[string]interface{}{"/": 1})},
+		{"EmptyUpdate", client.Batch().Update("users", nil)},
+		{"Duplicate", client.Batch().Set("users/alice", 1).Delete("/users/alice/")},
+		{"Ancestor", client.Batch().Set("users/alice/age", 1).Set("users", 2)},
+		{"Descendant", client.Batch().Delete("users").Set("users/alice/age", 1)},
+		{
+			"UpdateOverlap",
+			client.Batch().Update("users", map[string]interface{}{"alice": 1, "alice/age": 2}),
+		},
+	}
+	for _, tc := range cases {
+		if err := tc.batch.Commit(context.Background()); err == nil {
+			t.Errorf("%s; Commit() = nil; want error", tc.name)
+		}
+	}
+	if len(mock.Reqs) != 0 {
+		t.Errorf("Requests = %d; want = 0", len(mock.Reqs))
+	}
+}
+
+func TestBatchSiblingPaths(t *testing.T) {
+	mock := &mockServer{}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	err := client.Batch().
+		Set("users/alice", 1).
+		Set("users/alice2", 2).
+		Set("users/alic", 3).
+		Commit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mock.Reqs) != 1 {
+		t.Errorf("Requests = %d; want = 1", len(mock.Reqs))
+	}
+}
+
+func TestBatchPermissionDenied(t *testing.T) {
+	mock := &mockServer{
+		Resp:   map[string]string{"error": "Permission denied"},
+		Status: http.StatusUnauthorized,
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	err := client.Batch().Set("users/alice", 1).Commit(context.Background())
+	want := "http error status: 401; reason: Permission denied"
+	if err == nil || err.Error() != want || !IsPermissionDenied(err) {
+		t.Errorf("Commit() = %v; want = %q", err, want)
+	}
+
+	mock.Status = http.StatusBadRequest
+	mock.Resp = map[string]string{"error": "Invalid data"}
+	err = client.Batch().Set("users/alice", 1).Commit(context.Background())
+	if err == nil || IsPermissionDenied(err) {
+		t.Errorf("Commit() = %v; want = non permission error", err)
+	}
+}
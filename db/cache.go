@@ -0,0 +1,239 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"firebase.google.com/go/internal"
+)
+
+// CacheOptions configures the in-memory cache enabled by Client.WithCache().
+type CacheOptions struct {
+	// TTL is the duration for which a cached value is served without contacting the database. Once
+	// the TTL has passed, the value is revalidated with a conditional request using its ETag. A
+	// zero TTL revalidates the value on every read.
+	TTL time.Duration
+
+	// PathTTLs overrides the TTL for the nodes at the given paths and their descendants. When
+	// several paths match a node, the longest one is used.
+	PathTTLs map[string]time.Duration
+
+	// ServeStaleOnError causes cached values to be returned when the database cannot be reached,
+	// regardless of their age.
+	ServeStaleOnError bool
+}
+
+// CacheStats contains the statistics of the in-memory cache of a Client.
+type CacheStats struct {
+	// Hits is the number of reads served from memory without contacting the database.
+	Hits int64
+
+	// Misses is the number of reads of values that were not cached.
+	Misses int64
+
+	// Revalidations is the number of reads where the database confirmed that a cached value was
+	// unchanged.
+	Revalidations int64
+
+	// StaleHits is the number of reads served from memory because the database could not be
+	// reached.
+	StaleHits int64
+
+	// Entries is the number of values currently in the cache.
+	Entries int
+}
+
+// WithCache returns a copy of this Client that serves Ref.Get() calls from an in-memory cache.
+//
+// Values are cached by path, along with their ETags. A cached value is returned without contacting
+// the database until its TTL expires, after which it is revalidated with a conditional request
+// similar to Ref.GetIfChanged(), and only downloaded again if it has changed. Writes made through
+// the returned Client evict the affected paths from the cache. Writes made by other clients are
+// not visible until the TTL of the cached value expires.
+//
+// Only Ref.Get() reads are cached. Queries, shallow reads and the other read methods always
+// contact the database. Options may be nil, in which case every read is revalidated.
+func (c *Client) WithCache(opts *CacheOptions) (*Client, error) {
+	cache := &valueCache{
+		entries: make(map[string]*cacheEntry),
+		now:     time.Now,
+	}
+	if opts != nil {
+		if opts.TTL < 0 {
+			return nil, fmt.Errorf("cache ttl must not be negative: %v", opts.TTL)
+		}
+		cache.ttl = opts.TTL
+		cache.serveStale = opts.ServeStaleOnError
+		for p, ttl := range opts.PathTTLs {
+			if ttl < 0 {
+				return nil, fmt.Errorf("cache ttl for %q must not be negative: %v", p, ttl)
+			}
+			cache.pathTTLs = append(cache.pathTTLs, pathTTL{segs: parsePath(p), ttl: ttl})
+		}
+	}
+	cp := *c
+	cp.cache = cache
+	return &cp, nil
+}
+
+// CacheStats returns the current statistics of the in-memory cache. Returns zero statistics if
+// the cache is not enabled.
+func (c *Client) CacheStats() CacheStats {
+	if c.cache == nil {
+		return CacheStats{}
+	}
+	return c.cache.stats()
+}
+
+// ClearCache removes all the values from the in-memory cache.
+func (c *Client) ClearCache() {
+	if c.cache != nil {
+		c.cache.invalidate("/")
+	}
+}
+
+type valueCache struct {
+	ttl        time.Duration
+	pathTTLs   []pathTTL
+	serveStale bool
+	now        func() time.Time
+
+	mu            sync.Mutex
+	entries       map[string]*cacheEntry
+	generation    int64
+	hits          int64
+	misses        int64
+	revalidations int64
+	staleHits     int64
+}
+
+type pathTTL struct {
+	segs []string
+	ttl  time.Duration
+}
+
+type cacheEntry struct {
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// get reads the value at the given Ref through the cache, and returns the raw value.
+func (vc *valueCache) get(ctx context.Context, r *Ref) ([]byte, error) {
+	vc.mu.Lock()
+	entry := vc.entries[r.Path]
+	if entry != nil && vc.now().Before(entry.expires) {
+		vc.hits++
+		vc.mu.Unlock()
+		return entry.body, nil
+	}
+	gen := vc.generation
+	vc.mu.Unlock()
+
+	opts := []internal.HTTPOption{internal.WithHeader("X-Firebase-ETag", "true")}
+	if entry != nil {
+		opts = append(opts, internal.WithHeader("If-None-Match", entry.etag))
+	}
+	resp, err := r.send(ctx, "GET", opts...)
+	if err != nil {
+		if entry != nil && vc.serveStale && ctx.Err() == nil {
+			vc.mu.Lock()
+			vc.staleHits++
+			vc.mu.Unlock()
+			return entry.body, nil
+		}
+		return nil, err
+	}
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	if entry != nil && resp.Status == http.StatusNotModified {
+		vc.revalidations++
+		if gen == vc.generation {
+			vc.put(r, entry.body, entry.etag)
+		}
+		return entry.body, nil
+	}
+	if err := resp.CheckStatus(http.StatusOK); err != nil {
+		return nil, err
+	}
+	vc.misses++
+	if gen == vc.generation {
+		vc.put(r, resp.Body, resp.Header.Get("ETag"))
+	}
+	return resp.Body, nil
+}
+
+// put stores a value in the cache. Must be called with the lock held.
+func (vc *valueCache) put(r *Ref, body []byte, etag string) {
+	vc.entries[r.Path] = &cacheEntry{
+		body:    body,
+		etag:    etag,
+		expires: vc.now().Add(vc.ttlFor(r.segs)),
+	}
+}
+
+func (vc *valueCache) ttlFor(segs []string) time.Duration {
+	ttl := vc.ttl
+	longest := -1
+	for _, p := range vc.pathTTLs {
+		if len(p.segs) > longest && hasPathPrefix(segs, p.segs) {
+			ttl = p.ttl
+			longest = len(p.segs)
+		}
+	}
+	return ttl
+}
+
+// invalidate removes the cached values affected by a write to the given path. These are the values
+// of the path itself, its ancestors and its descendants. Reads that are in progress at the time of
+// the write do not store their results in the cache.
+func (vc *valueCache) invalidate(path string) {
+	segs := parsePath(path)
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	vc.generation++
+	for p := range vc.entries {
+		ps := parsePath(p)
+		if hasPathPrefix(ps, segs) || hasPathPrefix(segs, ps) {
+			delete(vc.entries, p)
+		}
+	}
+}
+
+func (vc *valueCache) stats() CacheStats {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	return CacheStats{
+		Hits:          vc.hits,
+		Misses:        vc.misses,
+		Revalidations: vc.revalidations,
+		StaleHits:     vc.staleHits,
+		Entries:       len(vc.entries),
+	}
+}
+
+func hasPathPrefix(segs, prefix []string) bool {
+	if len(prefix) > len(segs) {
+		return false
+	}
+	return strings.Join(segs[:len(prefix)], "/") == strings.Join(prefix, "/")
+}
@@ -0,0 +1,259 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// etagServer is a mock database server that serves a single value with an ETag, and responds to
+// conditional requests.
+type etagServer struct {
+	value string
+	etag  string
+	reqs  []*http.Request
+}
+
+func (s *etagServer) Start(c *Client) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.reqs = append(s.reqs, r)
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("ETag", s.etag)
+		if r.Header.Get("If-None-Match") == s.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(s.value))
+	}))
+	c.url = srv.URL
+	return srv
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newCachedClient(t *testing.T, opts *CacheOptions) (*Client, *fakeClock) {
+	c, err := client.WithCache(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{now: time.Unix(1546300800, 0)}
+	c.cache.now = clock.Now
+	return c, clock
+}
+
+func TestCacheGet(t *testing.T) {
+	mock := &etagServer{value: `"v1"`, etag: "etag1"}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	c, clock := newCachedClient(t, &CacheOptions{TTL: time.Minute})
+	ref := c.NewRef("peter")
+	get := func(want string) {
+		var got string
+		if err := ref.Get(context.Background(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Get() = %q; want = %q", got, want)
+		}
+	}
+
+	get("v1")
+	get("v1")
+	if len(mock.reqs) != 1 {
+		t.Errorf("Get() requests = %d; want = 1", len(mock.reqs))
+	}
+	if h := mock.reqs[0].Header.Get("X-Firebase-ETag"); h != "true" {
+		t.Errorf("X-Firebase-ETag = %q; want = %q", h, "true")
+	}
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	get("v1")
+	if len(mock.reqs) != 2 || mock.reqs[1].Header.Get("If-None-Match") != "etag1" {
+		t.Errorf("Get() did not revalidate the expired value")
+	}
+
+	mock.value, mock.etag = `"v2"`, "etag2"
+	get("v1")
+	clock.now = clock.now.Add(2 * time.Minute)
+	get("v2")
+	if len(mock.reqs) != 3 {
+		t.Errorf("Get() requests = %d; want = 3", len(mock.reqs))
+	}
+
+	want := CacheStats{Hits: 2, Misses: 2, Revalidations: 1, Entries: 1}
+	if stats := c.CacheStats(); stats != want {
+		t.Errorf("CacheStats() = %#v; want = %#v", stats, want)
+	}
+	if stats := client.CacheStats(); stats != (CacheStats{}) {
+		t.Errorf("CacheStats() = %#v; want = %#v", stats, CacheStats{})
+	}
+}
+
+func TestCachePathTTLs(t *testing.T) {
+	mock := &etagServer{value: `"v1"`, etag: "etag1"}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	c, clock := newCachedClient(t, &CacheOptions{
+		TTL: time.Hour,
+		PathTTLs: map[string]time.Duration{
+			"config":       time.Minute,
+			"config/flags": 0,
+		},
+	})
+	for _, p := range []string{"users/peter", "config/limits", "config/flags/beta"} {
+		var v string
+		if err := c.NewRef(p).Get(context.Background(), &v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.now = clock.now.Add(30 * time.Second)
+
+	cases := []struct {
+		path string
+		want time.Duration
+	}{
+		{"users/peter", time.Hour},
+		{"config/limits", time.Minute},
+		{"config/flags/beta", 0},
+	}
+	for _, tc := range cases {
+		entry := c.cache.entries["/"+tc.path]
+		if got := entry.expires.Sub(clock.now.Add(-30 * time.Second)); got != tc.want {
+			t.Errorf("TTL(%q) = %v; want = %v", tc.path, got, tc.want)
+		}
+	}
+
+	var v string
+	if err := c.NewRef("config/flags/beta").Get(context.Background(), &v); err != nil {
+		t.Fatal(err)
+	}
+	if len(mock.reqs) != 4 {
+		t.Errorf("Get() requests = %d; want = 4", len(mock.reqs))
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	mock := &etagServer{value: `"v1"`, etag: "etag1"}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	c, _ := newCachedClient(t, &CacheOptions{TTL: time.Hour})
+	for _, p := range []string{"users", "users/peter", "users/peter/name", "users/mary", "config"} {
+		var v string
+		if err := c.NewRef(p).Get(context.Background(), &v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.NewRef("users/peter").Set(context.Background(), "v2"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/users", "/users/peter", "/users/peter/name"} {
+		if _, ok := c.cache.entries[p]; ok {
+			t.Errorf("Set() did not invalidate %q", p)
+		}
+	}
+	for _, p := range []string{"/users/mary", "/config"} {
+		if _, ok := c.cache.entries[p]; !ok {
+			t.Errorf("Set() invalidated %q", p)
+		}
+	}
+
+	if err := c.Batch().Delete("config").Commit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.CacheStats(); stats.Entries != 0 {
+		t.Errorf("CacheStats().Entries = %d; want = 0", stats.Entries)
+	}
+
+	var v string
+	if err := c.NewRef("config").Get(context.Background(), &v); err != nil {
+		t.Fatal(err)
+	}
+	c.ClearCache()
+	if stats := c.CacheStats(); stats.Entries != 0 {
+		t.Errorf("CacheStats().Entries = %d; want = 0", stats.Entries)
+	}
+}
+
+func TestCacheServeStale(t *testing.T) {
+	mock := &etagServer{value: `"v1"`, etag: "etag1"}
+	srv := mock.Start(client)
+
+	c, clock := newCachedClient(t, &CacheOptions{ServeStaleOnError: true})
+	ref := c.NewRef("peter")
+	var got string
+	if err := ref.Get(context.Background(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Close()
+	clock.now = clock.now.Add(time.Hour)
+	got = ""
+	if err := ref.Get(context.Background(), &got); err != nil || got != "v1" {
+		t.Errorf("Get() = (%q, %v); want = (%q, nil)", got, err, "v1")
+	}
+	if stats := c.CacheStats(); stats.StaleHits != 1 {
+		t.Errorf("CacheStats().StaleHits = %d; want = 1", stats.StaleHits)
+	}
+
+	if err := c.NewRef("other").Get(context.Background(), &got); err == nil {
+		t.Errorf("Get() = nil; want error")
+	}
+}
+
+func TestCacheError(t *testing.T) {
+	mock := &mockServer{
+		Resp:   map[string]string{"error": "test error"},
+		Status: http.StatusUnauthorized,
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	c, _ := newCachedClient(t, nil)
+	var got string
+	want := "http error status: 401; reason: test error"
+	if err := c.NewRef("peter").Get(context.Background(), &got); err == nil || err.Error() != want {
+		t.Errorf("Get() = %v; want = %q", err, want)
+	}
+	if stats := c.CacheStats(); stats != (CacheStats{}) {
+		t.Errorf("CacheStats() = %#v; want = %#v", stats, CacheStats{})
+	}
+
+	invalid := []*CacheOptions{
+		{TTL: -1},
+		{PathTTLs: map[string]time.Duration{"foo": -1}},
+	}
+	for _, opts := range invalid {
+		if c, err := client.WithCache(opts); c != nil || err == nil {
+			t.Errorf("WithCache(%v) = (%v, %v); want = (nil, error)", opts, c, err)
+		}
+	}
+}
@@ -0,0 +1,647 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Codec serializes the values written to the database, and deserializes the values read from it.
+//
+// By default, the Client uses the encoding/json package to serialize and deserialize values. A
+// different Codec, such as FirebaseCodec, can be configured by calling Client.WithCodec().
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// WithCodec returns a copy of this Client that uses the given Codec to serialize and deserialize
+// database values. The returned Client shares all other state with the original Client.
+func (c *Client) WithCodec(codec Codec) *Client {
+	cp := *c
+	cp.codec = codec
+	return &cp
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// FirebaseCodec is a Codec that maps Go values to database values using `firebase` struct tags.
+//
+// Struct fields are mapped to child nodes named after the fields. The name can be changed with a
+// tag of the form `firebase:"name"`, and fields with a `firebase:"-"` tag are ignored. The
+// omitempty option (`firebase:"name,omitempty"`) omits fields with empty values from the written
+// data, and other options are ignored. Embedded structs and struct pointers without a tag are
+// flattened into the enclosing struct.
+//
+// time.Time values are stored as the number of milliseconds since the epoch, the same format used
+// by ServerTimestamp. The zero time.Time is stored as null, which leaves the node empty, and an
+// empty node is decoded as the zero time.Time. Server values such as ServerTimestamp and
+// Increment() can be used anywhere in written values. Values that implement json.Marshaler or json.Unmarshaler are handled by the
+// encoding/json package.
+//
+// Database nodes can be decoded into slices and arrays. Nodes whose keys are all non-negative
+// integers, which the database may return as objects instead of arrays when the keys are sparse,
+// are decoded by index when at least half of the indices are present, and in the order of their
+// indices otherwise. Other nodes, such as lists of child nodes created by Push(), are decoded in
+// the order of their keys.
+type FirebaseCodec struct{}
+
+// Marshal serializes v into JSON.
+func (FirebaseCodec) Marshal(v interface{}) ([]byte, error) {
+	tree, err := toTree(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tree)
+}
+
+// Unmarshal deserializes the JSON data into the value pointed to by v.
+func (FirebaseCodec) Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("value must be a non-nil pointer: %T", v)
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var tree interface{}
+	if err := d.Decode(&tree); err != nil {
+		return err
+	}
+	return fromTree(tree, rv.Elem())
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	marshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// toTree converts a Go value into a tree of values that can be serialized by the encoding/json
+// package.
+func toTree(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return nil, nil
+		}
+		return t.Unix()*1000 + int64(t.Nanosecond()/int(time.Millisecond)), nil
+	}
+	if v.Kind() == reflect.Ptr && v.Type().Elem() == timeType {
+		if v.IsNil() {
+			return nil, nil
+		}
+		return toTree(v.Elem())
+	}
+	if v.Type().Implements(marshalerType) {
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			return nil, nil
+		}
+		return v.Interface(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return toTree(v.Elem())
+	case reflect.Struct:
+		m := make(map[string]interface{})
+		if err := structToTree(v, m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		m := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			key, err := mapKeyString(k)
+			if err != nil {
+				return nil, err
+			}
+			if m[key], err = toTree(v.MapIndex(k)); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// Byte slices are encoded as base64 strings, just like in the encoding/json package.
+			return v.Interface(), nil
+		}
+		l := make([]interface{}, v.Len())
+		for i := range l {
+			var err error
+			if l[i], err = toTree(v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return l, nil
+	case reflect.Func, reflect.Chan, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return nil, fmt.Errorf("unsupported type: %v", v.Type())
+	}
+	return v.Interface(), nil
+}
+
+func structToTree(v reflect.Value, m map[string]interface{}) error {
+	for _, f := range structFields(v.Type()) {
+		fv := v.FieldByIndex(f.index)
+		if f.embedded {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if err := structToTree(fv, m); err != nil {
+				return err
+			}
+			continue
+		}
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		val, err := toTree(fv)
+		if err != nil {
+			return err
+		}
+		m[f.name] = val
+	}
+	return nil
+}
+
+// fromTree stores a deserialized JSON value in v.
+func fromTree(data interface{}, v reflect.Value) error {
+	if v.Kind() != reflect.Ptr && v.Type() != timeType && v.CanAddr() &&
+		v.Addr().Type().Implements(unmarshalerType) {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(b)
+	}
+	if data == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Type() == timeType {
+		return timeFromTree(data, v)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return fromTree(data, v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return fmt.Errorf("cannot decode into non-empty interface: %v", v.Type())
+		}
+		v.Set(reflect.ValueOf(normalizeNumbers(data)))
+		return nil
+	case reflect.Struct:
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return typeError(data, v)
+		}
+		return structFromTree(m, v)
+	case reflect.Map:
+		return mapFromTree(data, v)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if s, ok := data.(string); ok {
+				return jsonFromTree(s, v)
+			}
+		}
+		l, err := listFromTree(data, v, -1)
+		if err != nil {
+			return err
+		}
+		s := reflect.MakeSlice(v.Type(), len(l), len(l))
+		for i, item := range l {
+			if err := fromTree(item, s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	case reflect.Array:
+		l, err := listFromTree(data, v, v.Len())
+		if err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			var item interface{}
+			if i < len(l) {
+				item = l[i]
+			}
+			if err := fromTree(item, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Bool:
+		b, ok := data.(bool)
+		if !ok {
+			return typeError(data, v)
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.String:
+		s, ok := data.(string)
+		if !ok {
+			return typeError(data, v)
+		}
+		v.SetString(s)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := data.(json.Number)
+		if !ok {
+			return typeError(data, v)
+		}
+		i, err := strconv.ParseInt(string(n), 10, 64)
+		if err != nil || v.OverflowInt(i) {
+			return typeError(data, v)
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := data.(json.Number)
+		if !ok {
+			return typeError(data, v)
+		}
+		u, err := strconv.ParseUint(string(n), 10, 64)
+		if err != nil || v.OverflowUint(u) {
+			return typeError(data, v)
+		}
+		v.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		n, ok := data.(json.Number)
+		if !ok {
+			return typeError(data, v)
+		}
+		f, err := n.Float64()
+		if err != nil || v.OverflowFloat(f) {
+			return typeError(data, v)
+		}
+		v.SetFloat(f)
+		return nil
+	}
+	return fmt.Errorf("unsupported type: %v", v.Type())
+}
+
+func structFromTree(m map[string]interface{}, v reflect.Value) error {
+	for _, f := range structFields(v.Type()) {
+		fv := v.FieldByIndex(f.index)
+		if f.embedded {
+			if fv.Kind() == reflect.Ptr {
+				// Like encoding/json, embedded pointers are only allocated when the data holds
+				// any of their fields.
+				if fv.IsNil() {
+					if !fv.CanSet() || !hasStructFields(m, fv.Type().Elem()) {
+						continue
+					}
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if err := structFromTree(m, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		val, ok := m[f.name]
+		if !ok {
+			continue
+		}
+		if err := fromTree(val, fv); err != nil {
+			return fmt.Errorf("field %q: %v", f.name, err)
+		}
+	}
+	return nil
+}
+
+// hasStructFields checks if m holds any of the fields of the struct type t, including the fields
+// of its embedded structs.
+func hasStructFields(m map[string]interface{}, t reflect.Type) bool {
+	for _, f := range structFields(t) {
+		if f.embedded {
+			ft := t.FieldByIndex(f.index).Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if hasStructFields(m, ft) {
+				return true
+			}
+		} else if _, ok := m[f.name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func mapFromTree(data interface{}, v reflect.Value) error {
+	t := v.Type()
+	entries := make(map[string]interface{})
+	switch d := data.(type) {
+	case map[string]interface{}:
+		entries = d
+	case []interface{}:
+		// Objects with integer keys may be returned as arrays by the database.
+		for i, item := range d {
+			if item != nil {
+				entries[strconv.Itoa(i)] = item
+			}
+		}
+	default:
+		return typeError(data, v)
+	}
+
+	m := reflect.MakeMapWithSize(t, len(entries))
+	for k, item := range entries {
+		key := reflect.New(t.Key()).Elem()
+		if err := setMapKey(k, key); err != nil {
+			return err
+		}
+		val := reflect.New(t.Elem()).Elem()
+		if err := fromTree(item, val); err != nil {
+			return err
+		}
+		m.SetMapIndex(key, val)
+	}
+	v.Set(m)
+	return nil
+}
+
+// listFromTree converts a database node into a list of child values. Arrays are returned as is.
+// Objects whose keys are all non-negative integers are converted into arrays by index, provided
+// that at least half of the indices up to the largest key are present. This is the same rule the
+// database uses to decide whether to return a node as an array. Sparse objects with integer keys
+// are converted into arrays ordered by index, and all other objects are converted into arrays
+// ordered by key.
+func listFromTree(data interface{}, v reflect.Value, maxLen int) ([]interface{}, error) {
+	var l []interface{}
+	switch d := data.(type) {
+	case []interface{}:
+		return d, nil
+	case map[string]interface{}:
+		indices, ok := integerKeys(d)
+		if !ok {
+			l = valuesByKey(d)
+			break
+		}
+		sort.Ints(indices)
+		maxIndex := -1
+		if len(indices) > 0 {
+			maxIndex = indices[len(indices)-1]
+		}
+		if len(indices)*2 <= maxIndex {
+			l = make([]interface{}, len(indices))
+			for j, i := range indices {
+				l[j] = d[strconv.Itoa(i)]
+			}
+			break
+		}
+		if maxLen >= 0 && maxIndex >= maxLen {
+			return nil, fmt.Errorf("index %d out of range for %v", maxIndex, v.Type())
+		}
+		l = make([]interface{}, maxIndex+1)
+		for _, i := range indices {
+			l[i] = d[strconv.Itoa(i)]
+		}
+		return l, nil
+	default:
+		return nil, typeError(data, v)
+	}
+	if maxLen >= 0 && len(l) > maxLen {
+		return nil, fmt.Errorf("%d values out of range for %v", len(l), v.Type())
+	}
+	return l, nil
+}
+
+// integerKeys returns the keys of m as integers, if they are all non-negative integers.
+func integerKeys(m map[string]interface{}) ([]int, bool) {
+	indices := make([]int, 0, len(m))
+	for k := range m {
+		i, err := strconv.Atoi(k)
+		if err != nil || i < 0 || strconv.Itoa(i) != k {
+			return nil, false
+		}
+		indices = append(indices, i)
+	}
+	return indices, true
+}
+
+func valuesByKey(m map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	l := make([]interface{}, len(keys))
+	for i, k := range keys {
+		l[i] = m[k]
+	}
+	return l
+}
+
+func timeFromTree(data interface{}, v reflect.Value) error {
+	switch d := data.(type) {
+	case json.Number:
+		if ms, err := d.Int64(); err == nil {
+			v.Set(reflect.ValueOf(timeFromMillis(ms, 0)))
+			return nil
+		}
+		ms, err := d.Float64()
+		if err != nil {
+			return typeError(data, v)
+		}
+		whole := math.Floor(ms)
+		nanos := int64(math.Floor((ms-whole)*float64(time.Millisecond) + 0.5))
+		v.Set(reflect.ValueOf(timeFromMillis(int64(whole), nanos)))
+		return nil
+	case string:
+		return jsonFromTree(d, v)
+	}
+	return typeError(data, v)
+}
+
+// timeFromMillis returns the time that is the given number of milliseconds and nanoseconds after
+// the epoch, without overflowing for times far from the epoch.
+func timeFromMillis(ms, nanos int64) time.Time {
+	sec, rem := ms/1000, ms%1000
+	return time.Unix(sec, rem*int64(time.Millisecond)+nanos)
+}
+
+// jsonFromTree decodes a string value using the encoding/json package.
+func jsonFromTree(s string, v reflect.Value) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v.Addr().Interface())
+}
+
+// normalizeNumbers converts the json.Number values in a deserialized JSON value into float64
+// values, which is how the encoding/json package decodes numbers into interface{} values.
+func normalizeNumbers(data interface{}) interface{} {
+	switch d := data.(type) {
+	case json.Number:
+		f, _ := d.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range d {
+			d[k] = normalizeNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range d {
+			d[i] = normalizeNumbers(item)
+		}
+	}
+	return data
+}
+
+func mapKeyString(k reflect.Value) (string, error) {
+	switch k.Kind() {
+	case reflect.String:
+		return k.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("unsupported map key type: %v", k.Type())
+}
+
+func setMapKey(s string, k reflect.Value) error {
+	switch k.Kind() {
+	case reflect.String:
+		k.SetString(s)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || k.OverflowInt(i) {
+			return fmt.Errorf("cannot decode key %q into %v", s, k.Type())
+		}
+		k.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || k.OverflowUint(u) {
+			return fmt.Errorf("cannot decode key %q into %v", s, k.Type())
+		}
+		k.SetUint(u)
+		return nil
+	}
+	return fmt.Errorf("unsupported map key type: %v", k.Type())
+}
+
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	embedded  bool
+}
+
+func structFields(t reflect.Type) []*structField {
+	var fields []*structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("firebase")
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct && ft != timeType {
+			// Embedded structs, and pointers to them, are flattened even when their type is
+			// unexported, since their exported fields are promoted to the enclosing struct.
+			fields = append(fields, &structField{index: f.Index, embedded: true})
+			continue
+		}
+		if f.PkgPath != "" {
+			// Unexported field.
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		sf := &structField{name: name, index: f.Index}
+		for _, opt := range opts[1:] {
+			if opt == "omitempty" {
+				sf.omitEmpty = true
+			}
+		}
+		fields = append(fields, sf)
+	}
+	return fields
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).IsZero()
+	}
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+func typeError(data interface{}, v reflect.Value) error {
+	return fmt.Errorf("cannot decode %v into %v", normalizeNumbers(data), v.Type())
+}
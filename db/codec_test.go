@@ -0,0 +1,448 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Audit struct {
+	CreatedBy string `firebase:"createdBy,omitempty"`
+}
+
+type message struct {
+	Audit
+	Text     string            `firebase:"text"`
+	Author   string            `firebase:"author,omitempty"`
+	Sent     time.Time         `firebase:"sent"`
+	Edited   *time.Time        `firebase:"edited,omitempty"`
+	Likes    int64             `firebase:"likes,omitempty"`
+	Tags     []string          `firebase:"tags,omitempty"`
+	Meta     map[string]string `firebase:"meta,omitempty"`
+	Internal string            `firebase:"-"`
+	Untagged bool
+	private  string
+}
+
+type revision struct {
+	Rev int `firebase:"rev"`
+}
+
+type revisedMessage struct {
+	revision
+	Text string `firebase:"text"`
+}
+
+type Origin struct {
+	Device string `firebase:"device"`
+}
+
+type trackedMessage struct {
+	*Origin
+	Text string `firebase:"text,omitempty,string"`
+	Note string `firebase:",omitempty"`
+}
+
+var testTime = time.Unix(1546300800, 123000000)
+
+func TestFirebaseCodecMarshal(t *testing.T) {
+	cases := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"Nil", nil, `null`},
+		{"String", "foo", `"foo"`},
+		{"Time", testTime, `1546300800123`},
+		{"TimePointer", &testTime, `1546300800123`},
+		{"ZeroTime", time.Time{}, `null`},
+		{"TimeBeforeEpoch", time.Unix(-1, 500000000), `-500`},
+		{
+			"Struct",
+			&message{
+				Audit:    Audit{CreatedBy: "admin"},
+				Text:     "hello",
+				Sent:     testTime,
+				Internal: "ignored",
+				Untagged: true,
+				private:  "ignored",
+			},
+			`{"createdBy":"admin","sent":1546300800123,"text":"hello","Untagged":true}`,
+		},
+		{
+			"StructWithValues",
+			message{
+				Text:   "hello",
+				Author: "alice",
+				Sent:   testTime,
+				Edited: &testTime,
+				Likes:  3,
+				Tags:   []string{"a", "b"},
+				Meta:   map[string]string{"k": "v"},
+			},
+			`{"author":"alice","edited":1546300800123,"likes":3,"meta":{"k":"v"},` +
+				`"sent":1546300800123,"tags":["a","b"],"text":"hello","Untagged":false}`,
+		},
+		{
+			"ServerValues",
+			map[string]interface{}{"sent": ServerTimestamp, "likes": Increment(1)},
+			`{"likes":{".sv":{"increment":1}},"sent":{".sv":"timestamp"}}`,
+		},
+		{
+			"IntKeys",
+			map[int][]*Audit{1: {{CreatedBy: "a"}, nil}},
+			`{"1":[{"createdBy":"a"},null]}`,
+		},
+		{"Bytes", []byte("hi"), `"aGk="`},
+		{"RawMessage", json.RawMessage(`{"a":1}`), `{"a":1}`},
+	}
+	for _, tc := range cases {
+		b, err := FirebaseCodec{}.Marshal(tc.value)
+		if err != nil {
+			t.Fatalf("%s; Marshal() = %v", tc.name, err)
+		}
+		if !jsonEqual(t, b, []byte(tc.want)) {
+			t.Errorf("%s; Marshal() = %s; want = %s", tc.name, string(b), tc.want)
+		}
+	}
+}
+
+func TestFirebaseCodecMarshalError(t *testing.T) {
+	cases := []interface{}{
+		func() {},
+		make(chan int),
+		map[float64]string{1: "a"},
+		&struct{ F func() }{},
+	}
+	for _, tc := range cases {
+		if b, err := (FirebaseCodec{}).Marshal(tc); b != nil || err == nil {
+			t.Errorf("Marshal(%T) = (%v, %v); want = (nil, error)", tc, b, err)
+		}
+	}
+}
+
+func TestFirebaseCodecUnmarshal(t *testing.T) {
+	data := `{
+		"createdBy": "admin",
+		"text": "hello",
+		"sent": 1546300800123,
+		"edited": "2019-01-01T00:00:00.123Z",
+		"likes": 9007199254740993,
+		"tags": {"0": "a", "2": "c"},
+		"meta": {"k": "v"},
+		"Internal": "ignored",
+		"Untagged": true,
+		"unknown": 1
+	}`
+	var got message
+	if err := (FirebaseCodec{}).Unmarshal([]byte(data), &got); err != nil {
+		t.Fatal(err)
+	}
+	edited := time.Date(2019, 1, 1, 0, 0, 0, 123000000, time.UTC)
+	want := message{
+		Audit:    Audit{CreatedBy: "admin"},
+		Text:     "hello",
+		Sent:     testTime,
+		Edited:   &edited,
+		Likes:    9007199254740993,
+		Tags:     []string{"a", "", "c"},
+		Meta:     map[string]string{"k": "v"},
+		Untagged: true,
+	}
+	if !got.Sent.Equal(want.Sent) || !got.Edited.Equal(*want.Edited) {
+		t.Errorf("Unmarshal() times = (%v, %v); want = (%v, %v)", got.Sent, got.Edited, want.Sent, want.Edited)
+	}
+	got.Sent, got.Edited = want.Sent, want.Edited
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal() = %#v; want = %#v", got, want)
+	}
+}
+
+func TestFirebaseCodecTimeRoundTrip(t *testing.T) {
+	cases := []time.Time{
+		{},
+		testTime,
+		time.Date(1600, 1, 1, 0, 0, 0, 1000000, time.UTC),
+		time.Date(3000, 12, 31, 23, 59, 59, 999000000, time.UTC),
+		time.Unix(-1, 1000000),
+	}
+	for _, tc := range cases {
+		b, err := FirebaseCodec{}.Marshal(&message{Sent: tc})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got message
+		if err := (FirebaseCodec{}).Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !got.Sent.Equal(tc) || got.Sent.IsZero() != tc.IsZero() {
+			t.Errorf("Unmarshal(Marshal(%v)) = %v; data = %s", tc, got.Sent, string(b))
+		}
+	}
+}
+
+func TestFirebaseCodecUnexportedEmbedded(t *testing.T) {
+	b, err := FirebaseCodec{}.Marshal(&revisedMessage{revision: revision{Rev: 2}, Text: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"rev":2,"text":"hello"}`
+	if !jsonEqual(t, b, []byte(want)) {
+		t.Errorf("Marshal() = %s; want = %s", string(b), want)
+	}
+
+	var got revisedMessage
+	if err := (FirebaseCodec{}).Unmarshal([]byte(want), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Rev != 2 || got.Text != "hello" {
+		t.Errorf("Unmarshal() = %#v; want = {Rev: 2, Text: hello}", got)
+	}
+}
+
+func TestFirebaseCodecEmbeddedPointer(t *testing.T) {
+	cases := []struct {
+		value *trackedMessage
+		want  string
+	}{
+		{&trackedMessage{}, `{}`},
+		{&trackedMessage{Text: "hello", Note: "n"}, `{"text":"hello","Note":"n"}`},
+		{&trackedMessage{Origin: &Origin{Device: "phone"}}, `{"device":"phone"}`},
+	}
+	for _, tc := range cases {
+		b, err := FirebaseCodec{}.Marshal(tc.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !jsonEqual(t, b, []byte(tc.want)) {
+			t.Errorf("Marshal(%#v) = %s; want = %s", tc.value, string(b), tc.want)
+		}
+
+		var got trackedMessage
+		if err := (FirebaseCodec{}).Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(&got, tc.value) {
+			t.Errorf("Unmarshal(%s) = %#v; want = %#v", tc.want, got, tc.value)
+		}
+	}
+}
+
+func TestFirebaseCodecUnmarshalCollections(t *testing.T) {
+	var pushList []string
+	data := `{"-LxB": "second", "-LxA": "first", "-LxC": "third"}`
+	if err := (FirebaseCodec{}).Unmarshal([]byte(data), &pushList); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"first", "second", "third"}; !reflect.DeepEqual(pushList, want) {
+		t.Errorf("Unmarshal(push IDs) = %v; want = %v", pushList, want)
+	}
+
+	var arr [3]int
+	if err := (FirebaseCodec{}).Unmarshal([]byte(`{"1": 10, "2": 20}`), &arr); err != nil {
+		t.Fatal(err)
+	}
+	if want := [3]int{0, 10, 20}; arr != want {
+		t.Errorf("Unmarshal(array) = %v; want = %v", arr, want)
+	}
+
+	var sparse []int
+	if err := (FirebaseCodec{}).Unmarshal([]byte(`{"100000000": 2, "0": 1, "7": 3}`), &sparse); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 3, 2}; !reflect.DeepEqual(sparse, want) {
+		t.Errorf("Unmarshal(sparse) = %v; want = %v", sparse, want)
+	}
+
+	var sparseArr [2]int
+	if err := (FirebaseCodec{}).Unmarshal([]byte(`{"0": 1, "100000000": 2}`), &sparseArr); err != nil {
+		t.Fatal(err)
+	}
+	if want := [2]int{1, 2}; sparseArr != want {
+		t.Errorf("Unmarshal(sparse array) = %v; want = %v", sparseArr, want)
+	}
+
+	var m map[int]string
+	if err := (FirebaseCodec{}).Unmarshal([]byte(`[null, "a", "b"]`), &m); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int]string{1: "a", 2: "b"}; !reflect.DeepEqual(m, want) {
+		t.Errorf("Unmarshal(map) = %v; want = %v", m, want)
+	}
+
+	var i interface{}
+	if err := (FirebaseCodec{}).Unmarshal([]byte(`{"a": [1, 2.5]}`), &i); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"a": []interface{}{1.0, 2.5}}; !reflect.DeepEqual(i, want) {
+		t.Errorf("Unmarshal(interface) = %v; want = %v", i, want)
+	}
+
+	var b []byte
+	if err := (FirebaseCodec{}).Unmarshal([]byte(`"aGk="`), &b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hi" {
+		t.Errorf("Unmarshal(bytes) = %q; want = %q", string(b), "hi")
+	}
+
+	var raw json.RawMessage
+	if err := (FirebaseCodec{}).Unmarshal([]byte(`{"a":1}`), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != `{"a":1}` {
+		t.Errorf("Unmarshal(raw) = %s; want = %s", string(raw), `{"a":1}`)
+	}
+}
+
+func TestFirebaseCodecUnmarshalError(t *testing.T) {
+	var (
+		s   string
+		i8  int8
+		u   uint
+		f   float32
+		arr [1]int
+		st  message
+		m   map[bool]string
+		err error
+	)
+	cases := []struct {
+		data string
+		v    interface{}
+	}{
+		{`1`, s},
+		{`1`, &s},
+		{`"1"`, &i8},
+		{`1000`, &i8},
+		{`1.5`, &i8},
+		{`-1`, &u},
+		{`1e100`, &f},
+		{`{"1": 1}`, &arr},
+		{`{"0": 1, "100000000": 2}`, &arr},
+		{`"text"`, &st},
+		{`{"sent": true}`, &st},
+		{`{"tags": "a"}`, &st},
+		{`{"a": "b"}`, &m},
+		{`{"a": "b"}`, &err},
+		{`{`, &s},
+	}
+	for _, tc := range cases {
+		if err := (FirebaseCodec{}).Unmarshal([]byte(tc.data), tc.v); err == nil {
+			t.Errorf("Unmarshal(%s, %T) = nil; want error", tc.data, tc.v)
+		}
+	}
+}
+
+func TestWithCodec(t *testing.T) {
+	mock := &mockServer{
+		Resp:   map[string]interface{}{"text": "hello", "sent": 1546300800123},
+		Header: map[string]string{"ETag": "mock-etag"},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	c := client.WithCodec(FirebaseCodec{})
+	if client.codec != nil {
+		t.Errorf("WithCodec() modified the original client")
+	}
+	ref := c.NewRef("peter")
+
+	var got message
+	if err := ref.Get(context.Background(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "hello" || !got.Sent.Equal(testTime) {
+		t.Errorf("Get() = %v; want = {hello %v}", got, testTime)
+	}
+
+	msg := &message{Text: "hello", Sent: testTime}
+	if err := ref.Set(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes, err := ref.OrderByChild("sent").GetOrdered(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("GetOrdered() = %d nodes; want = 2", len(nodes))
+	}
+	var sent time.Time
+	if err := nodes[0].Unmarshal(&sent); err != nil {
+		t.Fatal(err)
+	}
+	if !sent.Equal(testTime) {
+		t.Errorf("QueryNode.Unmarshal() = %v; want = %v", sent, testTime)
+	}
+
+	var fn UpdateFn = func(tn TransactionNode) (interface{}, error) {
+		var m message
+		if err := tn.Unmarshal(&m); err != nil {
+			return nil, err
+		}
+		if !m.Sent.Equal(testTime) {
+			t.Errorf("TransactionNode.Unmarshal() = %v; want = %v", m.Sent, testTime)
+		}
+		m.Sent = m.Sent.Add(time.Second)
+		return &m, nil
+	}
+	if err := ref.Transaction(context.Background(), fn); err != nil {
+		t.Fatal(err)
+	}
+
+	wantBody := `{"sent":1546300800123,"text":"hello","Untagged":false}`
+	if !jsonEqual(t, mock.Reqs[1].Body, []byte(wantBody)) {
+		t.Errorf("Set() body = %s; want = %s", string(mock.Reqs[1].Body), wantBody)
+	}
+	wantBody = `{"sent":1546300801123,"text":"hello","Untagged":false}`
+	if !jsonEqual(t, mock.Reqs[4].Body, []byte(wantBody)) {
+		t.Errorf("Transaction() body = %s; want = %s", string(mock.Reqs[4].Body), wantBody)
+	}
+	if mock.Reqs[4].Method != http.MethodPut {
+		t.Errorf("Transaction() method = %q; want = %q", mock.Reqs[4].Method, http.MethodPut)
+	}
+}
+
+func TestWithCodecBatch(t *testing.T) {
+	mock := &mockServer{}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	c := client.WithCodec(FirebaseCodec{})
+	if err := c.Batch().Set("messages/m1", &message{Sent: testTime}).Commit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	wantBody := `{"messages/m1":{"sent":1546300800123,"text":"","Untagged":false}}`
+	if !jsonEqual(t, mock.Reqs[0].Body, []byte(wantBody)) {
+		t.Errorf("Commit() body = %s; want = %s", string(mock.Reqs[0].Body), wantBody)
+	}
+}
+
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	var av, bv interface{}
+	if err := json.Unmarshal(a, &av); err != nil {
+		t.Fatalf("invalid JSON %q: %v", strings.TrimSpace(string(a)), err)
+	}
+	if err := json.Unmarshal(b, &bv); err != nil {
+		t.Fatalf("invalid JSON %q: %v", strings.TrimSpace(string(b)), err)
+	}
+	return reflect.DeepEqual(av, bv)
+}
@@ -31,15 +31,24 @@ const userAgentFormat = "Firebase/HTTP/%s/%s/AdminGo"
 const invalidChars = "[].#$"
 const authVarOverride = "auth_variable_override"
 
+// hostSuffixes are the domains that host Realtime Database instances. Databases in the us-central1
+// region are hosted on firebaseio.com, and databases in all other regions on firebasedatabase.app.
+var hostSuffixes = []string{".firebaseio.com", ".firebasedatabase.app"}
+
 // Client is the interface for the Firebase Realtime Database service.
 type Client struct {
 	hc           *internal.HTTPClient
 	url          string
 	authOverride string
+	codec        Codec
+	cache        *valueCache
 }
 
 // NewClient creates a new instance of the Firebase Database Client.
 //
+// The URL of the database must be of the form https://<name>.firebaseio.com, or
+// https://<name>.<region>.firebasedatabase.app for databases outside the us-central1 region.
+//
 // This function can only be invoked from within the SDK. Client applications should access the
 // Database service through firebase.App.
 func NewClient(ctx context.Context, c *internal.DatabaseConfig) (*Client, error) {
@@ -48,16 +57,14 @@ func NewClient(ctx context.Context, c *internal.DatabaseConfig) (*Client, error)
 		return nil, err
 	} else if p.Scheme != "https" {
 		return nil, fmt.Errorf("invalid database URL: %q; want scheme: %q", c.URL, "https")
-	} else if !strings.HasSuffix(p.Host, ".firebaseio.com") {
-		return nil, fmt.Errorf("invalid database URL: %q; want host: %q", c.URL, "firebaseio.com")
+	} else if !isDatabaseHost(p.Host) {
+		return nil, fmt.Errorf(
+			"invalid database URL: %q; want host: %q or %q", c.URL, "firebaseio.com", "firebasedatabase.app")
 	}
 
-	var ao []byte
-	if c.AuthOverride == nil || len(c.AuthOverride) > 0 {
-		ao, err = json.Marshal(c.AuthOverride)
-		if err != nil {
-			return nil, err
-		}
+	ao, err := encodeAuthOverride(c.AuthOverride)
+	if err != nil {
+		return nil, err
 	}
 
 	opts := append([]option.ClientOption{}, c.Opts...)
@@ -82,10 +89,49 @@ func NewClient(ctx context.Context, c *internal.DatabaseConfig) (*Client, error)
 	return &Client{
 		hc:           hc,
 		url:          fmt.Sprintf("https://%s", p.Host),
-		authOverride: string(ao),
+		authOverride: ao,
 	}, nil
 }
 
+// WithAuthOverride returns a copy of this Client that sends the given auth variable override with
+// all of its requests, instead of the one specified when the Client was created.
+//
+// The override determines the value of the auth variable in the security rules of the database.
+// A nil override makes the requests as an unauthenticated user, while an empty map makes them
+// with administrative privileges. The returned Client shares the underlying HTTP transport with
+// this Client, and is cheap to create. It does not share the in-memory cache of this Client, so
+// that values read on behalf of one user are not served to another.
+func (c *Client) WithAuthOverride(ao map[string]interface{}) (*Client, error) {
+	s, err := encodeAuthOverride(ao)
+	if err != nil {
+		return nil, err
+	}
+	cp := *c
+	cp.authOverride = s
+	cp.cache = nil
+	return &cp, nil
+}
+
+func isDatabaseHost(host string) bool {
+	for _, suffix := range hostSuffixes {
+		if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeAuthOverride(ao map[string]interface{}) (string, error) {
+	if ao != nil && len(ao) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(ao)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
 // NewRef returns a new database reference representing the node at the specified path.
 func (c *Client) NewRef(path string) *Ref {
 	segs := parsePath(path)
@@ -108,18 +154,71 @@ func (c *Client) send(
 	body internal.HTTPEntity,
 	opts ...internal.HTTPOption) (*internal.Response, error) {
 
-	if strings.ContainsAny(path, invalidChars) {
+	// The priority of a node is addressed as a child named ".priority".
+	if strings.ContainsAny(strings.TrimSuffix(path, "/"+priorityKey), invalidChars) {
 		return nil, fmt.Errorf("invalid path with illegal characters: %q", path)
 	}
 	if c.authOverride != "" {
 		opts = append(opts, internal.WithQueryParam(authVarOverride, c.authOverride))
 	}
-	return c.hc.Do(ctx, &internal.Request{
+	resp, err := c.hc.Do(ctx, &internal.Request{
 		Method: method,
 		URL:    fmt.Sprintf("%s%s.json", c.url, path),
 		Body:   body,
 		Opts:   opts,
 	})
+	if c.cache != nil && method != "GET" {
+		c.cache.invalidate(path)
+	}
+	return resp, err
+}
+
+// newEntity creates an HTTPEntity that serializes v using the Codec of the Client.
+func (c *Client) newEntity(v interface{}) internal.HTTPEntity {
+	return &codecEntity{codec: c.getCodec(), val: v}
+}
+
+// unmarshal checks if the Response has the given HTTP status code, and if so deserializes the
+// response body into v using the Codec of the Client.
+func (c *Client) unmarshal(resp *internal.Response, want int, v interface{}) error {
+	if err := resp.CheckStatus(want); err != nil {
+		return err
+	}
+	return c.getCodec().Unmarshal(resp.Body, v)
+}
+
+func (c *Client) getCodec() Codec {
+	if c.codec == nil {
+		return jsonCodec{}
+	}
+	return c.codec
+}
+
+type codecEntity struct {
+	codec Codec
+	val   interface{}
+}
+
+func (e *codecEntity) Bytes() ([]byte, error) {
+	return e.codec.Marshal(e.val)
+}
+
+func (e *codecEntity) Mime() string {
+	return "application/json"
+}
+
+func (c *Client) sendWithParams(
+	ctx context.Context,
+	method, path string,
+	body internal.HTTPEntity,
+	params requestParams,
+	opts ...internal.HTTPOption) (*internal.Response, error) {
+
+	po, err := params.options()
+	if err != nil {
+		return nil, err
+	}
+	return c.send(ctx, method, path, body, append(opts, po...)...)
 }
 
 func parsePath(path string) []string {
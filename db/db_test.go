@@ -106,6 +106,28 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
+func TestNewClientRegionalURL(t *testing.T) {
+	cases := []struct {
+		url, want string
+	}{
+		{"https://test-db.europe-west1.firebasedatabase.app", "https://test-db.europe-west1.firebasedatabase.app"},
+		{"https://test-db.asia-southeast1.firebasedatabase.app/", "https://test-db.asia-southeast1.firebasedatabase.app"},
+		{"https://test-db.firebaseio.com/path", testURL},
+	}
+	for _, tc := range cases {
+		c, err := NewClient(context.Background(), &internal.DatabaseConfig{
+			Opts: testOpts,
+			URL:  tc.url,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.url != tc.want {
+			t.Errorf("NewClient(%q).url = %q; want = %q", tc.url, c.url, tc.want)
+		}
+	}
+}
+
 func TestNewClientAuthOverrides(t *testing.T) {
 	cases := []map[string]interface{}{
 		nil,
@@ -142,6 +164,9 @@ func TestInvalidURL(t *testing.T) {
 		"foo",
 		"http://db.firebaseio.com",
 		"https://firebase.google.com",
+		"https://firebaseio.com",
+		"https://.firebasedatabase.app",
+		"https://db.europe-west1.firebasedatabase.app.example.com",
 	}
 	for _, tc := range cases {
 		c, err := NewClient(context.Background(), &internal.DatabaseConfig{
@@ -319,11 +344,12 @@ func checkRequest(t *testing.T, got, want *testReq) {
 }
 
 type testReq struct {
-	Method string
-	Path   string
-	Header http.Header
-	Body   []byte
-	Query  map[string]string
+	Method   string
+	Path     string
+	Header   http.Header
+	Body     []byte
+	Query    map[string]string
+	RawQuery string
 }
 
 func newTestReq(r *http.Request) (*testReq, error) {
@@ -343,16 +369,18 @@ func newTestReq(r *http.Request) (*testReq, error) {
 		query[k] = v[0]
 	}
 	return &testReq{
-		Method: r.Method,
-		Path:   u.Path,
-		Header: r.Header,
-		Body:   b,
-		Query:  query,
+		Method:   r.Method,
+		Path:     u.Path,
+		Header:   r.Header,
+		Body:     b,
+		Query:    query,
+		RawQuery: u.RawQuery,
 	}, nil
 }
 
 type mockServer struct {
 	Resp   interface{}
+	Resps  []interface{}
 	Header map[string]string
 	Status int
 	Reqs   []*testReq
@@ -378,7 +406,14 @@ func (s *mockServer) Start(c *Client) *httptest.Server {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
-		b, _ := json.Marshal(s.Resp)
+		resp := s.Resp
+		if len(s.Resps) > 0 {
+			resp, s.Resps = s.Resps[0], s.Resps[1:]
+		}
+		b, ok := resp.([]byte)
+		if !ok {
+			b, _ = json.Marshal(resp)
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.Write(b)
 	})
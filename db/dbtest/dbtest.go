@@ -0,0 +1,413 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dbtest provides an in-memory fake of the Firebase Realtime Database REST API, for
+// testing code that uses the db package.
+//
+// The fake supports reads, writes, conditional requests with ETags, shallow reads, queries,
+// priorities and security rules management. It does not evaluate security rules, enforce write
+// size limits or support streaming.
+package dbtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"firebase.google.com/go/db"
+	"firebase.google.com/go/internal"
+	"google.golang.org/api/option"
+)
+
+const (
+	fakeURL         = "https://dbtest.firebaseio.com"
+	rulesPath       = "/.settings/rules"
+	authVarOverride = "auth_variable_override"
+	defaultRules    = `{"rules": {".read": "auth != null", ".write": "auth != null"}}`
+)
+
+// Server is an in-memory fake of the Realtime Database REST API.
+//
+// A Server is safe for concurrent use. It must be closed with Close() when it is no longer used.
+type Server struct {
+	srv *httptest.Server
+	now func() time.Time
+
+	mu      sync.Mutex
+	root    interface{}
+	rules   []byte
+	reqs    []*Request
+	maxRead int
+}
+
+// Request is a request received by a Server.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+
+	// AuthOverride is the raw JSON value of the auth_variable_override query parameter, or an empty
+	// string if the request does not specify an auth override.
+	AuthOverride string
+}
+
+// NewServer starts a new Server with an empty database.
+func NewServer() *Server {
+	s := &Server{
+		now:   time.Now,
+		rules: []byte(defaultRules),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// URL returns the base URL of the Server.
+//
+// The Server listens on a local address over HTTP. Use NewClient() to create a db.Client that
+// sends its requests to the Server.
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Close shuts down the Server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// NewClient creates a db.Client with admin privileges that sends all of its requests to the
+// Server.
+func (s *Server) NewClient(ctx context.Context) (*db.Client, error) {
+	return s.newClient(ctx, map[string]interface{}{})
+}
+
+// NewClientWithAuthOverride creates a db.Client that sends all of its requests to the Server,
+// along with the given auth variable override. A nil override represents an unauthenticated
+// client, as in firebase.Config.
+func (s *Server) NewClientWithAuthOverride(
+	ctx context.Context, ao map[string]interface{}) (*db.Client, error) {
+
+	return s.newClient(ctx, ao)
+}
+
+func (s *Server) newClient(ctx context.Context, ao map[string]interface{}) (*db.Client, error) {
+	hc := &http.Client{Transport: &redirectTransport{host: s.srv.Listener.Addr()}}
+	return db.NewClient(ctx, &internal.DatabaseConfig{
+		URL:          fakeURL,
+		AuthOverride: ao,
+		Opts:         []option.ClientOption{option.WithHTTPClient(hc)},
+		Version:      "dbtest",
+	})
+}
+
+// Set replaces the value at the given path of the database. The value is serialized using the
+// encoding/json package.
+func (s *Server) Set(path string, v interface{}) error {
+	val, err := toTree(v)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(parsePath(path), val)
+	return nil
+}
+
+// Get returns the value at the given path of the database, in the form produced by the
+// encoding/json package. Returns nil if the path does not exist.
+func (s *Server) Get(path string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return export(s.get(parsePath(path)))
+}
+
+// SetMaxReadSize limits the size of the responses to non-shallow reads. Reads that return more
+// than n bytes of JSON fail with the same error as the Realtime Database. A limit of 0 removes the
+// limit.
+func (s *Server) SetMaxReadSize(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxRead = n
+}
+
+// Requests returns the requests received by the Server so far, in the order they were received.
+func (s *Server) Requests() []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Request(nil), s.reqs...)
+}
+
+// redirectTransport sends all requests to the given local address.
+type redirectTransport struct {
+	host net.Addr
+}
+
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r2 := new(http.Request)
+	*r2 = *req
+	u := *req.URL
+	u.Scheme = "http"
+	u.Host = t.host.String()
+	r2.URL = &u
+	return http.DefaultTransport.RoundTrip(r2)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query := r.URL.Query()
+	path := strings.TrimSuffix(r.URL.Path, ".json")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reqs = append(s.reqs, &Request{
+		Method:       r.Method,
+		Path:         path,
+		Query:        query,
+		Header:       r.Header,
+		Body:         b,
+		AuthOverride: query.Get(authVarOverride),
+	})
+
+	if path == rulesPath {
+		s.handleRules(w, r.Method, b)
+		return
+	}
+	segs := parsePath(path)
+	for i, seg := range segs {
+		if i == len(segs)-1 && seg == priorityKey && r.Method != "POST" {
+			continue
+		}
+		if strings.ContainsAny(seg, ".$#[]") {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid path: %q", path))
+			return
+		}
+	}
+
+	switch r.Method {
+	case "GET":
+		s.handleGet(w, r, segs)
+	case "PUT", "PATCH", "POST", "DELETE":
+		s.handleWrite(w, r, segs, b)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Unsupported method: %q", r.Method))
+	}
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, segs []string) {
+	val := s.get(segs)
+	etag := etagOf(val)
+	if r.Header.Get("X-Firebase-ETag") == "true" {
+		w.Header().Set("ETag", etag)
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		w.Header().Set("ETag", etag)
+		if match == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	query := r.URL.Query()
+	if query.Get("shallow") == "true" && hasQueryParams(query) {
+		// Like the database, reject shallow reads that are combined with queries.
+		writeError(w, http.StatusBadRequest, "Mixing 'shallow' and querying parameters is not supported.")
+		return
+	}
+	if query.Get("orderBy") != "" {
+		q, err := parseQuery(query)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		val = q.apply(val)
+	}
+	if query.Get("shallow") == "true" {
+		val = shallow(val)
+	}
+	if query.Get("format") != "export" {
+		val = export(val)
+	}
+	if s.maxRead > 0 && query.Get("shallow") != "true" {
+		if b, err := json.Marshal(val); err == nil && len(b) > s.maxRead {
+			writeError(w, http.StatusBadRequest,
+				"Data requested exceeds the maximum size that can be accessed with a single request.")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, val)
+}
+
+func (s *Server) handleWrite(w http.ResponseWriter, r *http.Request, segs []string, b []byte) {
+	var body interface{}
+	if r.Method != "DELETE" {
+		if err := json.Unmarshal(b, &body); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid data; couldn't parse JSON object.")
+			return
+		}
+	}
+
+	if match := r.Header.Get("If-Match"); match != "" {
+		current := s.get(segs)
+		if etag := etagOf(current); match != etag {
+			w.Header().Set("ETag", etag)
+			writeJSON(w, http.StatusPreconditionFailed, export(current))
+			return
+		}
+	}
+
+	var result interface{}
+	switch r.Method {
+	case "PUT":
+		val, err := s.resolve(segs, body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.set(segs, val)
+		result = export(s.get(segs))
+	case "PATCH":
+		update, ok := body.(map[string]interface{})
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Invalid data; update must be an object.")
+			return
+		}
+		if err := s.update(segs, update); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		result = body
+	case "POST":
+		key := db.NewPushID()
+		child := append(append([]string{}, segs...), key)
+		val, err := s.resolve(child, body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.set(child, val)
+		result = map[string]interface{}{"name": key}
+	case "DELETE":
+		s.set(segs, nil)
+	}
+
+	if r.URL.Query().Get("print") == "silent" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleRules(w http.ResponseWriter, method string, b []byte) {
+	switch method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(s.rules)
+	case "PUT":
+		if len(bytes.TrimSpace(b)) == 0 {
+			writeError(w, http.StatusBadRequest, "Rules must not be empty.")
+			return
+		}
+		s.rules = append([]byte(nil), b...)
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Unsupported method: %q", method))
+	}
+}
+
+// update applies a multi-location update relative to the given path. Must be called with the lock
+// held.
+func (s *Server) update(segs []string, update map[string]interface{}) error {
+	keys := make([]string, 0, len(update))
+	for k := range update {
+		if len(parsePath(k)) == 0 {
+			return fmt.Errorf("Invalid key in update: %q", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	vals := make([]interface{}, len(keys))
+	for i, k := range keys {
+		val, err := s.resolve(childPath(segs, k), update[k])
+		if err != nil {
+			return err
+		}
+		vals[i] = val
+	}
+	for i, k := range keys {
+		s.set(childPath(segs, k), vals[i])
+	}
+	return nil
+}
+
+// resolve converts a decoded JSON value into a database tree, replacing server values with their
+// results. Must be called with the lock held.
+func (s *Server) resolve(segs []string, v interface{}) (interface{}, error) {
+	return resolveTree(v, s.get(segs), s.now())
+}
+
+func childPath(segs []string, path string) []string {
+	return append(append([]string{}, segs...), parsePath(path)...)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	b, _ := json.Marshal(map[string]string{"error": msg})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func etagOf(v interface{}) string {
+	b, _ := json.Marshal(v)
+	h := sha1.Sum(b)
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func parsePath(path string) []string {
+	var segs []string
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segs = append(segs, s)
+		}
+	}
+	return segs
+}
@@ -0,0 +1,513 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbtest
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/db"
+	"google.golang.org/api/iterator"
+)
+
+type dinosaur struct {
+	Height float64 `json:"height"`
+	Order  string  `json:"order"`
+}
+
+var dinosaurs = map[string]interface{}{
+	"bruhathkayosaurus": map[string]interface{}{"height": 25, "order": "saurischia"},
+	"lambeosaurus":      map[string]interface{}{"height": 2.1, "order": "ornithischia"},
+	"linhenykus":        map[string]interface{}{"height": 0.6, "order": "theropoda"},
+	"pterodactyl":       map[string]interface{}{"height": 0.6, "order": "pterosauria"},
+	"stegosaurus":       map[string]interface{}{"height": 4, "order": "ornithischia"},
+	"triceratops":       map[string]interface{}{"height": 3, "order": "ornithischia"},
+}
+
+func setup(t *testing.T) (*Server, *db.Client) {
+	s := NewServer()
+	c, err := s.NewClient(context.Background())
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	return s, c
+}
+
+func TestReadWrite(t *testing.T) {
+	s, c := setup(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	ref := c.NewRef("dinosaurs/stegosaurus")
+	want := dinosaur{Height: 4, Order: "ornithischia"}
+	if err := ref.Set(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+	var got dinosaur
+	if err := ref.Get(ctx, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Get() = %v; want = %v", got, want)
+	}
+
+	if err := ref.Update(ctx, map[string]interface{}{"height": 5, "order": nil}); err != nil {
+		t.Fatal(err)
+	}
+	if v := s.Get("dinosaurs/stegosaurus"); !reflect.DeepEqual(v, map[string]interface{}{"height": 5.0}) {
+		t.Errorf("Update() = %v; want = %v", v, map[string]interface{}{"height": 5.0})
+	}
+
+	child, err := c.NewRef("dinosaurs").Push(ctx, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := s.Get("dinosaurs/" + child.Key); v != "new" {
+		t.Errorf("Push() = %v; want = %q", v, "new")
+	}
+
+	if err := ref.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v := s.Get("dinosaurs/stegosaurus"); v != nil {
+		t.Errorf("Delete() = %v; want = nil", v)
+	}
+	if err := child.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v := s.Get("/"); v != nil {
+		t.Errorf("Get() = %v; want = nil", v)
+	}
+}
+
+func TestServerSet(t *testing.T) {
+	s, c := setup(t)
+	defer s.Close()
+
+	if err := s.Set("list", []interface{}{"a", "b", nil, map[string]interface{}{}}); err != nil {
+		t.Fatal(err)
+	}
+	var got interface{}
+	if err := c.NewRef("list").Get(context.Background(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %v; want = %v", got, want)
+	}
+
+	if err := s.Set("list/5", "f"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"0": "a", "1": "b", "5": "f"}
+	if got := s.Get("list"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %v; want = %v", got, want)
+	}
+	if err := s.Set("invalid", func() {}); err == nil {
+		t.Errorf("Set() = nil; want error")
+	}
+}
+
+func TestETags(t *testing.T) {
+	s, c := setup(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	ref := c.NewRef("counter")
+	if err := ref.Set(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	var v int
+	etag, err := ref.GetWithETag(ctx, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, _, err := ref.GetIfChanged(ctx, etag, &v); changed || err != nil {
+		t.Errorf("GetIfChanged() = (%v, %v); want = (false, nil)", changed, err)
+	}
+	if ok, err := ref.SetIfUnchanged(ctx, "wrong", 2); ok || err != nil {
+		t.Errorf("SetIfUnchanged() = (%v, %v); want = (false, nil)", ok, err)
+	}
+	if ok, err := ref.SetIfUnchanged(ctx, etag, 2); !ok || err != nil {
+		t.Errorf("SetIfUnchanged() = (%v, %v); want = (true, nil)", ok, err)
+	}
+	if changed, _, err := ref.GetIfChanged(ctx, etag, &v); !changed || err != nil || v != 2 {
+		t.Errorf("GetIfChanged() = (%v, %v, %d); want = (true, nil, 2)", changed, err, v)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	s, c := setup(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	ref := c.NewRef("counter")
+	if err := ref.Set(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	conflict := true
+	fn := func(tn db.TransactionNode) (interface{}, error) {
+		var n int
+		if err := tn.Unmarshal(&n); err != nil {
+			return nil, err
+		}
+		if conflict {
+			conflict = false
+			if err := s.Set("counter", 10); err != nil {
+				return nil, err
+			}
+		}
+		return n + 1, nil
+	}
+	if err := ref.Transaction(ctx, fn); err != nil {
+		t.Fatal(err)
+	}
+	if v := s.Get("counter"); v != 11.0 {
+		t.Errorf("Transaction() = %v; want = 11", v)
+	}
+}
+
+func TestServerValues(t *testing.T) {
+	s, c := setup(t)
+	defer s.Close()
+	s.now = func() time.Time { return time.Unix(1546300800, 0) }
+	ctx := context.Background()
+
+	update := map[string]interface{}{
+		"updated": db.ServerTimestamp,
+		"count":   db.Increment(2),
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.NewRef("stats").Update(ctx, update); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]interface{}{"updated": 1546300800000.0, "count": 4.0}
+	if got := s.Get("stats"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Update() = %v; want = %v", got, want)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	s, c := setup(t)
+	defer s.Close()
+	if err := s.Set("dinosaurs", dinosaurs); err != nil {
+		t.Fatal(err)
+	}
+	ref := c.NewRef("dinosaurs")
+
+	cases := []struct {
+		name  string
+		query *db.Query
+		want  []string
+	}{
+		{"ByChild", ref.OrderByChild("height"), []string{
+			"linhenykus", "pterodactyl", "lambeosaurus", "triceratops", "stegosaurus",
+			"bruhathkayosaurus"}},
+		{"LimitToFirst", ref.OrderByChild("height").LimitToFirst(2), []string{"linhenykus", "pterodactyl"}},
+		{"LimitToLast", ref.OrderByKey().LimitToLast(2), []string{"stegosaurus", "triceratops"}},
+		{"StartAt", ref.OrderByChild("height").StartAt(3), []string{
+			"triceratops", "stegosaurus", "bruhathkayosaurus"}},
+		{"EndBefore", ref.OrderByChild("height").EndBefore(3), []string{
+			"linhenykus", "pterodactyl", "lambeosaurus"}},
+		{"StartAfterWithKey", ref.OrderByChild("height").StartAfterWithKey(0.6, "linhenykus").LimitToFirst(2),
+			[]string{"pterodactyl", "lambeosaurus"}},
+		{"EqualTo", ref.OrderByChild("order").EqualTo("ornithischia"), []string{
+			"lambeosaurus", "stegosaurus", "triceratops"}},
+		{"KeyRange", ref.OrderByKey().StartAt("p").EndAt("t"), []string{"pterodactyl", "stegosaurus"}},
+	}
+	for _, tc := range cases {
+		nodes, err := tc.query.GetOrdered(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var got []string
+		for _, n := range nodes {
+			got = append(got, n.Key())
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: GetOrdered() = %v; want = %v", tc.name, got, tc.want)
+		}
+	}
+
+	var keys []string
+	it := ref.Keys(context.Background())
+	it.PageInfo().MaxSize = 4
+	for {
+		k, err := it.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) != len(dinosaurs) || keys[0] != "bruhathkayosaurus" {
+		t.Errorf("Keys() = %v; want all keys in order", keys)
+	}
+}
+
+func TestBatchAndDeleteRecursive(t *testing.T) {
+	s, c := setup(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	err := c.Batch().
+		Set("users/alice", map[string]interface{}{"name": "Alice"}).
+		Set("users/bob", map[string]interface{}{"name": "Bob"}).
+		Update("counts", map[string]interface{}{"users": 2}).
+		Commit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"users":  map[string]interface{}{"alice": map[string]interface{}{"name": "Alice"}, "bob": map[string]interface{}{"name": "Bob"}},
+		"counts": map[string]interface{}{"users": 2.0},
+	}
+	if got := s.Get("/"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Commit() = %v; want = %v", got, want)
+	}
+
+	if err := c.NewRef("users").DeleteRecursive(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Get("users"); got != nil {
+		t.Errorf("DeleteRecursive() = %v; want = nil", got)
+	}
+}
+
+func TestRules(t *testing.T) {
+	s, c := setup(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	rules, err := c.GetRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddIndex(rules, "dinosaurs", "height"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetRules(ctx, rules); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.GetRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, rules) {
+		t.Errorf("GetRules() = %v; want = %v", got, rules)
+	}
+}
+
+func TestAuthOverride(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	ctx := context.Background()
+
+	admin, err := s.NewClient(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := s.NewClientWithAuthOverride(ctx, map[string]interface{}{"uid": "user1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	guest, err := s.NewClientWithAuthOverride(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*db.Client{admin, user, guest} {
+		var v interface{}
+		if err := c.NewRef("foo").Get(ctx, &v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reqs := s.Requests()
+	want := []string{"", `{"uid":"user1"}`, "null"}
+	for i, w := range want {
+		if reqs[i].AuthOverride != w {
+			t.Errorf("Requests()[%d].AuthOverride = %q; want = %q", i, reqs[i].AuthOverride, w)
+		}
+		if reqs[i].Method != "GET" || reqs[i].Path != "/foo" {
+			t.Errorf("Requests()[%d] = %s %s; want = GET /foo", i, reqs[i].Method, reqs[i].Path)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s, c := setup(t)
+	defer s.Close()
+
+	var v interface{}
+	if err := c.NewRef("dinosaurs").OrderByChild("height").LimitToFirst(1).LimitToLast(1).Get(
+		context.Background(), &v); err == nil {
+		t.Errorf("Get() = nil; want error")
+	}
+
+	cases := []string{"foo", "-1", "1.5"}
+	for _, limit := range cases {
+		if _, err := parseQuery(map[string][]string{
+			"orderBy": {`"$key"`}, "limitToFirst": {limit},
+		}); err == nil {
+			t.Errorf("parseQuery(limitToFirst=%s) = nil; want error", limit)
+		}
+	}
+	if _, err := parseQuery(map[string][]string{"orderBy": {"$key"}}); err == nil {
+		t.Errorf("parseQuery(orderBy=$key) = nil; want error")
+	}
+	if _, err := parseQuery(map[string][]string{
+		"orderBy": {`"height"`}, "startAt": {`1,"a"x`},
+	}); err == nil {
+		t.Errorf("parseQuery(startAt) = nil; want error")
+	}
+
+	resp, err := http.Get(s.URL() + `/dinosaurs.json?shallow=true&orderBy="$key"&limitToFirst=1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET(shallow, orderBy) = %d; want = %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestMaxReadSize(t *testing.T) {
+	s, c := setup(t)
+	defer s.Close()
+	if err := s.Set("dinosaurs", dinosaurs); err != nil {
+		t.Fatal(err)
+	}
+	s.SetMaxReadSize(50)
+
+	var v interface{}
+	ref := c.NewRef("dinosaurs")
+	if err := ref.Get(context.Background(), &v); err == nil ||
+		!strings.Contains(err.Error(), "exceeds the maximum size") {
+		t.Errorf("Get() = %v; want size limit error", err)
+	}
+	if err := ref.GetShallow(context.Background(), &v); err != nil {
+		t.Errorf("GetShallow() = %v; want nil", err)
+	}
+	it := ref.Keys(context.Background())
+	count := 0
+	for {
+		_, err := it.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		count++
+	}
+	if count != len(dinosaurs) {
+		t.Errorf("Keys() = %d keys; want = %d", count, len(dinosaurs))
+	}
+	if err := ref.Child("bruhathkayosaurus").Get(context.Background(), &v); err != nil {
+		t.Errorf("Get(child) = %v; want nil", err)
+	}
+
+	s.SetMaxReadSize(0)
+	if err := ref.Get(context.Background(), &v); err != nil {
+		t.Errorf("Get() = %v; want nil", err)
+	}
+}
+
+func TestPriorities(t *testing.T) {
+	s, c := setup(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	ref := c.NewRef("scores")
+	if err := ref.Child("alice").SetWithPriority(ctx, 10, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := ref.Child("bob").SetWithPriority(ctx, map[string]interface{}{"score": 5}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ref.Child("carol").Set(ctx, 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := ref.Child("dave").SetWithPriority(ctx, 1, "z"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ref.Child("carol").SetPriority(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := ref.Child("dave").SetPriority(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, err := ref.Child("carol").GetPriority(ctx); err != nil || p != 2.0 {
+		t.Errorf("GetPriority() = (%v, %v); want = (2, nil)", p, err)
+	}
+	var carol int
+	if err := ref.Child("carol").Get(ctx, &carol); err != nil || carol != 7 {
+		t.Errorf("Get() = (%d, %v); want = (7, nil)", carol, err)
+	}
+
+	nodes, err := ref.OrderByPriority().GetOrdered(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, n := range nodes {
+		keys = append(keys, n.Key())
+	}
+	if want := []string{"dave", "bob", "carol", "alice"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("GetOrdered() = %v; want = %v", keys, want)
+	}
+	var bob map[string]interface{}
+	if err := nodes[1].Unmarshal(&bob); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"score": 5.0}; !reflect.DeepEqual(bob, want) {
+		t.Errorf("Unmarshal() = %v; want = %v", bob, want)
+	}
+
+	nodes, err = ref.OrderByPriority().StartAt(2).GetOrdered(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[0].Key() != "carol" || nodes[1].Key() != "alice" {
+		t.Errorf("GetOrdered(StartAt) = %v; want = [carol alice]", nodes)
+	}
+
+	var export map[string]interface{}
+	if err := ref.GetExport(ctx, &export); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"alice": map[string]interface{}{".value": 10.0, ".priority": 3.0},
+		"bob":   map[string]interface{}{"score": 5.0, ".priority": 1.0},
+		"carol": map[string]interface{}{".value": 7.0, ".priority": 2.0},
+		"dave":  1.0,
+	}
+	if !reflect.DeepEqual(export, want) {
+		t.Errorf("GetExport() = %v; want = %v", export, want)
+	}
+
+	if err := ref.Child("bob/score").Set(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if v := s.Get("scores/bob"); v != nil {
+		t.Errorf("Get() = %v; want = nil", v)
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// query is a parsed set of REST query parameters.
+type query struct {
+	orderBy  string
+	limFirst int
+	limLast  int
+	start    *bound
+	end      *bound
+	equalTo  *bound
+}
+
+// bound is a range constraint, with an optional key for breaking ties between equal values.
+type bound struct {
+	value     interface{}
+	key       *string
+	exclusive bool
+}
+
+type child struct {
+	key   string
+	value interface{}
+	index interface{}
+}
+
+var queryParams = []string{
+	"orderBy", "limitToFirst", "limitToLast", "startAt", "startAfter", "endAt", "endBefore", "equalTo",
+}
+
+// hasQueryParams checks if any of the query parameters are set.
+func hasQueryParams(params url.Values) bool {
+	for _, name := range queryParams {
+		if _, ok := params[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func parseQuery(params url.Values) (*query, error) {
+	q := &query{}
+	if err := json.Unmarshal([]byte(params.Get("orderBy")), &q.orderBy); err != nil {
+		return nil, fmt.Errorf("orderBy must be a valid JSON encoded path")
+	}
+
+	var err error
+	if q.limFirst, err = parseLimit(params, "limitToFirst"); err != nil {
+		return nil, err
+	}
+	if q.limLast, err = parseLimit(params, "limitToLast"); err != nil {
+		return nil, err
+	}
+	if q.limFirst > 0 && q.limLast > 0 {
+		return nil, fmt.Errorf("limitToFirst and limitToLast cannot both be specified")
+	}
+
+	specs := []struct {
+		name      string
+		dst       **bound
+		exclusive bool
+	}{
+		{"startAt", &q.start, false},
+		{"startAfter", &q.start, true},
+		{"endAt", &q.end, false},
+		{"endBefore", &q.end, true},
+		{"equalTo", &q.equalTo, false},
+	}
+	for _, spec := range specs {
+		p, ok := params[spec.name]
+		if !ok {
+			continue
+		}
+		if *spec.dst != nil {
+			return nil, fmt.Errorf("%s cannot be combined with another bound of the same kind", spec.name)
+		}
+		b, err := parseBound(p[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a valid JSON value: %v", spec.name, err)
+		}
+		b.exclusive = spec.exclusive
+		*spec.dst = b
+	}
+	return q, nil
+}
+
+func parseLimit(params url.Values, name string) (int, error) {
+	p := params.Get(name)
+	if p == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(p)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer", name)
+	}
+	return n, nil
+}
+
+// parseBound parses a bound of the form value or value,key where both parts are JSON encoded.
+func parseBound(s string) (*bound, error) {
+	r := strings.NewReader(s)
+	dec := json.NewDecoder(r)
+	b := &bound{}
+	if err := dec.Decode(&b.value); err != nil {
+		return nil, err
+	}
+	rest, err := ioutil.ReadAll(io.MultiReader(dec.Buffered(), r))
+	if err != nil {
+		return nil, err
+	}
+	trimmed := strings.TrimSpace(string(rest))
+	if trimmed == "" {
+		return b, nil
+	}
+	if !strings.HasPrefix(trimmed, ",") {
+		return nil, fmt.Errorf("unexpected input: %q", trimmed)
+	}
+	var key string
+	if err := json.Unmarshal([]byte(trimmed[1:]), &key); err != nil {
+		return nil, err
+	}
+	b.key = &key
+	return b, nil
+}
+
+// apply evaluates the query against the given node, and returns the matching child nodes.
+func (q *query) apply(node interface{}) interface{} {
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return node
+	}
+
+	var children []*child
+	for k, v := range m {
+		if k == priorityKey {
+			continue
+		}
+		c := &child{key: k, value: v}
+		switch q.orderBy {
+		case "$key":
+		case "$value":
+			c.index = plainValue(v)
+		case "$priority":
+			c.index = priorityOf(v)
+		default:
+			c.index = childValue(v, q.orderBy)
+		}
+		if q.matches(c) {
+			children = append(children, c)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return compareChildren(children[i], children[j]) < 0
+	})
+
+	if q.limFirst > 0 && len(children) > q.limFirst {
+		children = children[:q.limFirst]
+	} else if q.limLast > 0 && len(children) > q.limLast {
+		children = children[len(children)-q.limLast:]
+	}
+	result := make(map[string]interface{}, len(children))
+	for _, c := range children {
+		result[c.key] = c.value
+	}
+	return result
+}
+
+func (q *query) matches(c *child) bool {
+	if q.start != nil {
+		if cmp := q.compareBound(c, q.start); cmp < 0 || (cmp == 0 && q.start.exclusive) {
+			return false
+		}
+	}
+	if q.end != nil {
+		if cmp := q.compareBound(c, q.end); cmp > 0 || (cmp == 0 && q.end.exclusive) {
+			return false
+		}
+	}
+	if q.equalTo != nil && q.compareBound(c, q.equalTo) != 0 {
+		return false
+	}
+	return true
+}
+
+// compareBound compares a child node to a bound. When ordering by key, the value of the bound is
+// the key to compare against.
+func (q *query) compareBound(c *child, b *bound) int {
+	if q.orderBy == "$key" {
+		return compareKeys(c.key, fmt.Sprint(b.value))
+	}
+	if cmp := compareValues(c.index, b.value); cmp != 0 || b.key == nil {
+		return cmp
+	}
+	return compareKeys(c.key, *b.key)
+}
+
+func compareChildren(a, b *child) int {
+	if cmp := compareValues(a.index, b.index); cmp != 0 {
+		return cmp
+	}
+	return compareKeys(a.key, b.key)
+}
+
+// compareValues compares two values using the type ordering of the Realtime Database: null,
+// false, true, numbers, strings and objects. Objects are considered equal to each other.
+func compareValues(a, b interface{}) int {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	switch av := a.(type) {
+	case float64:
+		bv := b.(float64)
+		if av < bv {
+			return -1
+		} else if av > bv {
+			return 1
+		}
+	case string:
+		return strings.Compare(av, b.(string))
+	}
+	return 0
+}
+
+func typeRank(v interface{}) int {
+	switch val := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if val {
+			return 2
+		}
+		return 1
+	case float64:
+		return 3
+	case string:
+		return 4
+	}
+	return 5
+}
+
+// compareKeys compares two child keys. Keys that represent 32-bit integers are ordered
+// numerically before all other keys, which are ordered lexicographically.
+func compareKeys(a, b string) int {
+	ai, aInt := intKey(a)
+	bi, bInt := intKey(b)
+	switch {
+	case aInt && bInt:
+		if ai < bi {
+			return -1
+		} else if ai > bi {
+			return 1
+		}
+		return 0
+	case aInt:
+		return -1
+	case bInt:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func intKey(k string) (int64, bool) {
+	i, err := strconv.ParseInt(k, 10, 32)
+	return i, err == nil && strconv.FormatInt(i, 10) == k
+}
+
+func childValue(v interface{}, path string) interface{} {
+	for _, seg := range parsePath(path) {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[seg]
+	}
+	return plainValue(v)
+}
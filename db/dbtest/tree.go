@@ -0,0 +1,255 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	priorityKey = ".priority"
+	valueKey    = ".value"
+)
+
+// The database is stored as a tree of map[string]interface{} nodes, with float64, string and bool
+// leaves. Arrays are stored as maps keyed by index, and empty nodes are never stored. Priorities
+// are stored in the export format: object nodes have a ".priority" child, while leaves with a
+// priority are stored as maps with a ".value" child and a ".priority" child.
+
+// get returns the node at the given path, or nil if it does not exist. A path ending in
+// ".priority" refers to the priority of the parent node.
+func (s *Server) get(segs []string) interface{} {
+	node := s.root
+	for _, seg := range segs {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if _, leaf := m[valueKey]; leaf && seg != priorityKey {
+			return nil
+		}
+		node = m[seg]
+	}
+	return node
+}
+
+// set replaces the node at the given path. Setting a node to nil removes it, along with any
+// parent nodes left empty. A path ending in ".priority" sets the priority of the parent node.
+func (s *Server) set(segs []string, val interface{}) {
+	if n := len(segs); n > 0 && segs[n-1] == priorityKey {
+		parent := segs[:n-1]
+		s.root = setNode(s.root, parent, withPriority(s.get(parent), val))
+		return
+	}
+	s.root = setNode(s.root, segs, val)
+}
+
+func setNode(node interface{}, segs []string, val interface{}) interface{} {
+	if len(segs) == 0 {
+		return val
+	}
+	m, ok := node.(map[string]interface{})
+	if _, leaf := m[valueKey]; !ok || leaf {
+		if val == nil {
+			return node
+		}
+		// Writing a child replaces a leaf value, but keeps its priority.
+		fresh := make(map[string]interface{})
+		if p, ok := m[priorityKey]; ok {
+			fresh[priorityKey] = p
+		}
+		m = fresh
+	}
+	child := setNode(m[segs[0]], segs[1:], val)
+	if child == nil {
+		delete(m, segs[0])
+	} else {
+		m[segs[0]] = child
+	}
+	if _, ok := m[priorityKey]; len(m) == 0 || (len(m) == 1 && ok) {
+		return nil
+	}
+	return m
+}
+
+// withPriority returns a copy of the node with the given priority. Empty nodes cannot have a
+// priority.
+func withPriority(node, priority interface{}) interface{} {
+	if node == nil {
+		return nil
+	}
+	m, ok := node.(map[string]interface{})
+	if v, leaf := m[valueKey]; !ok || leaf {
+		if leaf {
+			node = v
+		}
+		if priority == nil {
+			return node
+		}
+		return map[string]interface{}{valueKey: node, priorityKey: priority}
+	}
+	out := make(map[string]interface{}, len(m)+1)
+	for k, v := range m {
+		out[k] = v
+	}
+	if priority == nil {
+		delete(out, priorityKey)
+	} else {
+		out[priorityKey] = priority
+	}
+	return out
+}
+
+// priorityOf returns the priority of a node, or nil if it does not have one.
+func priorityOf(node interface{}) interface{} {
+	if m, ok := node.(map[string]interface{}); ok {
+		return m[priorityKey]
+	}
+	return nil
+}
+
+// plainValue returns the value of a leaf node without its priority.
+func plainValue(node interface{}) interface{} {
+	if m, ok := node.(map[string]interface{}); ok {
+		if v, ok := m[valueKey]; ok {
+			return v
+		}
+	}
+	return node
+}
+
+// toTree converts a Go value into a database tree via its JSON representation.
+func toTree(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return nil, err
+	}
+	return resolveTree(decoded, nil, time.Now())
+}
+
+// resolveTree converts a decoded JSON value into a database tree. Server values are replaced with
+// their results, computed against the current value of the node.
+func resolveTree(v, current interface{}, now time.Time) (interface{}, error) {
+	switch val := v.(type) {
+	case []interface{}:
+		m := make(map[string]interface{}, len(val))
+		for i, e := range val {
+			m[strconv.Itoa(i)] = e
+		}
+		return resolveTree(m, current, now)
+	case map[string]interface{}:
+		if sv, ok := val[".sv"]; ok {
+			return resolveServerValue(sv, current, now)
+		}
+		cm, _ := current.(map[string]interface{})
+		m := make(map[string]interface{}, len(val))
+		for k, e := range val {
+			child, err := resolveTree(e, cm[k], now)
+			if err != nil {
+				return nil, err
+			}
+			if child != nil {
+				m[k] = child
+			}
+		}
+		if v, ok := m[valueKey]; ok {
+			if _, ok := m[priorityKey]; !ok {
+				return v, nil
+			}
+		}
+		if _, ok := m[priorityKey]; len(m) == 0 || (len(m) == 1 && ok) {
+			return nil, nil
+		}
+		return m, nil
+	}
+	return v, nil
+}
+
+func resolveServerValue(sv, current interface{}, now time.Time) (interface{}, error) {
+	if sv == "timestamp" {
+		return float64(now.UnixNano() / int64(time.Millisecond)), nil
+	}
+	if m, ok := sv.(map[string]interface{}); ok {
+		if delta, ok := m["increment"].(float64); ok {
+			if n, ok := plainValue(current).(float64); ok {
+				return n + delta, nil
+			}
+			return delta, nil
+		}
+	}
+	return nil, fmt.Errorf("Invalid server value: %v", sv)
+}
+
+// export converts a database tree into the value returned by the REST API, without priorities.
+// Nodes with integer keys are returned as arrays when more than half of the keys between 0 and the
+// largest key are present.
+func export(node interface{}) interface{} {
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return node
+	}
+	if v, ok := m[valueKey]; ok {
+		return v
+	}
+	out := make(map[string]interface{}, len(m))
+	maxIndex := -1
+	allInts := true
+	for k, v := range m {
+		if k == priorityKey {
+			continue
+		}
+		out[k] = export(v)
+		i, err := strconv.Atoi(k)
+		if err != nil || i < 0 || strconv.Itoa(i) != k {
+			allInts = false
+		} else if i > maxIndex {
+			maxIndex = i
+		}
+	}
+	if !allInts || maxIndex+1 >= 2*len(out) {
+		return out
+	}
+	arr := make([]interface{}, maxIndex+1)
+	for k, v := range out {
+		i, _ := strconv.Atoi(k)
+		arr[i] = v
+	}
+	return arr
+}
+
+// shallow replaces the children of an object node with true.
+func shallow(node interface{}) interface{} {
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return node
+	}
+	if v, ok := m[valueKey]; ok {
+		return v
+	}
+	out := make(map[string]interface{}, len(m))
+	for k := range m {
+		if k != priorityKey {
+			out[k] = true
+		}
+	}
+	return out
+}
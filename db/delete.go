@@ -0,0 +1,261 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"firebase.google.com/go/internal"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	defaultDeleteBatchSize   = 100
+	defaultDeleteConcurrency = 4
+)
+
+// DeleteOptions specifies how DeleteRecursive() removes a database subtree.
+type DeleteOptions struct {
+	// BatchSize is the maximum number of child nodes removed by a single multi-location update.
+	// Defaults to 100 when set to 0.
+	BatchSize int
+
+	// Concurrency is the maximum number of requests made to the database at the same time.
+	// Defaults to 4 when set to 0.
+	Concurrency int
+
+	// Progress, if set, is called after each successful delete request. Calls are never made
+	// concurrently.
+	Progress func(p *DeleteProgress)
+}
+
+// DeleteProgress reports the progress of a DeleteRecursive() call.
+type DeleteProgress struct {
+	// Paths contains the database locations removed by the latest delete request.
+	Paths []string
+
+	// Deleted is the total number of database locations removed so far.
+	Deleted int
+}
+
+// DeleteRecursive removes this node and all of its descendants from the database, including
+// subtrees that are too large to be removed with a single Delete() call.
+//
+// DeleteRecursive first attempts to remove the node with a single size-limited request. If the
+// node is too large, its children are listed with shallow reads, and removed in batches of
+// multi-location updates. Batches that are still too large are split up, down to individual child
+// nodes, which are then removed recursively in the same manner.
+//
+// Since each request removes a part of the subtree, an interrupted DeleteRecursive() call may
+// leave the subtree partially removed. It is safe to call DeleteRecursive() again on the same node
+// to remove the rest of it. Options may be nil, in which case the defaults are used.
+func (r *Ref) DeleteRecursive(ctx context.Context, opts *DeleteOptions) error {
+	d := &recursiveDelete{
+		batchSize:   defaultDeleteBatchSize,
+		concurrency: defaultDeleteConcurrency,
+	}
+	if opts != nil {
+		if opts.BatchSize < 0 {
+			return fmt.Errorf("batch size must not be negative: %d", opts.BatchSize)
+		} else if opts.Concurrency < 0 {
+			return fmt.Errorf("concurrency must not be negative: %d", opts.Concurrency)
+		}
+		if opts.BatchSize > 0 {
+			d.batchSize = opts.BatchSize
+		}
+		if opts.Concurrency > 0 {
+			d.concurrency = opts.Concurrency
+		}
+		d.progress = opts.Progress
+	}
+	d.sem = make(chan struct{}, d.concurrency)
+	d.workers = make(chan struct{}, d.concurrency)
+	return d.deleteNode(ctx, r.WithWriteSizeLimit(WriteSizeLimitTiny))
+}
+
+type recursiveDelete struct {
+	batchSize   int
+	concurrency int
+	sem         chan struct{}
+	workers     chan struct{}
+
+	mu       sync.Mutex
+	deleted  int
+	progress func(p *DeleteProgress)
+}
+
+// deleteNode removes the given node, falling back to removing its children when the node is too
+// large to be removed with a single request.
+func (d *recursiveDelete) deleteNode(ctx context.Context, r *Ref) error {
+	ok, err := d.send(ctx, []string{r.Path}, func() (*internal.Response, error) {
+		return r.send(ctx, "DELETE", internal.WithQueryParam("print", "silent"))
+	})
+	if ok || err != nil {
+		return err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	// Batches are removed by worker goroutines drawn from a pool shared by all levels of the
+	// subtree. When the pool is exhausted, the batch is removed by the current goroutine instead,
+	// which also stops the listing from running ahead of the workers.
+	run := func(keys []string) {
+		err := ctx.Err()
+		if err == nil {
+			err = d.deleteChildren(ctx, r, keys)
+		}
+		if err != nil {
+			fail(err)
+		}
+	}
+	dispatch := func(keys []string) bool {
+		select {
+		case d.workers <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-d.workers
+					wg.Done()
+				}()
+				run(keys)
+			}()
+		default:
+			run(keys)
+		}
+		return ctx.Err() == nil
+	}
+
+	it := r.Keys(ctx)
+	var (
+		batch []string
+		count int
+	)
+	for {
+		key, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			fail(err)
+			break
+		}
+		count++
+		batch = append(batch, key)
+		if len(batch) == d.batchSize {
+			if !dispatch(batch) {
+				break
+			}
+			batch = nil
+		}
+	}
+	if len(batch) > 0 {
+		dispatch(batch)
+	}
+	wg.Wait()
+	if firstErr != nil || count > 0 {
+		return firstErr
+	}
+
+	// A node without children is a large leaf value, which is removed without a size limit.
+	ok, err = d.send(ctx, []string{r.Path}, func() (*internal.Response, error) {
+		return r.WithWriteSizeLimit("").send(ctx, "DELETE", internal.WithQueryParam("print", "silent"))
+	})
+	if !ok && err == nil {
+		err = fmt.Errorf("node too large to delete: %q", r.Path)
+	}
+	return err
+}
+
+// deleteChildren removes the given child nodes of r with a multi-location update. If the child
+// nodes are too large to be removed together, the batch is split in half. A single child node
+// that is too large is removed recursively.
+func (d *recursiveDelete) deleteChildren(ctx context.Context, r *Ref, keys []string) error {
+	if len(keys) == 1 {
+		return d.deleteNode(ctx, r.Child(keys[0]))
+	}
+
+	paths := make([]string, len(keys))
+	update := make(map[string]interface{}, len(keys))
+	for i, k := range keys {
+		paths[i] = r.Child(k).Path
+		update[k] = nil
+	}
+	ok, err := d.send(ctx, paths, func() (*internal.Response, error) {
+		return r.sendWithBody(ctx, "PATCH", update, internal.WithQueryParam("print", "silent"))
+	})
+	if ok || err != nil {
+		return err
+	}
+
+	mid := len(keys) / 2
+	if err := d.deleteChildren(ctx, r, keys[:mid]); err != nil {
+		return err
+	}
+	return d.deleteChildren(ctx, r, keys[mid:])
+}
+
+// send makes a delete request while respecting the concurrency limit. It returns false without an
+// error if the request was rejected for writing too much data.
+func (d *recursiveDelete) send(
+	ctx context.Context, paths []string, fn func() (*internal.Response, error)) (bool, error) {
+
+	select {
+	case d.sem <- struct{}{}:
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+	resp, err := fn()
+	<-d.sem
+	if err != nil {
+		return false, err
+	}
+	if err := resp.CheckStatus(http.StatusNoContent); err != nil {
+		if isWriteTooBig(resp) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deleted += len(paths)
+	if d.progress != nil {
+		d.progress(&DeleteProgress{Paths: paths, Deleted: d.deleted})
+	}
+	return true, nil
+}
+
+// isWriteTooBig checks if a size-limited delete was rejected for writing too much data. The
+// database rejects such writes with a 400 Bad Request response. Deletes that fail with a 400
+// response for any other reason fail again once they reach a single leaf node, which is removed
+// without a size limit.
+func isWriteTooBig(resp *internal.Response) bool {
+	return resp.Status == http.StatusBadRequest || resp.Status == http.StatusRequestEntityTooLarge
+}
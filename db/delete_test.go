@@ -0,0 +1,409 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// sizeLimitedServer is a mock database server that rejects size-limited writes affecting more than
+// maxLeaves leaf nodes.
+type sizeLimitedServer struct {
+	maxLeaves int
+	root      map[string]interface{}
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	srv      *httptest.Server
+}
+
+func (s *sizeLimitedServer) Start(c *Client) *httptest.Server {
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	c.url = s.srv.URL
+	return s.srv
+}
+
+func (s *sizeLimitedServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.peak {
+		s.peak = s.inFlight
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+
+	segs := parsePath(strings.TrimSuffix(r.URL.Path, ".json"))
+	limited := r.URL.Query().Get("writeSizeLimit") == "tiny"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case "GET":
+		s.keysGet(w, r, segs)
+	case "DELETE":
+		if limited && leaves(s.get(segs)) > s.maxLeaves {
+			s.tooBig(w)
+			return
+		}
+		s.delete(segs)
+		w.WriteHeader(http.StatusNoContent)
+	case "PATCH":
+		b, _ := ioutil.ReadAll(r.Body)
+		var update map[string]interface{}
+		json.Unmarshal(b, &update)
+		total := 0
+		for k := range update {
+			total += leaves(s.get(append(segs, parsePath(k)...)))
+		}
+		if limited && total > s.maxLeaves {
+			s.tooBig(w)
+			return
+		}
+		for k := range update {
+			s.delete(append(append([]string{}, segs...), parsePath(k)...))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *sizeLimitedServer) keysGet(w http.ResponseWriter, r *http.Request, segs []string) {
+	query := r.URL.Query()
+	if query.Get("shallow") != "" || query.Get("orderBy") != `"$key"` {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "only queries ordered by key are supported"}`))
+		return
+	}
+	node := s.get(segs)
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		b, _ := json.Marshal(node)
+		w.Write(b)
+		return
+	}
+
+	var sn sortableNodes
+	for k := range m {
+		sn = append(sn, newQueryNode(k, nil, orderByProperty("$key")))
+	}
+	sort.Sort(sn)
+	var start string
+	json.Unmarshal([]byte(query.Get("startAfter")), &start)
+	limit, _ := strconv.Atoi(query.Get("limitToFirst"))
+	after := newQueryNode(start, nil, orderByProperty("$key"))
+	result := make(map[string]interface{})
+	for _, n := range sn {
+		if len(result) == limit {
+			break
+		}
+		if start != "" && !(sortableNodes{after, n}).Less(0, 1) {
+			continue
+		}
+		result[n.Key()] = m[n.Key()]
+	}
+	b, _ := json.Marshal(result)
+	w.Write(b)
+}
+
+func (s *sizeLimitedServer) tooBig(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte(`{"error": "Data to write exceeds the maximum size that can be modified with a single request."}`))
+}
+
+func (s *sizeLimitedServer) get(segs []string) interface{} {
+	var node interface{} = s.root
+	for _, seg := range segs {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = m[seg]
+	}
+	return node
+}
+
+func (s *sizeLimitedServer) delete(segs []string) {
+	if len(segs) == 0 {
+		s.root = map[string]interface{}{}
+		return
+	}
+	parent, ok := s.get(segs[:len(segs)-1]).(map[string]interface{})
+	if !ok {
+		return
+	}
+	delete(parent, segs[len(segs)-1])
+	if len(parent) == 0 && len(segs) > 1 {
+		s.delete(segs[:len(segs)-1])
+	}
+}
+
+// leaves counts the leaf nodes in the given tree. Long strings count as large leaves.
+func leaves(node interface{}) int {
+	switch n := node.(type) {
+	case nil:
+		return 0
+	case map[string]interface{}:
+		total := 0
+		for _, v := range n {
+			total += leaves(v)
+		}
+		return total
+	case string:
+		if len(n) > 10 {
+			return 100
+		}
+	}
+	return 1
+}
+
+func TestDeleteRecursive(t *testing.T) {
+	mock := &sizeLimitedServer{
+		maxLeaves: 3,
+		root: map[string]interface{}{
+			"peter": map[string]interface{}{
+				"a": map[string]interface{}{"w": 1, "x": 2, "y": 3, "z": 4},
+				"b": 1,
+				"c": 2,
+				"d": map[string]interface{}{"e": 1},
+			},
+			"other": 1,
+		},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	var progress []*DeleteProgress
+	opts := &DeleteOptions{
+		BatchSize:   2,
+		Concurrency: 2,
+		Progress: func(p *DeleteProgress) {
+			progress = append(progress, p)
+		},
+	}
+	if err := testref.DeleteRecursive(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := mock.root["peter"]; ok {
+		t.Errorf("DeleteRecursive() did not delete %q: %v", "peter", mock.root)
+	}
+	if _, ok := mock.root["other"]; !ok {
+		t.Errorf("DeleteRecursive() deleted %q", "other")
+	}
+	if mock.peak > 2 {
+		t.Errorf("DeleteRecursive() concurrency = %d; want <= %d", mock.peak, 2)
+	}
+
+	var paths []string
+	for i, p := range progress {
+		if p.Deleted != len(paths)+len(p.Paths) {
+			t.Errorf("Progress[%d].Deleted = %d; want = %d", i, p.Deleted, len(paths)+len(p.Paths))
+		}
+		paths = append(paths, p.Paths...)
+	}
+	sort.Strings(paths)
+	want := []string{"/peter/a/w", "/peter/a/x", "/peter/a/y", "/peter/a/z", "/peter/b", "/peter/c", "/peter/d"}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Errorf("Progress paths = %v; want = %v", paths, want)
+	}
+}
+
+func TestDeleteRecursiveManyBatches(t *testing.T) {
+	children := make(map[string]interface{})
+	for i := 0; i < 200; i++ {
+		children["c"+strconv.Itoa(i)] = i
+	}
+	mock := &sizeLimitedServer{
+		maxLeaves: 1,
+		root:      map[string]interface{}{"peter": children},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	// Listing 100 batches must not start a goroutine per batch.
+	base := runtime.NumGoroutine()
+	peak := base
+	opts := &DeleteOptions{
+		BatchSize:   2,
+		Concurrency: 2,
+		Progress: func(p *DeleteProgress) {
+			if n := runtime.NumGoroutine(); n > peak {
+				peak = n
+			}
+		},
+	}
+	if err := testref.DeleteRecursive(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mock.root["peter"]; ok {
+		t.Errorf("DeleteRecursive() did not delete %q", "peter")
+	}
+	if peak-base > 20 {
+		t.Errorf("DeleteRecursive() goroutines = %d; want <= %d", peak-base, 20)
+	}
+}
+
+func TestDeleteRecursiveDeepTree(t *testing.T) {
+	var tree func(depth int) interface{}
+	tree = func(depth int) interface{} {
+		if depth == 0 {
+			return 1
+		}
+		return map[string]interface{}{"l": tree(depth - 1), "r": tree(depth - 1)}
+	}
+	mock := &sizeLimitedServer{
+		maxLeaves: 1,
+		root:      map[string]interface{}{"peter": tree(7)},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	// Every level of the tree is split up, which must not start more goroutines per level.
+	base := runtime.NumGoroutine()
+	peak := base
+	opts := &DeleteOptions{
+		BatchSize:   1,
+		Concurrency: 2,
+		Progress: func(p *DeleteProgress) {
+			if n := runtime.NumGoroutine(); n > peak {
+				peak = n
+			}
+		},
+	}
+	if err := testref.DeleteRecursive(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mock.root["peter"]; ok {
+		t.Errorf("DeleteRecursive() did not delete %q", "peter")
+	}
+	if mock.peak > 2 {
+		t.Errorf("DeleteRecursive() concurrency = %d; want <= %d", mock.peak, 2)
+	}
+	if peak-base > 20 {
+		t.Errorf("DeleteRecursive() goroutines = %d; want <= %d", peak-base, 20)
+	}
+}
+
+func TestDeleteRecursiveSmallNode(t *testing.T) {
+	mock := &mockServer{}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	var progress []*DeleteProgress
+	opts := &DeleteOptions{
+		Progress: func(p *DeleteProgress) {
+			progress = append(progress, p)
+		},
+	}
+	if err := testref.DeleteRecursive(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	checkOnlyRequest(t, mock.Reqs, &testReq{
+		Method: "DELETE",
+		Path:   "/peter.json",
+		Query:  map[string]string{"print": "silent", "writeSizeLimit": "tiny"},
+	})
+	if len(progress) != 1 || progress[0].Deleted != 1 || progress[0].Paths[0] != "/peter" {
+		t.Errorf("Progress = %v; want = [/peter]", progress)
+	}
+}
+
+func TestDeleteRecursiveLargeLeaf(t *testing.T) {
+	mock := &sizeLimitedServer{
+		maxLeaves: 3,
+		root: map[string]interface{}{
+			"peter": "a very long string value",
+		},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	if err := testref.DeleteRecursive(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mock.root["peter"]; ok {
+		t.Errorf("DeleteRecursive() did not delete %q: %v", "peter", mock.root)
+	}
+}
+
+func TestDeleteRecursiveResume(t *testing.T) {
+	mock := &sizeLimitedServer{
+		maxLeaves: 1,
+		root: map[string]interface{}{
+			"peter": map[string]interface{}{"a": 1, "b": 2, "c": 3},
+		},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := &DeleteOptions{
+		BatchSize:   1,
+		Concurrency: 1,
+		Progress: func(p *DeleteProgress) {
+			cancel()
+		},
+	}
+	if err := testref.DeleteRecursive(ctx, opts); err == nil {
+		t.Errorf("DeleteRecursive() = nil; want error")
+	}
+	if peter, ok := mock.root["peter"].(map[string]interface{}); !ok || len(peter) == 3 {
+		t.Errorf("DeleteRecursive() = %v; want partially deleted", mock.root)
+	}
+
+	if err := testref.DeleteRecursive(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mock.root["peter"]; ok {
+		t.Errorf("DeleteRecursive() did not delete %q: %v", "peter", mock.root)
+	}
+}
+
+func TestDeleteRecursiveError(t *testing.T) {
+	mock := &mockServer{
+		Resp:   map[string]string{"error": "test error"},
+		Status: http.StatusUnauthorized,
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	want := "http error status: 401; reason: test error"
+	if err := testref.DeleteRecursive(context.Background(), nil); err == nil || err.Error() != want {
+		t.Errorf("DeleteRecursive() = %v; want = %q", err, want)
+	}
+
+	invalid := []*DeleteOptions{
+		{BatchSize: -1},
+		{Concurrency: -1},
+	}
+	for _, opts := range invalid {
+		if err := testref.DeleteRecursive(context.Background(), opts); err == nil {
+			t.Errorf("DeleteRecursive(%v) = nil; want error", opts)
+		}
+	}
+}
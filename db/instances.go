@@ -0,0 +1,256 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"firebase.google.com/go/internal"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+const (
+	managementEndpoint  = "https://firebasedatabase.googleapis.com/v1beta"
+	maxInstancesPerPage = 100
+)
+
+var databaseIDPattern = regexp.MustCompile("^[a-z][a-z0-9-]{4,61}[a-z0-9]$")
+
+// InstanceType is the type of a database instance.
+type InstanceType string
+
+const (
+	// DefaultDatabase is the default database instance of a project.
+	DefaultDatabase InstanceType = "DEFAULT_DATABASE"
+
+	// UserDatabase is an additional database instance created by the user.
+	UserDatabase InstanceType = "USER_DATABASE"
+)
+
+// InstanceState is the state of a database instance.
+type InstanceState string
+
+const (
+	// Active instances can be read from and written to.
+	Active InstanceState = "ACTIVE"
+
+	// Disabled instances cannot be read from or written to, but can be re-enabled.
+	Disabled InstanceState = "DISABLED"
+
+	// Deleted instances are scheduled for deletion.
+	Deleted InstanceState = "DELETED"
+)
+
+// Instance is a Realtime Database instance of a Firebase project.
+type Instance struct {
+	// Name is the resource name of the instance, of the form
+	// projects/{project-number}/locations/{location}/instances/{database-id}.
+	Name        string        `json:"name"`
+	Project     string        `json:"project"`
+	DatabaseURL string        `json:"databaseUrl"`
+	Type        InstanceType  `json:"type"`
+	State       InstanceState `json:"state"`
+}
+
+// ID returns the ID of the database instance, which is the last segment of its resource name.
+func (i *Instance) ID() string {
+	return i.Name[strings.LastIndex(i.Name, "/")+1:]
+}
+
+// Location returns the region of the database instance, such as "us-central1".
+func (i *Instance) Location() string {
+	segs := strings.Split(i.Name, "/")
+	for n := 0; n < len(segs)-1; n++ {
+		if segs[n] == "locations" {
+			return segs[n+1]
+		}
+	}
+	return ""
+}
+
+// InstanceClient manages the Realtime Database instances of a Firebase project.
+type InstanceClient struct {
+	// To enable testing against arbitrary endpoints.
+	endpoint string
+	hc       *internal.HTTPClient
+	project  string
+}
+
+// NewInstanceClient creates a new instance of the database InstanceClient.
+//
+// This function can only be invoked from within the SDK. Client applications should access the
+// database management service through firebase.App.
+func NewInstanceClient(ctx context.Context, c *internal.DatabaseInstanceConfig) (*InstanceClient, error) {
+	if c.ProjectID == "" {
+		return nil, errors.New("project ID is required to manage database instances")
+	}
+
+	opts := append([]option.ClientOption{}, c.Opts...)
+	ua := fmt.Sprintf(userAgentFormat, c.Version, runtime.Version())
+	opts = append(opts, option.WithUserAgent(ua))
+	hc, _, err := internal.NewHTTPClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	hc.ErrParser = func(b []byte) string {
+		var p struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(b, &p); err != nil {
+			return ""
+		}
+		return p.Error.Message
+	}
+
+	return &InstanceClient{
+		endpoint: managementEndpoint,
+		hc:       hc,
+		project:  c.ProjectID,
+	}, nil
+}
+
+// Instance returns the database instance with the given ID.
+func (c *InstanceClient) Instance(ctx context.Context, databaseID string) (*Instance, error) {
+	if err := validateDatabaseID(databaseID); err != nil {
+		return nil, err
+	}
+	req := &internal.Request{
+		Method: http.MethodGet,
+		URL:    fmt.Sprintf("%s/projects/%s/locations/-/instances/%s", c.endpoint, c.project, databaseID),
+	}
+	return c.sendInstanceRequest(ctx, req)
+}
+
+// CreateInstance creates a new database instance with the given ID in the given location.
+//
+// The ID becomes part of the URL of the database, and must be unique across all Firebase projects.
+// The location is a region that supports the Realtime Database, such as "us-central1" or
+// "europe-west1".
+func (c *InstanceClient) CreateInstance(
+	ctx context.Context, location, databaseID string) (*Instance, error) {
+
+	if location == "" {
+		return nil, errors.New("location must not be empty")
+	}
+	if err := validateDatabaseID(databaseID); err != nil {
+		return nil, err
+	}
+	req := &internal.Request{
+		Method: http.MethodPost,
+		URL:    fmt.Sprintf("%s/projects/%s/locations/%s/instances", c.endpoint, c.project, location),
+		Body:   internal.NewJSONEntity(map[string]interface{}{"type": UserDatabase}),
+		Opts:   []internal.HTTPOption{internal.WithQueryParam("databaseId", databaseID)},
+	}
+	return c.sendInstanceRequest(ctx, req)
+}
+
+// Instances returns an iterator over the database instances of the project, in all locations.
+func (c *InstanceClient) Instances(ctx context.Context) *InstanceIterator {
+	it := &InstanceIterator{
+		ctx:    ctx,
+		client: c,
+	}
+	it.pageInfo, it.nextFunc = iterator.NewPageInfo(
+		it.fetch,
+		func() int { return len(it.instances) },
+		func() interface{} { b := it.instances; it.instances = nil; return b })
+	it.pageInfo.MaxSize = maxInstancesPerPage
+	return it
+}
+
+func (c *InstanceClient) sendInstanceRequest(ctx context.Context, req *internal.Request) (*Instance, error) {
+	resp, err := c.hc.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var inst Instance
+	if err := resp.Unmarshal(http.StatusOK, &inst); err != nil {
+		return nil, err
+	}
+	return &inst, nil
+}
+
+// InstanceIterator is an iterator over database instances.
+//
+// Also see: https://github.com/GoogleCloudPlatform/google-cloud-go/wiki/Iterator-Guidelines
+type InstanceIterator struct {
+	client    *InstanceClient
+	ctx       context.Context
+	nextFunc  func() error
+	pageInfo  *iterator.PageInfo
+	instances []*Instance
+}
+
+// PageInfo supports pagination. See the google.golang.org/api/iterator package for details.
+// Page size can be determined by the NewPager(...) function described there.
+func (it *InstanceIterator) PageInfo() *iterator.PageInfo { return it.pageInfo }
+
+// Next returns the next result. Its second return value is [iterator.Done] if
+// there are no more results. Once Next returns [iterator.Done], all subsequent
+// calls will return [iterator.Done].
+func (it *InstanceIterator) Next() (*Instance, error) {
+	if err := it.nextFunc(); err != nil {
+		return nil, err
+	}
+	inst := it.instances[0]
+	it.instances = it.instances[1:]
+	return inst, nil
+}
+
+func (it *InstanceIterator) fetch(pageSize int, pageToken string) (string, error) {
+	qp := map[string]string{"pageSize": strconv.Itoa(pageSize)}
+	if pageToken != "" {
+		qp["pageToken"] = pageToken
+	}
+	req := &internal.Request{
+		Method: http.MethodGet,
+		URL:    fmt.Sprintf("%s/projects/%s/locations/-/instances", it.client.endpoint, it.client.project),
+		Opts:   []internal.HTTPOption{internal.WithQueryParams(qp)},
+	}
+	resp, err := it.client.hc.Do(it.ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	var parsed struct {
+		Instances     []*Instance `json:"instances"`
+		NextPageToken string      `json:"nextPageToken"`
+	}
+	if err := resp.Unmarshal(http.StatusOK, &parsed); err != nil {
+		return "", err
+	}
+	it.instances = append(it.instances, parsed.Instances...)
+	return parsed.NextPageToken, nil
+}
+
+func validateDatabaseID(id string) error {
+	if !databaseIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid database ID: %q; must be 6-63 lowercase letters, digits and "+
+			"hyphens, starting with a letter", id)
+	}
+	return nil
+}
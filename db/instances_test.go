@@ -0,0 +1,214 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"firebase.google.com/go/internal"
+	"google.golang.org/api/iterator"
+)
+
+var testInstance = &Instance{
+	Name:        "projects/123/locations/europe-west1/instances/test-db-eu",
+	Project:     "projects/123",
+	DatabaseURL: "https://test-db-eu.europe-west1.firebasedatabase.app",
+	Type:        UserDatabase,
+	State:       Active,
+}
+
+func newInstanceClient(t *testing.T, handler http.HandlerFunc) (*InstanceClient, *httptest.Server) {
+	ts := httptest.NewServer(handler)
+	c, err := NewInstanceClient(context.Background(), &internal.DatabaseInstanceConfig{
+		ProjectID: "test-project",
+		Opts:      testOpts,
+		Version:   "1.2.3",
+	})
+	if err != nil {
+		ts.Close()
+		t.Fatal(err)
+	}
+	c.endpoint = ts.URL
+	return c, ts
+}
+
+func TestNewInstanceClientNoProjectID(t *testing.T) {
+	c, err := NewInstanceClient(context.Background(), &internal.DatabaseInstanceConfig{Opts: testOpts})
+	if c != nil || err == nil {
+		t.Errorf("NewInstanceClient() = (%v, %v); want = (nil, error)", c, err)
+	}
+}
+
+func TestInstance(t *testing.T) {
+	var req *http.Request
+	c, ts := newInstanceClient(t, func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		json.NewEncoder(w).Encode(testInstance)
+	})
+	defer ts.Close()
+
+	inst, err := c.Instance(context.Background(), "test-db-eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inst, testInstance) {
+		t.Errorf("Instance() = %#v; want = %#v", inst, testInstance)
+	}
+	if inst.ID() != "test-db-eu" || inst.Location() != "europe-west1" {
+		t.Errorf("Instance() = (%q, %q); want = (%q, %q)",
+			inst.ID(), inst.Location(), "test-db-eu", "europe-west1")
+	}
+	if req.Method != http.MethodGet {
+		t.Errorf("Method = %q; want = %q", req.Method, http.MethodGet)
+	}
+	wantPath := "/projects/test-project/locations/-/instances/test-db-eu"
+	if req.URL.Path != wantPath {
+		t.Errorf("Path = %q; want = %q", req.URL.Path, wantPath)
+	}
+	if req.Header.Get("Authorization") != "Bearer mock-token" {
+		t.Errorf("Authorization = %q; want = %q", req.Header.Get("Authorization"), "Bearer mock-token")
+	}
+	if req.Header.Get("User-Agent") != testUserAgent {
+		t.Errorf("User-Agent = %q; want = %q", req.Header.Get("User-Agent"), testUserAgent)
+	}
+}
+
+func TestCreateInstance(t *testing.T) {
+	var req *http.Request
+	var body []byte
+	c, ts := newInstanceClient(t, func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = ioutil.ReadAll(r.Body)
+		json.NewEncoder(w).Encode(testInstance)
+	})
+	defer ts.Close()
+
+	inst, err := c.CreateInstance(context.Background(), "europe-west1", "test-db-eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inst, testInstance) {
+		t.Errorf("CreateInstance() = %#v; want = %#v", inst, testInstance)
+	}
+	if req.Method != http.MethodPost {
+		t.Errorf("Method = %q; want = %q", req.Method, http.MethodPost)
+	}
+	wantPath := "/projects/test-project/locations/europe-west1/instances"
+	if req.URL.Path != wantPath {
+		t.Errorf("Path = %q; want = %q", req.URL.Path, wantPath)
+	}
+	if id := req.URL.Query().Get("databaseId"); id != "test-db-eu" {
+		t.Errorf("databaseId = %q; want = %q", id, "test-db-eu")
+	}
+	if string(body) != `{"type":"USER_DATABASE"}` {
+		t.Errorf("Body = %q; want = %q", string(body), `{"type":"USER_DATABASE"}`)
+	}
+}
+
+func TestCreateInstanceInvalidArgs(t *testing.T) {
+	c, ts := newInstanceClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+	})
+	defer ts.Close()
+
+	cases := []struct {
+		location, id string
+	}{
+		{"", "test-db-eu"},
+		{"europe-west1", ""},
+		{"europe-west1", "short"},
+		{"europe-west1", "Upper-case-db"},
+		{"europe-west1", "1-starts-with-digit"},
+		{"europe-west1", "ends-with-hyphen-"},
+		{"europe-west1", "has_underscore"},
+	}
+	for _, tc := range cases {
+		if _, err := c.CreateInstance(context.Background(), tc.location, tc.id); err == nil {
+			t.Errorf("CreateInstance(%q, %q) = nil; want error", tc.location, tc.id)
+		}
+	}
+	if _, err := c.Instance(context.Background(), "a/b"); err == nil {
+		t.Errorf("Instance(%q) = nil; want error", "a/b")
+	}
+}
+
+func TestInstances(t *testing.T) {
+	pages := []map[string]interface{}{
+		{
+			"instances": []*Instance{
+				{Name: "projects/123/locations/us-central1/instances/test-project", Type: DefaultDatabase},
+				{Name: "projects/123/locations/us-central1/instances/test-db-us", Type: UserDatabase},
+			},
+			"nextPageToken": "token1",
+		},
+		{
+			"instances": []*Instance{testInstance},
+		},
+	}
+	var tokens []string
+	c, ts := newInstanceClient(t, func(w http.ResponseWriter, r *http.Request) {
+		wantPath := "/projects/test-project/locations/-/instances"
+		if r.URL.Path != wantPath {
+			t.Errorf("Path = %q; want = %q", r.URL.Path, wantPath)
+		}
+		if size := r.URL.Query().Get("pageSize"); size != "100" {
+			t.Errorf("pageSize = %q; want = %q", size, "100")
+		}
+		tokens = append(tokens, r.URL.Query().Get("pageToken"))
+		json.NewEncoder(w).Encode(pages[len(tokens)-1])
+	})
+	defer ts.Close()
+
+	var ids []string
+	it := c.Instances(context.Background())
+	for {
+		inst, err := it.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, inst.ID())
+	}
+	wantIDs := []string{"test-project", "test-db-us", "test-db-eu"}
+	if !reflect.DeepEqual(ids, wantIDs) {
+		t.Errorf("Instances() = %v; want = %v", ids, wantIDs)
+	}
+	if !reflect.DeepEqual(tokens, []string{"", "token1"}) {
+		t.Errorf("pageToken = %v; want = %v", tokens, []string{"", "token1"})
+	}
+}
+
+func TestInstancesError(t *testing.T) {
+	c, ts := newInstanceClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error": {"code": 403, "message": "permission denied"}}`))
+	})
+	defer ts.Close()
+
+	want := "http error status: 403; reason: permission denied"
+	if _, err := c.Instances(context.Background()).Next(); err == nil || err.Error() != want {
+		t.Errorf("Instances() = %v; want = %q", err, want)
+	}
+	if _, err := c.Instance(context.Background(), "test-db-eu"); err == nil || err.Error() != want {
+		t.Errorf("Instance() = %v; want = %q", err, want)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"firebase.google.com/go/internal"
+	"google.golang.org/api/iterator"
+)
+
+// Keys returns an iterator over the keys of the immediate children of the current database node.
+//
+// Keys are returned in the order used by the Realtime Database when ordering by key. They are
+// retrieved one page at a time, by querying the children ordered by key, starting after the last
+// key of the previous page. Shallow reads cannot be combined with queries, so each page also
+// retrieves the values of its children. Pages that the database rejects as too large to read are
+// split up. If even a single child is too large to read, the remaining keys are listed with a
+// shallow read instead. This makes it possible to list the children of nodes that are too large
+// to be read with Get() or GetShallow().
+//
+// Keys are paged 1000 at a time by default. Use the PageInfo() of the iterator, or
+// iterator.NewPager(), to change the page size and to resume an iteration from a page token.
+func (r *Ref) Keys(ctx context.Context) *KeyIterator {
+	it := &KeyIterator{
+		ctx: ctx,
+		ref: r,
+	}
+	it.pageInfo, it.nextFunc = iterator.NewPageInfo(
+		it.fetch,
+		func() int { return len(it.keys) },
+		func() interface{} { b := it.keys; it.keys = nil; return b })
+	it.pageInfo.MaxSize = defaultQueryPageSize
+	return it
+}
+
+// KeyIterator is an iterator over the child keys of a database node.
+//
+// Also see: https://github.com/GoogleCloudPlatform/google-cloud-go/wiki/Iterator-Guidelines
+type KeyIterator struct {
+	ctx      context.Context
+	ref      *Ref
+	nextFunc func() error
+	pageInfo *iterator.PageInfo
+	keys     []string
+
+	// all holds the sorted child keys listed by a shallow read, once a child is found to be too
+	// large to be read with a query.
+	all sortableNodes
+}
+
+// PageInfo supports pagination. See the google.golang.org/api/iterator package for details.
+// Page size can be determined by the NewPager(...) function described there.
+func (it *KeyIterator) PageInfo() *iterator.PageInfo { return it.pageInfo }
+
+// Next returns the next result. Its second return value is [iterator.Done] if
+// there are no more results. Once Next returns [iterator.Done], all subsequent
+// calls will return [iterator.Done].
+func (it *KeyIterator) Next() (string, error) {
+	if err := it.nextFunc(); err != nil {
+		return "", err
+	}
+	key := it.keys[0]
+	it.keys = it.keys[1:]
+	return key, nil
+}
+
+// fetch retrieves the page of keys that follows the key specified as the page token.
+func (it *KeyIterator) fetch(pageSize int, pageToken string) (string, error) {
+	if pageSize <= 0 {
+		pageSize = defaultQueryPageSize
+	}
+
+	var page sortableNodes
+	more := false
+	if it.all == nil {
+		var err error
+		page, more, err = it.query(pageSize, pageToken)
+		if err == errChildTooBig {
+			err = it.listAll()
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if it.all != nil {
+		page = it.all
+		if pageToken != "" {
+			token := newQueryNode(pageToken, nil, orderByProperty("$key"))
+			idx := sort.Search(len(page), func(i int) bool {
+				return sortableNodes{token, page[i]}.Less(0, 1)
+			})
+			page = page[idx:]
+		}
+		if len(page) > pageSize {
+			page, more = page[:pageSize], true
+		}
+	}
+	for _, n := range page {
+		it.keys = append(it.keys, n.Key())
+	}
+
+	if !more {
+		return "", nil
+	}
+	return page[len(page)-1].Key(), nil
+}
+
+// listAll lists the keys of all children with a shallow read.
+func (it *KeyIterator) listAll() error {
+	resp, err := it.ref.send(it.ctx, "GET", internal.WithQueryParam("shallow", "true"))
+	if err != nil {
+		return err
+	}
+	var result interface{}
+	if err := resp.Unmarshal(http.StatusOK, &result); err != nil {
+		return err
+	}
+
+	children, _ := result.(map[string]interface{})
+	it.all = sortableNodes{}
+	for k := range children {
+		it.all = append(it.all, newQueryNode(k, nil, orderByProperty("$key")))
+	}
+	sort.Sort(it.all)
+	return nil
+}
+
+// errChildTooBig is returned by query when a single child is too large to be read.
+var errChildTooBig = errors.New("child node too large to read")
+
+// query retrieves up to limit children that follow the key specified as the page token, ordered
+// by key, and reports whether there may be more children. The database rejects reads that are
+// too large with a 400 Bad Request response, in which case the query is retried with half the
+// limit, until a single child is requested.
+func (it *KeyIterator) query(limit int, pageToken string) (sortableNodes, bool, error) {
+	qp := map[string]string{"orderBy": `"$key"`}
+	if pageToken != "" {
+		b, err := json.Marshal(pageToken)
+		if err != nil {
+			return nil, false, err
+		}
+		qp["startAfter"] = string(b)
+	}
+
+	for {
+		qp["limitToFirst"] = strconv.Itoa(limit)
+		resp, err := it.ref.send(it.ctx, "GET", internal.WithQueryParams(qp))
+		if err != nil {
+			return nil, false, err
+		}
+		if resp.Status == http.StatusBadRequest {
+			if limit == 1 {
+				return nil, false, errChildTooBig
+			}
+			limit /= 2
+			continue
+		}
+		var result interface{}
+		if err := resp.Unmarshal(http.StatusOK, &result); err != nil {
+			return nil, false, err
+		}
+
+		// Leaf nodes do not have any children.
+		var sn sortableNodes
+		switch result.(type) {
+		case map[string]interface{}, []interface{}:
+			for _, n := range newSortableNodes(result, orderByProperty("$key")) {
+				if n.Value != nil {
+					sn = append(sn, n)
+				}
+			}
+		}
+		sort.Sort(sn)
+		return sn, len(sn) == limit, nil
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"google.golang.org/api/iterator"
+)
+
+// keysServer is a mock database server that serves the children of a node ordered by key. Queries
+// for more than maxLimit children, or for any of the tooBig children, are rejected as too large to
+// read.
+type keysServer struct {
+	keys     []string
+	maxLimit int
+	tooBig   map[string]bool
+	queries  []map[string]string
+}
+
+func (s *keysServer) Start(c *Client) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("shallow") == "true" {
+			s.queries = append(s.queries, map[string]string{"shallow": "true"})
+			result := make(map[string]interface{})
+			for _, k := range s.keys {
+				result[k] = true
+			}
+			b, _ := json.Marshal(result)
+			w.Write(b)
+			return
+		}
+		s.queries = append(s.queries, map[string]string{
+			"orderBy":      query.Get("orderBy"),
+			"startAfter":   query.Get("startAfter"),
+			"limitToFirst": query.Get("limitToFirst"),
+		})
+		var start string
+		json.Unmarshal([]byte(query.Get("startAfter")), &start)
+		idx := 0
+		for i, k := range s.keys {
+			if k == start {
+				idx = i + 1
+			}
+		}
+		limit, _ := strconv.Atoi(query.Get("limitToFirst"))
+		result := make(map[string]interface{})
+		tooBig := s.maxLimit > 0 && limit > s.maxLimit
+		for _, k := range s.keys[idx:] {
+			if len(result) < limit {
+				result[k] = k
+				tooBig = tooBig || s.tooBig[k]
+			}
+		}
+		if tooBig {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "Data requested exceeds the maximum size that can be accessed ` +
+				`with a single request."}`))
+			return
+		}
+		b, _ := json.Marshal(result)
+		w.Write(b)
+	}))
+	c.url = srv.URL
+	return srv
+}
+
+func keysQuery(startAfter, limit string) map[string]string {
+	return map[string]string{"orderBy": `"$key"`, "startAfter": startAfter, "limitToFirst": limit}
+}
+
+func TestKeys(t *testing.T) {
+	mock := &keysServer{keys: []string{"2", "10", "b", "c", "d", "e", "f"}}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	it := testref.Keys(context.Background())
+	it.PageInfo().MaxSize = 3
+	got := collectKeys(t, it)
+
+	if !reflect.DeepEqual(got, mock.keys) {
+		t.Errorf("Keys() = %v; want = %v", got, mock.keys)
+	}
+	wantQueries := []map[string]string{
+		keysQuery("", "3"),
+		keysQuery(`"b"`, "3"),
+		keysQuery(`"e"`, "3"),
+	}
+	if !reflect.DeepEqual(mock.queries, wantQueries) {
+		t.Errorf("Queries = %v; want = %v", mock.queries, wantQueries)
+	}
+}
+
+func TestKeysUnordered(t *testing.T) {
+	mock := &mockServer{
+		Resp: map[string]interface{}{"b": true, "10": true, "2": true, "a": true},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	got := collectKeys(t, testref.Keys(context.Background()))
+	want := []string{"2", "10", "a", "b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %v; want = %v", got, want)
+	}
+	checkOnlyRequest(t, mock.Reqs, &testReq{
+		Method: "GET",
+		Path:   "/peter.json",
+		Query:  map[string]string{"orderBy": `"$key"`, "limitToFirst": "1000"},
+	})
+}
+
+func TestKeysPaged(t *testing.T) {
+	// Queries for more than 2 children are too large to be read.
+	mock := &keysServer{keys: []string{"2", "10", "b", "c", "d"}, maxLimit: 2}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	it := testref.Keys(context.Background())
+	it.PageInfo().MaxSize = 4
+	got := collectKeys(t, it)
+
+	if !reflect.DeepEqual(got, mock.keys) {
+		t.Errorf("Keys() = %v; want = %v", got, mock.keys)
+	}
+	wantQueries := []map[string]string{
+		keysQuery("", "4"),
+		keysQuery("", "2"),
+		keysQuery(`"10"`, "4"),
+		keysQuery(`"10"`, "2"),
+		keysQuery(`"c"`, "4"),
+		keysQuery(`"c"`, "2"),
+	}
+	if !reflect.DeepEqual(mock.queries, wantQueries) {
+		t.Errorf("Queries = %v; want = %v", mock.queries, wantQueries)
+	}
+}
+
+func TestKeysChildTooBig(t *testing.T) {
+	// The child "c" is too large to be read, so the remaining keys are listed with a shallow read.
+	mock := &keysServer{keys: []string{"a", "b", "c", "d", "e"}, tooBig: map[string]bool{"c": true}}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	it := testref.Keys(context.Background())
+	it.PageInfo().MaxSize = 2
+	got := collectKeys(t, it)
+
+	if !reflect.DeepEqual(got, mock.keys) {
+		t.Errorf("Keys() = %v; want = %v", got, mock.keys)
+	}
+	wantQueries := []map[string]string{
+		keysQuery("", "2"),
+		keysQuery(`"b"`, "2"),
+		keysQuery(`"b"`, "1"),
+		{"shallow": "true"},
+	}
+	if !reflect.DeepEqual(mock.queries, wantQueries) {
+		t.Errorf("Queries = %v; want = %v", mock.queries, wantQueries)
+	}
+}
+
+func collectKeys(t *testing.T, it *KeyIterator) []string {
+	var got []string
+	for {
+		k, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, k)
+	}
+	return got
+}
+
+func TestKeysLeafNode(t *testing.T) {
+	for _, resp := range []interface{}{nil, "value", 1} {
+		mock := &mockServer{Resp: resp}
+		srv := mock.Start(client)
+
+		it := testref.Keys(context.Background())
+		if k, err := it.Next(); k != "" || err != iterator.Done {
+			t.Errorf("Keys(%v) = (%q, %v); want = (\"\", %v)", resp, k, err, iterator.Done)
+		}
+		srv.Close()
+	}
+}
+
+func TestKeysPager(t *testing.T) {
+	mock := &keysServer{keys: []string{"a", "b", "c"}}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	pager := iterator.NewPager(testref.Keys(context.Background()), 2, "")
+	var page []string
+	token, err := pager.NextPage(&page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(page, []string{"a", "b"}) || token != "b" {
+		t.Errorf("NextPage() = (%v, %q); want = (%v, %q)", page, token, []string{"a", "b"}, "b")
+	}
+
+	page = nil
+	token, err = pager.NextPage(&page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(page, []string{"c"}) || token != "" {
+		t.Errorf("NextPage() = (%v, %q); want = (%v, %q)", page, token, []string{"c"}, "")
+	}
+
+	// Resuming from a page token.
+	pager = iterator.NewPager(testref.Keys(context.Background()), 2, "a")
+	page = nil
+	if _, err := pager.NextPage(&page); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(page, []string{"b", "c"}) {
+		t.Errorf("NextPage(%q) = %v; want = %v", "a", page, []string{"b", "c"})
+	}
+}
+
+func TestKeysError(t *testing.T) {
+	mock := &mockServer{
+		Resp:   map[string]string{"error": "test error"},
+		Status: http.StatusInternalServerError,
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	want := "http error status: 500; reason: test error"
+	if _, err := testref.Keys(context.Background()).Next(); err == nil || err.Error() != want {
+		t.Errorf("Keys() = %v; want = %q", err, want)
+	}
+}
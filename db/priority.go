@@ -0,0 +1,170 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"firebase.google.com/go/internal"
+)
+
+const (
+	priorityKey = ".priority"
+	valueKey    = ".value"
+)
+
+// SetWithPriority stores the value v in the current database node, and sets the priority of the
+// node.
+//
+// Priorities are used to order child nodes in queries created with OrderByPriority(). A priority
+// must be nil, a number or a string. A nil priority removes any existing priority of the node.
+// The value v is serialized the same way as in Set().
+func (r *Ref) SetWithPriority(ctx context.Context, v interface{}, priority interface{}) error {
+	if err := validatePriority(priority); err != nil {
+		return err
+	}
+	b, err := r.client.getCodec().Marshal(v)
+	if err != nil {
+		return err
+	}
+	var val interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&val); err != nil {
+		return err
+	}
+
+	// Object values carry their priority as a child, while other values are wrapped in an object
+	// along with their priority.
+	if m, ok := val.(map[string]interface{}); ok {
+		m[priorityKey] = priority
+	} else {
+		val = map[string]interface{}{valueKey: val, priorityKey: priority}
+	}
+	body, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.sendWithParams(
+		ctx, "PUT", r.Path, rawJSONEntity(body), r.params, internal.WithQueryParam("print", "silent"))
+	if err != nil {
+		return err
+	}
+	return resp.CheckStatus(http.StatusNoContent)
+}
+
+// SetPriority sets the priority of the current database node, without changing its value.
+//
+// A priority must be nil, a number or a string. A nil priority removes any existing priority of
+// the node.
+func (r *Ref) SetPriority(ctx context.Context, priority interface{}) error {
+	if err := validatePriority(priority); err != nil {
+		return err
+	}
+	resp, err := r.client.sendWithParams(
+		ctx, "PUT", r.priorityPath(), internal.NewJSONEntity(priority), r.params,
+		internal.WithQueryParam("print", "silent"))
+	if err != nil {
+		return err
+	}
+	return resp.CheckStatus(http.StatusNoContent)
+}
+
+// GetPriority retrieves the priority of the current database node.
+//
+// Returns nil if the node does not have a priority. Otherwise returns a float64 or a string.
+func (r *Ref) GetPriority(ctx context.Context) (interface{}, error) {
+	resp, err := r.client.sendWithParams(ctx, "GET", r.priorityPath(), nil, r.params)
+	if err != nil {
+		return nil, err
+	}
+	var priority interface{}
+	if err := resp.Unmarshal(http.StatusOK, &priority); err != nil {
+		return nil, err
+	}
+	return priority, nil
+}
+
+// GetExport retrieves the value at the current database location in the export format, and
+// stores it in the value pointed to by v.
+//
+// In the export format, every node with a priority includes it as a child named ".priority".
+// Values other than objects that have a priority are represented as objects with a ".value" child
+// and a ".priority" child. The value is deserialized the same way as in Get().
+func (r *Ref) GetExport(ctx context.Context, v interface{}) error {
+	resp, err := r.send(ctx, "GET", internal.WithQueryParam("format", "export"))
+	if err != nil {
+		return err
+	}
+	return r.client.unmarshal(resp, http.StatusOK, v)
+}
+
+func (r *Ref) priorityPath() string {
+	if len(r.segs) == 0 {
+		return "/" + priorityKey
+	}
+	return r.Path + "/" + priorityKey
+}
+
+func validatePriority(priority interface{}) error {
+	switch priority.(type) {
+	case nil, string, json.Number,
+		int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return nil
+	}
+	return fmt.Errorf("priority must be nil, a number or a string: %v", priority)
+}
+
+// splitExport separates a value read in the export format into its priority and its plain value.
+func splitExport(val interface{}) (interface{}, interface{}) {
+	m, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, val
+	}
+	priority := m[priorityKey]
+	if v, ok := m[valueKey]; ok {
+		return priority, v
+	}
+	plain := make(map[string]interface{}, len(m))
+	for k, child := range m {
+		if k != priorityKey {
+			_, plain[k] = splitExport(child)
+		}
+	}
+	return priority, plain
+}
+
+// exportChildren removes the priority of a parent node read in the export format, while leaving
+// its child nodes in the export format.
+func exportChildren(val interface{}) interface{} {
+	m, ok := val.(map[string]interface{})
+	if !ok {
+		return val
+	}
+	if v, ok := m[valueKey]; ok {
+		return v
+	}
+	children := make(map[string]interface{}, len(m))
+	for k, child := range m {
+		if k != priorityKey {
+			children[k] = child
+		}
+	}
+	return children
+}
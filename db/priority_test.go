@@ -0,0 +1,203 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSetWithPriority(t *testing.T) {
+	mock := &mockServer{}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	cases := []struct {
+		value    interface{}
+		priority interface{}
+		want     interface{}
+	}{
+		{
+			&person{"Peter Parker", 17},
+			1,
+			map[string]interface{}{"name": "Peter Parker", "age": 17, ".priority": 1},
+		},
+		{"foo", "a", map[string]interface{}{".value": "foo", ".priority": "a"}},
+		{12345678901234567, 2.5, map[string]interface{}{".value": 12345678901234567, ".priority": 2.5}},
+		{true, nil, map[string]interface{}{".value": true, ".priority": nil}},
+	}
+	var want []*testReq
+	for _, tc := range cases {
+		if err := testref.SetWithPriority(context.Background(), tc.value, tc.priority); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, &testReq{
+			Method: "PUT",
+			Path:   "/peter.json",
+			Body:   serialize(tc.want),
+			Query:  map[string]string{"print": "silent"},
+		})
+	}
+	checkAllRequests(t, mock.Reqs, want)
+}
+
+func TestSetPriority(t *testing.T) {
+	mock := &mockServer{}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	if err := testref.SetPriority(context.Background(), "high"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.NewRef("/").SetPriority(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	checkAllRequests(t, mock.Reqs, []*testReq{
+		{
+			Method: "PUT",
+			Path:   "/peter/.priority.json",
+			Body:   serialize("high"),
+			Query:  map[string]string{"print": "silent"},
+		},
+		{
+			Method: "PUT",
+			Path:   "/.priority.json",
+			Body:   serialize(nil),
+			Query:  map[string]string{"print": "silent"},
+		},
+	})
+}
+
+func TestInvalidPriority(t *testing.T) {
+	mock := &mockServer{}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	cases := []interface{}{true, map[string]interface{}{"a": 1}, []int{1}, ServerTimestamp}
+	for _, p := range cases {
+		if err := testref.SetPriority(context.Background(), p); err == nil {
+			t.Errorf("SetPriority(%v) = nil; want error", p)
+		}
+		if err := testref.SetWithPriority(context.Background(), "foo", p); err == nil {
+			t.Errorf("SetWithPriority(%v) = nil; want error", p)
+		}
+	}
+	if err := testref.Child("$invalid").SetPriority(context.Background(), 1); err == nil {
+		t.Errorf("SetPriority(invalid path) = nil; want error")
+	}
+	if len(mock.Reqs) != 0 {
+		t.Errorf("Requests = %v; want none", mock.Reqs)
+	}
+}
+
+func TestGetPriority(t *testing.T) {
+	mock := &mockServer{Resp: 1.5}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	got, err := testref.GetPriority(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 1.5 {
+		t.Errorf("GetPriority() = %v; want = %v", got, 1.5)
+	}
+	checkOnlyRequest(t, mock.Reqs, &testReq{Method: "GET", Path: "/peter/.priority.json"})
+}
+
+func TestGetExport(t *testing.T) {
+	want := map[string]interface{}{
+		".priority": 1.0,
+		"name":      map[string]interface{}{".value": "Peter Parker", ".priority": "a"},
+	}
+	mock := &mockServer{Resp: want}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	var got map[string]interface{}
+	if err := testref.GetExport(context.Background(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetExport() = %v; want = %v", got, want)
+	}
+	checkOnlyRequest(t, mock.Reqs, &testReq{
+		Method: "GET",
+		Path:   "/peter.json",
+		Query:  map[string]string{"format": "export"},
+	})
+}
+
+func TestPriorityQueryGetOrdered(t *testing.T) {
+	mock := &mockServer{Resp: map[string]interface{}{
+		".priority": "parent",
+		"d":         map[string]interface{}{".value": "dv", ".priority": "b"},
+		"c":         map[string]interface{}{".value": 3, ".priority": 10},
+		"b":         map[string]interface{}{"name": "bv", ".priority": 2},
+		"a":         "av",
+		"e":         map[string]interface{}{".value": "ev", ".priority": "a"},
+	}}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	result, err := testref.OrderByPriority().LimitToFirst(5).GetOrdered(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantKeys := []string{"a", "b", "c", "e", "d"}
+	wantVals := []interface{}{"av", map[string]interface{}{"name": "bv"}, 3.0, "ev", "dv"}
+	var gotKeys []string
+	var gotVals []interface{}
+	for _, r := range result {
+		var v interface{}
+		if err := r.Unmarshal(&v); err != nil {
+			t.Fatal(err)
+		}
+		gotKeys = append(gotKeys, r.Key())
+		gotVals = append(gotVals, v)
+	}
+	if !reflect.DeepEqual(gotKeys, wantKeys) {
+		t.Errorf("GetOrdered() keys = %v; want = %v", gotKeys, wantKeys)
+	}
+	if !reflect.DeepEqual(gotVals, wantVals) {
+		t.Errorf("GetOrdered() values = %v; want = %v", gotVals, wantVals)
+	}
+	checkOnlyRequest(t, mock.Reqs, &testReq{
+		Method: "GET",
+		Path:   "/peter.json",
+		Query: map[string]string{
+			"orderBy":      "\"$priority\"",
+			"limitToFirst": "5",
+			"format":       "export",
+		},
+	})
+}
+
+func TestPriorityQueryGet(t *testing.T) {
+	mock := &mockServer{Resp: map[string]interface{}{"a": "av"}}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	var got map[string]interface{}
+	if err := testref.OrderByPriority().StartAt(1).Get(context.Background(), &got); err != nil {
+		t.Fatal(err)
+	}
+	checkOnlyRequest(t, mock.Reqs, &testReq{
+		Method: "GET",
+		Path:   "/peter.json",
+		Query:  map[string]string{"orderBy": "\"$priority\"", "startAt": "1"},
+	})
+}
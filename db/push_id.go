@@ -0,0 +1,110 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// pushChars are the characters used in push IDs, in ascending ASCII order so that the IDs sort
+// lexicographically.
+const pushChars = "-0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ_abcdefghijklmnopqrstuvwxyz"
+
+const (
+	pushTimeChars = 8
+	pushRandChars = 12
+)
+
+var defaultPushIDGenerator = newPushIDGenerator()
+
+// NewPushID generates a new push ID, without making any calls to the database.
+//
+// Push IDs are 20 characters long, and are generated using the same algorithm as the Firebase
+// client SDKs. The first 8 characters encode the current time in milliseconds, and the remaining
+// 12 characters are random. IDs therefore sort chronologically, and IDs generated within the same
+// millisecond by this process sort in the order they were generated.
+func NewPushID() string {
+	return defaultPushIDGenerator.next()
+}
+
+type pushIDGenerator struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	rnd      io.Reader
+	lastTime int64
+	lastRand [pushRandChars]int
+}
+
+func newPushIDGenerator() *pushIDGenerator {
+	return &pushIDGenerator{
+		now: time.Now,
+		rnd: rand.Reader,
+	}
+}
+
+func (g *pushIDGenerator) next() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Within the same millisecond, or if the clock goes backwards, the last ID is incremented by
+	// one instead of generating a new random suffix. This keeps the IDs strictly increasing.
+	now := g.now().UnixNano() / int64(time.Millisecond)
+	if now > g.lastTime {
+		g.lastTime = now
+		g.randomize()
+	} else if !g.increment() {
+		g.lastTime++
+		g.randomize()
+	}
+
+	var id [pushTimeChars + pushRandChars]byte
+	ts := g.lastTime
+	for i := pushTimeChars - 1; i >= 0; i-- {
+		id[i] = pushChars[ts%64]
+		ts /= 64
+	}
+	for i, r := range g.lastRand {
+		id[pushTimeChars+i] = pushChars[r]
+	}
+	return string(id[:])
+}
+
+// randomize draws the 72 random bits of a new suffix from a cryptographically secure source, so
+// that push IDs cannot be predicted from one another.
+func (g *pushIDGenerator) randomize() {
+	var b [pushRandChars]byte
+	if _, err := io.ReadFull(g.rnd, b[:]); err != nil {
+		panic(fmt.Sprintf("db: failed to generate push ID: %v", err))
+	}
+	for i, v := range b {
+		g.lastRand[i] = int(v % 64)
+	}
+}
+
+// increment adds one to the random suffix of the last ID. Returns false if the suffix overflows.
+func (g *pushIDGenerator) increment() bool {
+	for i := pushRandChars - 1; i >= 0; i-- {
+		if g.lastRand[i] < 63 {
+			g.lastRand[i]++
+			return true
+		}
+		g.lastRand[i] = 0
+	}
+	return false
+}
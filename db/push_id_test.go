@@ -0,0 +1,160 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewPushID(t *testing.T) {
+	seen := make(map[string]bool)
+	var last string
+	for i := 0; i < 1000; i++ {
+		id := NewPushID()
+		if len(id) != 20 {
+			t.Fatalf("NewPushID() = %q; want 20 characters", id)
+		}
+		for _, ch := range id {
+			if !strings.ContainsRune(pushChars, ch) {
+				t.Fatalf("NewPushID() = %q; contains invalid character %q", id, ch)
+			}
+		}
+		if id <= last {
+			t.Errorf("NewPushID() = %q; want > %q", id, last)
+		}
+		if seen[id] {
+			t.Errorf("NewPushID() = %q; duplicate ID", id)
+		}
+		seen[id] = true
+		last = id
+	}
+}
+
+func TestPushIDTimestamp(t *testing.T) {
+	g := newPushIDGenerator()
+	g.now = func() time.Time { return time.Unix(0, 0) }
+	if id := g.next(); id[:8] != "--------" {
+		t.Errorf("next() = %q; want prefix %q", id, "--------")
+	}
+
+	g.now = func() time.Time { return time.Unix(1546300800, 123000000) }
+	// 1546300800123 ms in base 64, most significant digit first: 0, 22, 32, 6, 45, 27, 49, 59.
+	if id := g.next(); id[:8] != "-LV5hQlv" {
+		t.Errorf("next() = %q; want prefix %q", id, "-LV5hQlv")
+	}
+}
+
+func TestPushIDSameMillisecond(t *testing.T) {
+	now := time.Unix(1546300800, 0)
+	g := newPushIDGenerator()
+	g.now = func() time.Time { return now }
+	first := g.next()
+	second := g.next()
+	if first[:8] != second[:8] {
+		t.Errorf("next() timestamps = (%q, %q); want equal", first[:8], second[:8])
+	}
+	if second <= first {
+		t.Errorf("next() = %q; want > %q", second, first)
+	}
+
+	// Suffix overflow moves on to the next millisecond.
+	for i := range g.lastRand {
+		g.lastRand[i] = 63
+	}
+	third := g.next()
+	if third[:8] <= second[:8] {
+		t.Errorf("next() = %q; want timestamp > %q", third, second[:8])
+	}
+
+	// Clock moving backwards does not break the ordering.
+	now = now.Add(-time.Hour)
+	if fourth := g.next(); fourth <= third {
+		t.Errorf("next() = %q; want > %q", fourth, third)
+	}
+}
+
+func TestPushIDRandomSuffix(t *testing.T) {
+	g := &pushIDGenerator{
+		now: func() time.Time { return time.Unix(1, 0) },
+		rnd: bytes.NewReader([]byte{0, 1, 2, 63, 64, 65, 127, 128, 191, 192, 254, 255}),
+	}
+	if id := g.next(); id[8:] != "-01z-0z-z-yz" {
+		t.Errorf("next() = %q; want suffix %q", id, "-01z-0z-z-yz")
+	}
+
+	// Running out of random bytes is not recoverable.
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("next() did not panic; want panic")
+		}
+	}()
+	g.now = func() time.Time { return time.Unix(2, 0) }
+	g.next()
+}
+
+func TestNewChildRef(t *testing.T) {
+	first := testref.NewChildRef()
+	second := testref.NewChildRef()
+	if len(first.Key) != 20 || first.Path != "/peter/"+first.Key {
+		t.Errorf("NewChildRef() = {Key: %q, Path: %q}; want push ID child of /peter", first.Key, first.Path)
+	}
+	if second.Key <= first.Key {
+		t.Errorf("NewChildRef() = %q; want > %q", second.Key, first.Key)
+	}
+}
+
+func TestPushWithKey(t *testing.T) {
+	mock := &mockServer{}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	want := map[string]interface{}{"name": "Peter Parker", "age": float64(17)}
+	child, err := testref.PushWithKey(context.Background(), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(child.Key) != 20 {
+		t.Errorf("PushWithKey() = %q; want push ID", child.Key)
+	}
+	checkOnlyRequest(t, mock.Reqs, &testReq{
+		Method: "PUT",
+		Path:   "/peter/" + child.Key + ".json",
+		Body:   serialize(want),
+		Query:  map[string]string{"print": "silent"},
+	})
+}
+
+func TestPushWithKeyError(t *testing.T) {
+	mock := &mockServer{
+		Resp:   map[string]string{"error": "test error"},
+		Status: http.StatusUnauthorized,
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	child, err := testref.PushWithKey(context.Background(), nil)
+	want := "http error status: 401; reason: test error"
+	if child != nil || err == nil || err.Error() != want {
+		t.Errorf("PushWithKey() = (%v, %v); want = (nil, %q)", child, err, want)
+	}
+	if len(mock.Reqs) != 1 || string(mock.Reqs[0].Body) != `""` {
+		t.Errorf("PushWithKey() requests = %v; want body %q", mock.Reqs, `""`)
+	}
+}
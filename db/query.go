@@ -41,31 +41,92 @@ type QueryNode interface {
 // final result is returned by the server as an unordered collection. Therefore the values read
 // from a Query instance are not ordered.
 type Query struct {
-	client              *Client
-	path                string
-	order               orderBy
-	limFirst, limLast   int
-	start, end, equalTo interface{}
+	client            *Client
+	path              string
+	order             orderBy
+	limFirst, limLast int
+	start, end        *queryBound
+	equalTo           *queryBound
+	params            requestParams
+}
+
+// queryBound is a range constraint on the index of a Query, with an optional child key that
+// breaks ties between child nodes with the same index value.
+type queryBound struct {
+	value     interface{}
+	key       *string
+	exclusive bool
 }
 
 // StartAt returns a shallow copy of the Query with v set as a lower bound of a range query.
 //
 // The resulting Query will only return child nodes with a value greater than or equal to v.
 func (q *Query) StartAt(v interface{}) *Query {
-	q2 := &Query{}
-	*q2 = *q
-	q2.start = v
-	return q2
+	return q.withStart(&queryBound{value: v})
+}
+
+// StartAtWithKey returns a shallow copy of the Query with v and key set as a lower bound of a
+// range query.
+//
+// The resulting Query will only return child nodes with a value greater than v, and the child
+// nodes with a value equal to v whose key is greater than or equal to key. This makes it possible
+// to paginate through child nodes that share the same value. The key argument is not supported
+// when ordering by key.
+func (q *Query) StartAtWithKey(v interface{}, key string) *Query {
+	return q.withStart(&queryBound{value: v, key: &key})
+}
+
+// StartAfter returns a shallow copy of the Query with v set as an exclusive lower bound of a range
+// query.
+//
+// The resulting Query will only return child nodes with a value greater than v.
+func (q *Query) StartAfter(v interface{}) *Query {
+	return q.withStart(&queryBound{value: v, exclusive: true})
+}
+
+// StartAfterWithKey returns a shallow copy of the Query with v and key set as an exclusive lower
+// bound of a range query.
+//
+// The resulting Query will only return child nodes with a value greater than v, and the child
+// nodes with a value equal to v whose key is greater than key. The key argument is not supported
+// when ordering by key.
+func (q *Query) StartAfterWithKey(v interface{}, key string) *Query {
+	return q.withStart(&queryBound{value: v, key: &key, exclusive: true})
 }
 
 // EndAt returns a shallow copy of the Query with v set as a upper bound of a range query.
 //
 // The resulting Query will only return child nodes with a value less than or equal to v.
 func (q *Query) EndAt(v interface{}) *Query {
-	q2 := &Query{}
-	*q2 = *q
-	q2.end = v
-	return q2
+	return q.withEnd(&queryBound{value: v})
+}
+
+// EndAtWithKey returns a shallow copy of the Query with v and key set as an upper bound of a range
+// query.
+//
+// The resulting Query will only return child nodes with a value less than v, and the child nodes
+// with a value equal to v whose key is less than or equal to key. The key argument is not
+// supported when ordering by key.
+func (q *Query) EndAtWithKey(v interface{}, key string) *Query {
+	return q.withEnd(&queryBound{value: v, key: &key})
+}
+
+// EndBefore returns a shallow copy of the Query with v set as an exclusive upper bound of a range
+// query.
+//
+// The resulting Query will only return child nodes with a value less than v.
+func (q *Query) EndBefore(v interface{}) *Query {
+	return q.withEnd(&queryBound{value: v, exclusive: true})
+}
+
+// EndBeforeWithKey returns a shallow copy of the Query with v and key set as an exclusive upper
+// bound of a range query.
+//
+// The resulting Query will only return child nodes with a value less than v, and the child nodes
+// with a value equal to v whose key is less than key. The key argument is not supported when
+// ordering by key.
+func (q *Query) EndBeforeWithKey(v interface{}, key string) *Query {
+	return q.withEnd(&queryBound{value: v, key: &key, exclusive: true})
 }
 
 // EqualTo returns a shallow copy of the Query with v set as an equals constraint.
@@ -74,7 +135,32 @@ func (q *Query) EndAt(v interface{}) *Query {
 func (q *Query) EqualTo(v interface{}) *Query {
 	q2 := &Query{}
 	*q2 = *q
-	q2.equalTo = v
+	q2.equalTo = &queryBound{value: v}
+	return q2
+}
+
+// EqualToWithKey returns a shallow copy of the Query with v and key set as an equals constraint.
+//
+// The resulting Query will only return the child node with the given key, if its value equals to
+// v. The key argument is not supported when ordering by key.
+func (q *Query) EqualToWithKey(v interface{}, key string) *Query {
+	q2 := &Query{}
+	*q2 = *q
+	q2.equalTo = &queryBound{value: v, key: &key}
+	return q2
+}
+
+func (q *Query) withStart(b *queryBound) *Query {
+	q2 := &Query{}
+	*q2 = *q
+	q2.start = b
+	return q2
+}
+
+func (q *Query) withEnd(b *queryBound) *Query {
+	q2 := &Query{}
+	*q2 = *q
+	q2.end = b
 	return q2
 }
 
@@ -105,34 +191,59 @@ func (q *Query) LimitToLast(n int) *Query {
 // Despite the ordering constraint of the Query, results are not stored in any particular order
 // in v. Use GetOrdered() to obtain ordered results.
 func (q *Query) Get(ctx context.Context, v interface{}) error {
+	return q.get(ctx, v, false)
+}
+
+func (q *Query) get(ctx context.Context, v interface{}, export bool) error {
 	qp := make(map[string]string)
 	if err := initQueryParams(q, qp); err != nil {
 		return err
 	}
-	resp, err := q.client.send(ctx, "GET", q.path, nil, internal.WithQueryParams(qp))
+	if export {
+		qp["format"] = "export"
+	}
+	resp, err := q.client.sendWithParams(ctx, "GET", q.path, nil, q.params, internal.WithQueryParams(qp))
 	if err != nil {
 		return err
 	}
-	return resp.Unmarshal(http.StatusOK, v)
+	return q.client.unmarshal(resp, http.StatusOK, v)
 }
 
 // GetOrdered executes the Query and returns the results as an ordered slice.
 func (q *Query) GetOrdered(ctx context.Context) ([]QueryNode, error) {
+	sn, err := q.getSorted(ctx)
+	if err != nil || sn == nil {
+		return nil, err
+	}
+
+	result := make([]QueryNode, len(sn))
+	for i, v := range sn {
+		result[i] = v
+	}
+	return result, nil
+}
+
+func (q *Query) getSorted(ctx context.Context) (sortableNodes, error) {
+	// Priorities are only included in the results when they are read in the export format.
+	byPriority := q.order == orderByProperty("$priority")
 	var temp interface{}
-	if err := q.Get(ctx, &temp); err != nil {
+	if err := q.get(ctx, &temp, byPriority); err != nil {
 		return nil, err
 	}
+	if byPriority {
+		temp = exportChildren(temp)
+	}
 	if temp == nil {
 		return nil, nil
 	}
 
 	sn := newSortableNodes(temp, q.order)
 	sort.Sort(sn)
-	result := make([]QueryNode, len(sn))
-	for i, v := range sn {
-		result[i] = v
+	codec := q.client.getCodec()
+	for _, n := range sn {
+		n.codec = codec
 	}
-	return result, nil
+	return sn, nil
 }
 
 // OrderByChild returns a Query that orders data by child values before applying filters.
@@ -162,11 +273,21 @@ func (r *Ref) OrderByValue() *Query {
 	return newQuery(r, orderByProperty("$value"))
 }
 
+// OrderByPriority returns a Query that orders data by priority before applying filters.
+//
+// Child nodes without a priority come first, followed by the nodes with numeric priorities in
+// ascending order, and the nodes with string priorities in lexicographic order. Nodes with the
+// same priority are ordered by key.
+func (r *Ref) OrderByPriority() *Query {
+	return newQuery(r, orderByProperty("$priority"))
+}
+
 func newQuery(r *Ref, ob orderBy) *Query {
 	return &Query{
 		client: r.client,
 		path:   r.Path,
 		order:  ob,
+		params: r.params,
 	}
 }
 
@@ -191,24 +312,55 @@ func initQueryParams(q *Query, qp map[string]string) error {
 		qp["limitToLast"] = strconv.Itoa(q.limLast)
 	}
 
-	if err := encodeFilter("startAt", q.start, qp); err != nil {
+	byKey := q.order == orderByProperty("$key")
+	if q.equalTo != nil && q.equalTo.key != nil {
+		// Equality constraints with a key are expressed as a range with identical bounds.
+		if q.start != nil || q.end != nil {
+			return fmt.Errorf("cannot combine an equals constraint with a key and a range constraint")
+		}
+		if err := encodeBound("startAt", "startAfter", q.equalTo, byKey, qp); err != nil {
+			return err
+		}
+		return encodeBound("endAt", "endBefore", q.equalTo, byKey, qp)
+	}
+
+	if err := encodeBound("startAt", "startAfter", q.start, byKey, qp); err != nil {
 		return err
 	}
-	if err := encodeFilter("endAt", q.end, qp); err != nil {
+	if err := encodeBound("endAt", "endBefore", q.end, byKey, qp); err != nil {
 		return err
 	}
-	return encodeFilter("equalTo", q.equalTo, qp)
+	return encodeBound("equalTo", "", q.equalTo, byKey, qp)
 }
 
-func encodeFilter(key string, val interface{}, m map[string]string) error {
-	if val == nil {
+// encodeBound encodes a range constraint as a REST query parameter. The value is encoded as JSON,
+// followed by a comma and the JSON-encoded key when a key is specified (e.g. startAt=10,"m1").
+// This two-argument form mirrors the optional key argument of the client SDKs' startAt(), endAt()
+// and equalTo() methods. See https://firebase.google.com/docs/database/rest/retrieve-data for the
+// REST query parameters.
+func encodeBound(key, exclusiveKey string, b *queryBound, byKey bool, m map[string]string) error {
+	if b == nil || (b.value == nil && b.key == nil) {
 		return nil
 	}
-	b, err := json.Marshal(val)
+	if b.key != nil && byKey {
+		return fmt.Errorf("cannot specify a key for %s when ordering by key", key)
+	}
+	v, err := json.Marshal(b.value)
 	if err != nil {
 		return err
 	}
-	m[key] = string(b)
+	param := string(v)
+	if b.key != nil {
+		k, err := json.Marshal(*b.key)
+		if err != nil {
+			return err
+		}
+		param += "," + string(k)
+	}
+	if b.exclusive {
+		key = exclusiveKey
+	}
+	m[key] = param
 	return nil
 }
 
@@ -299,13 +451,15 @@ type queryNodeImpl struct {
 	Value     interface{}
 	Index     interface{}
 	IndexType int
+	codec     Codec
 }
 
 func (q *queryNodeImpl) Key() string {
 	if q.CompKey.Str != nil {
 		return *q.CompKey.Str
 	}
-	// Numeric keys in queryNodeImpl are always array indices, and can be safely converted into int.
+	// Numeric keys in queryNodeImpl are either array indices, or string keys that represent 32-bit
+	// integers (see newChildKey). Both kinds can be safely converted back into int.
 	return strconv.Itoa(int(*q.CompKey.Num))
 }
 
@@ -314,23 +468,42 @@ func (q *queryNodeImpl) Unmarshal(v interface{}) error {
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(b, v)
+	if q.codec == nil {
+		return json.Unmarshal(b, v)
+	}
+	return q.codec.Unmarshal(b, v)
+}
+
+// newChildKey creates a comparableKey from the key of a child node.
+//
+// Keys that represent 32-bit integers are compared numerically, and are ordered before all other
+// keys, which are compared lexicographically. This is consistent with how the Firebase Realtime
+// Database orders child keys.
+func newChildKey(key interface{}) *comparableKey {
+	if s, ok := key.(string); ok {
+		if i, err := strconv.ParseInt(s, 10, 32); err == nil && strconv.FormatInt(i, 10) == s {
+			return newComparableKey(int(i))
+		}
+	}
+	return newComparableKey(key)
 }
 
 func newQueryNode(key, val interface{}, order orderBy) *queryNodeImpl {
+	// When ordering by key, the index is left nil so that nodes are compared by their keys.
 	var index interface{}
 	if prop, ok := order.(orderByProperty); ok {
 		if prop == "$value" {
 			index = val
-		} else {
-			index = key
+		} else if prop == "$priority" {
+			index, val = splitExport(val)
 		}
 	} else {
 		path := order.(orderByChild)
 		index = extractChildValue(val, string(path))
 	}
+	index = resolveServerValue(index)
 	return &queryNodeImpl{
-		CompKey:   newComparableKey(key),
+		CompKey:   newChildKey(key),
 		Value:     val,
 		Index:     index,
 		IndexType: getIndexType(index),
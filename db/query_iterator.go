@@ -0,0 +1,170 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/api/iterator"
+)
+
+const defaultQueryPageSize = 1000
+
+// Iterator returns an iterator over the results of the Query.
+//
+// The iterator retrieves results from the server one page at a time, by executing the Query with a
+// limitToFirst constraint, and a key-based cursor that starts each page right after the last child
+// node of the previous page. Child nodes are returned in the order specified by the Query. This
+// makes it possible to read query results that are too large to be retrieved in a single request.
+//
+// The Query must not have a limit constraint set. Results are paged 1000 child nodes at a time by
+// default. Use the PageInfo() of the iterator, or iterator.NewPager(), to change the page size and
+// to resume an iteration from a page token.
+func (q *Query) Iterator(ctx context.Context) *QueryIterator {
+	it := &QueryIterator{
+		ctx:   ctx,
+		query: q,
+	}
+	it.pageInfo, it.nextFunc = iterator.NewPageInfo(
+		it.fetch,
+		func() int { return len(it.nodes) },
+		func() interface{} { b := it.nodes; it.nodes = nil; return b })
+	it.pageInfo.MaxSize = defaultQueryPageSize
+	return it
+}
+
+// QueryIterator is an iterator over the results of a Query.
+//
+// Also see: https://github.com/GoogleCloudPlatform/google-cloud-go/wiki/Iterator-Guidelines
+type QueryIterator struct {
+	ctx      context.Context
+	query    *Query
+	nextFunc func() error
+	pageInfo *iterator.PageInfo
+	nodes    []QueryNode
+}
+
+// PageInfo supports pagination. See the google.golang.org/api/iterator package for details.
+// Page size can be determined by the NewPager(...) function described there.
+func (it *QueryIterator) PageInfo() *iterator.PageInfo { return it.pageInfo }
+
+// Next returns the next result. Its second return value is [iterator.Done] if
+// there are no more results. Once Next returns [iterator.Done], all subsequent
+// calls will return [iterator.Done].
+func (it *QueryIterator) Next() (QueryNode, error) {
+	if err := it.nextFunc(); err != nil {
+		return nil, err
+	}
+	node := it.nodes[0]
+	it.nodes = it.nodes[1:]
+	return node, nil
+}
+
+func (it *QueryIterator) fetch(pageSize int, pageToken string) (string, error) {
+	if pageSize <= 0 {
+		pageSize = defaultQueryPageSize
+	}
+	q, err := it.pageQuery(pageSize, pageToken)
+	if err != nil {
+		return "", err
+	}
+
+	sn, err := q.getSorted(it.ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// A short page indicates that there are no more results.
+	var token string
+	if len(sn) >= pageSize {
+		if token, err = newPageToken(sn[len(sn)-1], q.order); err != nil {
+			return "", err
+		}
+	}
+	for _, n := range sn {
+		it.nodes = append(it.nodes, n)
+	}
+	return token, nil
+}
+
+// pageQuery returns a copy of the Query, which retrieves the page of results identified by the
+// given page size and page token.
+func (it *QueryIterator) pageQuery(pageSize int, pageToken string) (*Query, error) {
+	if it.query.limFirst != 0 || it.query.limLast != 0 {
+		return nil, fmt.Errorf("cannot iterate over a query with a limit constraint")
+	}
+
+	q := &Query{}
+	*q = *it.query
+	q.limFirst = pageSize
+	if q.equalTo != nil {
+		// Equality constraints are expressed as a range with identical bounds, so that the lower
+		// bound can be replaced by the page cursor.
+		if q.start != nil || q.end != nil {
+			return nil, fmt.Errorf("cannot combine an equals constraint and a range constraint")
+		}
+		q.start, q.end, q.equalTo = q.equalTo, q.equalTo, nil
+	}
+	if pageToken == "" {
+		return q, nil
+	}
+
+	c, err := decodePageToken(pageToken)
+	if err != nil {
+		return nil, err
+	}
+	if q.order == orderByProperty("$key") {
+		q.start = &queryBound{value: c.Key, exclusive: true}
+	} else {
+		q.start = &queryBound{value: c.Value, key: &c.Key, exclusive: true}
+	}
+	return q, nil
+}
+
+// pageCursor identifies the last child node of a page of query results.
+type pageCursor struct {
+	Value interface{} `json:"v"`
+	Key   string      `json:"k"`
+}
+
+func newPageToken(last *queryNodeImpl, order orderBy) (string, error) {
+	if last.IndexType == typeObject {
+		return "", fmt.Errorf("cannot paginate past child node %q with an object value", last.Key())
+	}
+	c := &pageCursor{Key: last.Key()}
+	if order != orderByProperty("$key") {
+		c.Value = last.Index
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodePageToken(token string) (*pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token: %q", token)
+	}
+	var c pageCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("invalid page token: %q", token)
+	}
+	return &c, nil
+}
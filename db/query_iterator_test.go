@@ -0,0 +1,259 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/iterator"
+)
+
+func TestQueryIterator(t *testing.T) {
+	mock := &mockServer{
+		Resps: []interface{}{
+			map[string]interface{}{"bob": person{"bob", 20}, "charlie": person{"charlie", 15}},
+			map[string]interface{}{"alice": person{"alice", 30}, "dave": person{"dave", 30}},
+			map[string]interface{}{"ernie": person{"ernie", 40}},
+		},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	it := testref.OrderByChild("age").Iterator(context.Background())
+	it.PageInfo().MaxSize = 2
+	var gotKeys []string
+	for {
+		n, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p person
+		if err := n.Unmarshal(&p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Name != n.Key() {
+			t.Errorf("Unmarshal() = %q; want = %q", p.Name, n.Key())
+		}
+		gotKeys = append(gotKeys, n.Key())
+	}
+
+	wantKeys := []string{"charlie", "bob", "alice", "dave", "ernie"}
+	if !reflect.DeepEqual(gotKeys, wantKeys) {
+		t.Errorf("Iterator() = %v; want = %v", gotKeys, wantKeys)
+	}
+	if _, err := it.Next(); err != iterator.Done {
+		t.Errorf("Next() = %v; want = %v", err, iterator.Done)
+	}
+	checkAllRequests(t, mock.Reqs, []*testReq{
+		{
+			Method: "GET",
+			Path:   "/peter.json",
+			Query:  map[string]string{"orderBy": "\"age\"", "limitToFirst": "2"},
+		},
+		{
+			Method: "GET",
+			Path:   "/peter.json",
+			Query:  map[string]string{"orderBy": "\"age\"", "limitToFirst": "2", "startAfter": "20,\"bob\""},
+		},
+		{
+			Method: "GET",
+			Path:   "/peter.json",
+			Query:  map[string]string{"orderBy": "\"age\"", "limitToFirst": "2", "startAfter": "30,\"dave\""},
+		},
+	})
+}
+
+func TestQueryIteratorPager(t *testing.T) {
+	mock := &mockServer{
+		Resps: []interface{}{
+			map[string]interface{}{"a": 1, "b": 2},
+			map[string]interface{}{"c": 3, "d": 4},
+			nil,
+		},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	it := testref.OrderByKey().EndAt("z").Iterator(context.Background())
+	pager := iterator.NewPager(it, 2, "")
+	var pages [][]string
+	for {
+		var nodes []QueryNode
+		token, err := pager.NextPage(&nodes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, n := range nodes {
+			keys = append(keys, n.Key())
+		}
+		pages = append(pages, keys)
+		if token == "" {
+			break
+		}
+	}
+
+	want := [][]string{{"a", "b"}, {"c", "d"}, nil}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("NextPage() = %v; want = %v", pages, want)
+	}
+	checkAllRequests(t, mock.Reqs, []*testReq{
+		{
+			Method: "GET",
+			Path:   "/peter.json",
+			Query:  map[string]string{"orderBy": "\"$key\"", "limitToFirst": "2", "endAt": "\"z\""},
+		},
+		{
+			Method: "GET",
+			Path:   "/peter.json",
+			Query: map[string]string{
+				"orderBy": "\"$key\"", "limitToFirst": "2", "endAt": "\"z\"", "startAfter": "\"b\"",
+			},
+		},
+		{
+			Method: "GET",
+			Path:   "/peter.json",
+			Query: map[string]string{
+				"orderBy": "\"$key\"", "limitToFirst": "2", "endAt": "\"z\"", "startAfter": "\"d\"",
+			},
+		},
+	})
+}
+
+func TestQueryIteratorEqualTo(t *testing.T) {
+	mock := &mockServer{
+		Resps: []interface{}{
+			map[string]interface{}{"k1": "x", "k2": "x"},
+			map[string]interface{}{"k3": "x"},
+		},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	it := testref.OrderByValue().EqualTo("x").Iterator(context.Background())
+	it.PageInfo().MaxSize = 2
+	var gotKeys []string
+	for {
+		n, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotKeys = append(gotKeys, n.Key())
+	}
+
+	wantKeys := []string{"k1", "k2", "k3"}
+	if !reflect.DeepEqual(gotKeys, wantKeys) {
+		t.Errorf("Iterator() = %v; want = %v", gotKeys, wantKeys)
+	}
+	checkAllRequests(t, mock.Reqs, []*testReq{
+		{
+			Method: "GET",
+			Path:   "/peter.json",
+			Query: map[string]string{
+				"orderBy": "\"$value\"", "limitToFirst": "2", "startAt": "\"x\"", "endAt": "\"x\"",
+			},
+		},
+		{
+			Method: "GET",
+			Path:   "/peter.json",
+			Query: map[string]string{
+				"orderBy": "\"$value\"", "limitToFirst": "2", "startAfter": "\"x\",\"k2\"", "endAt": "\"x\"",
+			},
+		},
+	})
+}
+
+func TestQueryIteratorResume(t *testing.T) {
+	mock := &mockServer{
+		Resps: []interface{}{
+			map[string]interface{}{"k1": false, "k2": true},
+			map[string]interface{}{"k3": true},
+		},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	it := testref.OrderByValue().Iterator(context.Background())
+	it.PageInfo().MaxSize = 2
+	for i := 0; i < 2; i++ {
+		if _, err := it.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token := it.PageInfo().Token
+	if token == "" {
+		t.Fatalf("PageInfo().Token = %q; want non-empty", token)
+	}
+
+	resumed := testref.OrderByValue().Iterator(context.Background())
+	resumed.PageInfo().MaxSize = 2
+	resumed.PageInfo().Token = token
+	n, err := resumed.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Key() != "k3" {
+		t.Errorf("Next() = %q; want = %q", n.Key(), "k3")
+	}
+	checkAllRequests(t, mock.Reqs, []*testReq{
+		{
+			Method: "GET",
+			Path:   "/peter.json",
+			Query:  map[string]string{"orderBy": "\"$value\"", "limitToFirst": "2"},
+		},
+		{
+			Method: "GET",
+			Path:   "/peter.json",
+			Query:  map[string]string{"orderBy": "\"$value\"", "limitToFirst": "2", "startAfter": "true,\"k2\""},
+		},
+	})
+}
+
+func TestQueryIteratorErrors(t *testing.T) {
+	mock := &mockServer{
+		Resp: map[string]interface{}{"k1": map[string]interface{}{"a": 1}},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	cases := []struct {
+		name  string
+		query *Query
+		token string
+		size  int
+	}{
+		{"LimitToFirst", testref.OrderByKey().LimitToFirst(10), "", 2},
+		{"LimitToLast", testref.OrderByKey().LimitToLast(10), "", 2},
+		{"EqualToWithRange", testref.OrderByValue().EqualTo(1).StartAt(0), "", 2},
+		{"InvalidToken", testref.OrderByKey(), "not a token", 2},
+		{"ObjectValue", testref.OrderByValue(), "", 1},
+	}
+	for _, tc := range cases {
+		it := tc.query.Iterator(context.Background())
+		it.PageInfo().MaxSize = tc.size
+		it.PageInfo().Token = tc.token
+		if n, err := it.Next(); n != nil || err == nil || err == iterator.Done {
+			t.Errorf("%s; Next() = (%v, %v); want = (nil, error)", tc.name, n, err)
+		}
+	}
+}
@@ -368,6 +368,116 @@ func TestEqualToQuery(t *testing.T) {
 	})
 }
 
+func TestRangeQueryWithKey(t *testing.T) {
+	want := map[string]interface{}{"m1": "Hello", "m2": "Bye"}
+	mock := &mockServer{Resp: want}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	q := testref.OrderByChild("messages")
+	cases := []struct {
+		name string
+		q    *Query
+		want map[string]string
+	}{
+		{"StartAtWithKey", q.StartAtWithKey(10, "m1"), map[string]string{"startAt": "10,\"m1\""}},
+		{"StartAfter", q.StartAfter(10), map[string]string{"startAfter": "10"}},
+		{"StartAfterWithKey", q.StartAfterWithKey("foo", "m1"), map[string]string{"startAfter": "\"foo\",\"m1\""}},
+		{"EndAtWithKey", q.EndAtWithKey(10, "m1"), map[string]string{"endAt": "10,\"m1\""}},
+		{"EndBefore", q.EndBefore(10), map[string]string{"endBefore": "10"}},
+		{"EndBeforeWithKey", q.EndBeforeWithKey(true, "m1"), map[string]string{"endBefore": "true,\"m1\""}},
+		{"NullWithKey", q.StartAtWithKey(nil, "m1"), map[string]string{"startAt": "null,\"m1\""}},
+		{"EqualToWithKey", q.EqualToWithKey(10, "m1"), map[string]string{"startAt": "10,\"m1\"", "endAt": "10,\"m1\""}},
+		{"StartAtReplaced", q.StartAt(5).StartAfterWithKey(10, "m1"), map[string]string{"startAfter": "10,\"m1\""}},
+		{"KeyOrder", testref.OrderByKey().StartAfter("m1").EndBefore("m9"), map[string]string{
+			"startAfter": "\"m1\"",
+			"endBefore":  "\"m9\"",
+		}},
+	}
+
+	var reqs []*testReq
+	for _, tc := range cases {
+		var got map[string]interface{}
+		if err := tc.q.Get(context.Background(), &got); err != nil {
+			t.Fatalf("%s: Get() = %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%s: Get() = %v; want = %v", tc.name, got, want)
+		}
+
+		query := map[string]string{"orderBy": "\"messages\""}
+		if tc.name == "KeyOrder" {
+			query["orderBy"] = "\"$key\""
+		}
+		for k, v := range tc.want {
+			query[k] = v
+		}
+		reqs = append(reqs, &testReq{
+			Method: "GET",
+			Path:   "/peter.json",
+			Query:  query,
+		})
+	}
+	checkAllRequests(t, mock.Reqs, reqs)
+}
+
+func TestRangeQueryWireFormat(t *testing.T) {
+	mock := &mockServer{Resp: map[string]interface{}{}}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	q := testref.OrderByChild("messages")
+	cases := []struct {
+		name string
+		q    *Query
+		want string
+	}{
+		{"StartAtWithKey", q.StartAtWithKey(10, "m1"), "orderBy=%22messages%22&startAt=10%2C%22m1%22"},
+		{"StartAfterWithKey", q.StartAfterWithKey("foo", "m1"), "orderBy=%22messages%22&startAfter=%22foo%22%2C%22m1%22"},
+		{"EndBeforeWithKey", q.EndBeforeWithKey(true, "m1"), "endBefore=true%2C%22m1%22&orderBy=%22messages%22"},
+		{"StartAfterByKey", testref.OrderByKey().StartAfter("m1"), "orderBy=%22%24key%22&startAfter=%22m1%22"},
+	}
+
+	for _, tc := range cases {
+		var got map[string]interface{}
+		if err := tc.q.Get(context.Background(), &got); err != nil {
+			t.Fatalf("%s: Get() = %v", tc.name, err)
+		}
+		req := mock.Reqs[len(mock.Reqs)-1]
+		if req.RawQuery != tc.want {
+			t.Errorf("%s: RawQuery = %q; want = %q", tc.name, req.RawQuery, tc.want)
+		}
+	}
+}
+
+func TestInvalidRangeQueryWithKey(t *testing.T) {
+	mock := &mockServer{Resp: "foo"}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	cases := []struct {
+		name string
+		q    *Query
+	}{
+		{"StartAtWithKeyByKey", testref.OrderByKey().StartAtWithKey("k1", "k1")},
+		{"EndBeforeWithKeyByKey", testref.OrderByKey().EndBeforeWithKey("k1", "k1")},
+		{"EqualToWithKeyByKey", testref.OrderByKey().EqualToWithKey("k1", "k1")},
+		{"EqualToWithKeyAndStart", testref.OrderByChild("messages").StartAt(1).EqualToWithKey(10, "m1")},
+		{"EqualToWithKeyAndEnd", testref.OrderByChild("messages").EqualToWithKey(10, "m1").EndAt(20)},
+		{"InvalidStartAfter", testref.OrderByChild("messages").StartAfter(func() {})},
+		{"InvalidEndBeforeWithKey", testref.OrderByChild("messages").EndBeforeWithKey(func() {}, "m1")},
+	}
+	for _, tc := range cases {
+		var got interface{}
+		if err := tc.q.Get(context.Background(), &got); got != nil || err == nil {
+			t.Errorf("%s: Get() = (%v, %v); want = (nil, error)", tc.name, got, err)
+		}
+	}
+	if len(mock.Reqs) != 0 {
+		t.Errorf("Requests = %v; want = empty", mock.Reqs)
+	}
+}
+
 func TestInvalidFilterQuery(t *testing.T) {
 	want := map[string]interface{}{"m1": "Hello", "m2": "Bye"}
 	mock := &mockServer{Resp: want}
@@ -600,6 +710,42 @@ func TestKeyQueryGetOrdered(t *testing.T) {
 	checkOnlyRequest(t, mock.Reqs, req)
 }
 
+func TestGetOrderedKeyTiebreaker(t *testing.T) {
+	mock := &mockServer{Resp: map[string]interface{}{
+		"b":   1,
+		"a":   1,
+		"10":  1,
+		"9":   1,
+		"-1":  1,
+		"010": 1,
+		"c":   0,
+	}}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	cases := []struct {
+		name string
+		q    *Query
+		want []string
+	}{
+		{"value", testref.OrderByValue(), []string{"c", "-1", "9", "10", "010", "a", "b"}},
+		{"key", testref.OrderByKey(), []string{"-1", "9", "10", "010", "a", "b", "c"}},
+	}
+	for _, tc := range cases {
+		result, err := tc.q.GetOrdered(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var gotKeys []string
+		for _, r := range result {
+			gotKeys = append(gotKeys, r.Key())
+		}
+		if !reflect.DeepEqual(tc.want, gotKeys) {
+			t.Errorf("GetOrdered(%s) = %v; want = %v", tc.name, gotKeys, tc.want)
+		}
+	}
+}
+
 func TestValueQueryGetOrdered(t *testing.T) {
 	mock := &mockServer{}
 	srv := mock.Start(client)
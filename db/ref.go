@@ -16,10 +16,12 @@ package db
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strings"
+	"time"
 
 	"firebase.google.com/go/internal"
 )
@@ -28,6 +30,9 @@ import (
 // retries are triggered by concurrent conflicting updates to the same database location.
 const txnRetries = 25
 
+// maxTimeout is the longest read timeout supported by the Realtime Database REST API.
+const maxTimeout = 15 * time.Minute
+
 // Ref represents a node in the Firebase Realtime Database.
 type Ref struct {
 	Key  string
@@ -35,6 +40,73 @@ type Ref struct {
 
 	segs   []string
 	client *Client
+	params requestParams
+}
+
+// WriteSizeLimit limits the size of the writes that the Realtime Database accepts. Writes larger
+// than the limit are rejected by the server.
+//
+// See https://firebase.google.com/docs/database/rest/app-management#section-database-limits for
+// details on each of the limits.
+type WriteSizeLimit string
+
+// Write size limits supported by the Realtime Database.
+const (
+	WriteSizeLimitTiny      WriteSizeLimit = "tiny"
+	WriteSizeLimitSmall     WriteSizeLimit = "small"
+	WriteSizeLimitMedium    WriteSizeLimit = "medium"
+	WriteSizeLimitLarge     WriteSizeLimit = "large"
+	WriteSizeLimitUnlimited WriteSizeLimit = "unlimited"
+)
+
+// requestParams contains the optional REST query parameters sent with each request made by a Ref
+// or a Query.
+type requestParams struct {
+	timeout        time.Duration
+	writeSizeLimit WriteSizeLimit
+}
+
+func (p requestParams) options() ([]internal.HTTPOption, error) {
+	var opts []internal.HTTPOption
+	if p.timeout != 0 {
+		if p.timeout < time.Millisecond || p.timeout > maxTimeout {
+			return nil, fmt.Errorf("timeout must be between 1ms and %v: %v", maxTimeout, p.timeout)
+		}
+		ms := int64(p.timeout / time.Millisecond)
+		opts = append(opts, internal.WithQueryParam("timeout", fmt.Sprintf("%dms", ms)))
+	}
+	switch p.writeSizeLimit {
+	case "":
+	case WriteSizeLimitTiny, WriteSizeLimitSmall, WriteSizeLimitMedium, WriteSizeLimitLarge,
+		WriteSizeLimitUnlimited:
+		opts = append(opts, internal.WithQueryParam("writeSizeLimit", string(p.writeSizeLimit)))
+	default:
+		return nil, fmt.Errorf("invalid write size limit: %q", p.writeSizeLimit)
+	}
+	return opts, nil
+}
+
+// WithTimeout returns a shallow copy of the Ref, which passes the given server-side timeout to all
+// requests made through it. Reads that take longer than the timeout are terminated by the server
+// with an error. The timeout is rounded down to the nearest millisecond, and must not exceed 15 minutes.
+//
+// The timeout is inherited by the children, the parent and the queries of the returned Ref.
+func (r *Ref) WithTimeout(d time.Duration) *Ref {
+	r2 := &Ref{}
+	*r2 = *r
+	r2.params.timeout = d
+	return r2
+}
+
+// WithWriteSizeLimit returns a shallow copy of the Ref, which passes the given size limit to all
+// requests made through it. The server rejects writes that exceed the limit.
+//
+// The limit is inherited by the children, the parent and the queries of the returned Ref.
+func (r *Ref) WithWriteSizeLimit(l WriteSizeLimit) *Ref {
+	r2 := &Ref{}
+	*r2 = *r
+	r2.params.writeSizeLimit = l
+	return r2
 }
 
 // TransactionNode represents the value of a node within the scope of a transaction.
@@ -43,11 +115,12 @@ type TransactionNode interface {
 }
 
 type transactionNodeImpl struct {
-	Raw []byte
+	Raw   []byte
+	codec Codec
 }
 
 func (t *transactionNodeImpl) Unmarshal(v interface{}) error {
-	return json.Unmarshal(t.Raw, v)
+	return t.codec.Unmarshal(t.Raw, v)
 }
 
 // Parent returns a reference to the parent of the current node.
@@ -57,7 +130,9 @@ func (r *Ref) Parent() *Ref {
 	l := len(r.segs)
 	if l > 0 {
 		path := strings.Join(r.segs[:l-1], "/")
-		return r.client.NewRef(path)
+		parent := r.client.NewRef(path)
+		parent.params = r.params
+		return parent
 	}
 	return nil
 }
@@ -65,7 +140,9 @@ func (r *Ref) Parent() *Ref {
 // Child returns a reference to the specified child node.
 func (r *Ref) Child(path string) *Ref {
 	fp := fmt.Sprintf("%s/%s", r.Path, path)
-	return r.client.NewRef(fp)
+	child := r.client.NewRef(fp)
+	child.params = r.params
+	return child
 }
 
 // Get retrieves the value at the current database location, and stores it in the value pointed to
@@ -75,11 +152,18 @@ func (r *Ref) Child(path string) *Ref {
 // therefore v has the same requirements as the json package. Specifically, it must be a pointer,
 // and must not be nil.
 func (r *Ref) Get(ctx context.Context, v interface{}) error {
+	if r.client.cache != nil {
+		b, err := r.client.cache.get(ctx, r)
+		if err != nil {
+			return err
+		}
+		return r.client.getCodec().Unmarshal(b, v)
+	}
 	resp, err := r.send(ctx, "GET")
 	if err != nil {
 		return err
 	}
-	return resp.Unmarshal(http.StatusOK, v)
+	return r.client.unmarshal(resp, http.StatusOK, v)
 }
 
 // GetWithETag retrieves the value at the current database location, along with its ETag.
@@ -87,7 +171,7 @@ func (r *Ref) GetWithETag(ctx context.Context, v interface{}) (string, error) {
 	resp, err := r.send(ctx, "GET", internal.WithHeader("X-Firebase-ETag", "true"))
 	if err != nil {
 		return "", err
-	} else if err := resp.Unmarshal(http.StatusOK, v); err != nil {
+	} else if err := r.client.unmarshal(resp, http.StatusOK, v); err != nil {
 		return "", err
 	}
 	return resp.Header.Get("Etag"), nil
@@ -101,7 +185,7 @@ func (r *Ref) GetShallow(ctx context.Context, v interface{}) error {
 	if err != nil {
 		return err
 	}
-	return resp.Unmarshal(http.StatusOK, v)
+	return r.client.unmarshal(resp, http.StatusOK, v)
 }
 
 // GetIfChanged retrieves the value and ETag of the current database location only if the specified
@@ -119,7 +203,7 @@ func (r *Ref) GetIfChanged(ctx context.Context, etag string, v interface{}) (boo
 	if resp.Status == http.StatusNotModified {
 		return false, etag, nil
 	}
-	if err := resp.Unmarshal(http.StatusOK, v); err != nil {
+	if err := r.client.unmarshal(resp, http.StatusOK, v); err != nil {
 		return false, "", err
 	}
 	return true, resp.Header.Get("ETag"), nil
@@ -177,6 +261,30 @@ func (r *Ref) Push(ctx context.Context, v interface{}) (*Ref, error) {
 	return r.Child(d.Name), nil
 }
 
+// NewChildRef returns a reference to a new child node of the current location, whose key is a
+// push ID generated by NewPushID().
+//
+// No calls are made to the database. The returned reference can be used to refer to the new node
+// in a batch or a multi-location update before any data is written to it.
+func (r *Ref) NewChildRef() *Ref {
+	return r.Child(NewPushID())
+}
+
+// PushWithKey is similar to Push(), but generates the key of the new child node locally instead
+// of obtaining it from the database. The value is written with a single PUT request.
+//
+// If v is nil, the new child node will be created with empty string as the value.
+func (r *Ref) PushWithKey(ctx context.Context, v interface{}) (*Ref, error) {
+	if v == nil {
+		v = ""
+	}
+	child := r.NewChildRef()
+	if err := child.Set(ctx, v); err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
 // Update modifies the specified child keys of the current location to the provided values.
 func (r *Ref) Update(ctx context.Context, v map[string]interface{}) error {
 	if len(v) == 0 {
@@ -192,6 +300,49 @@ func (r *Ref) Update(ctx context.Context, v map[string]interface{}) error {
 // UpdateFn represents a function type that can be passed into Transaction().
 type UpdateFn func(TransactionNode) (interface{}, error)
 
+// ErrAbortTransaction can be returned by an UpdateFn to abort a transaction without writing to the
+// database. Transactions aborted this way complete without an error.
+var ErrAbortTransaction = errors.New("transaction aborted by the update function")
+
+// TransactionOptions specifies how a transaction is retried when it conflicts with concurrent
+// updates to the same database location.
+type TransactionOptions struct {
+	// MaxRetries is the maximum number of times the update function is invoked before giving up.
+	// Defaults to 25 when set to 0.
+	MaxRetries int
+
+	// InitialBackoff is the delay before the first retry. The delay is doubled on each subsequent
+	// retry, up to MaxBackoff. Retries are not delayed when set to 0.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between retries. Defaults to no limit when set to 0.
+	MaxBackoff time.Duration
+}
+
+func (o *TransactionOptions) retries() int {
+	if o == nil || o.MaxRetries == 0 {
+		return txnRetries
+	}
+	return o.MaxRetries
+}
+
+func (o *TransactionOptions) backoff(retry int) time.Duration {
+	if o == nil || o.InitialBackoff <= 0 {
+		return 0
+	}
+	delay := o.InitialBackoff
+	for i := 1; i < retry && delay < math.MaxInt64/2; i++ {
+		delay *= 2
+		if o.MaxBackoff > 0 && delay >= o.MaxBackoff {
+			break
+		}
+	}
+	if o.MaxBackoff > 0 && delay > o.MaxBackoff {
+		delay = o.MaxBackoff
+	}
+	return delay
+}
+
 // Transaction atomically modifies the data at this location.
 //
 // Unlike a normal Set(), which just overwrites the data regardless of its previous state,
@@ -205,33 +356,69 @@ type UpdateFn func(TransactionNode) (interface{}, error)
 // to 25 times before giving up and returning an error.
 //
 // The update function may also force an early abort by returning an error instead of returning a
-// value.
+// value. Returning ErrAbortTransaction aborts the transaction without an error.
 func (r *Ref) Transaction(ctx context.Context, fn UpdateFn) error {
+	_, err := r.TransactionWithOptions(ctx, fn, nil)
+	return err
+}
+
+// TransactionWithOptions atomically modifies the data at this location, retrying the transaction
+// according to the given options. Options may be nil, in which case the transaction is retried
+// just like Transaction().
+//
+// On success, TransactionWithOptions returns the value committed to the database, as reported by
+// the server. If the update function aborts the transaction by returning ErrAbortTransaction,
+// TransactionWithOptions returns nil and no error.
+func (r *Ref) TransactionWithOptions(
+	ctx context.Context, fn UpdateFn, opts *TransactionOptions) (TransactionNode, error) {
+
+	retries := opts.retries()
+	if retries < 0 {
+		return nil, fmt.Errorf("max retries must not be negative: %d", retries)
+	}
+
 	resp, err := r.send(ctx, "GET", internal.WithHeader("X-Firebase-ETag", "true"))
 	if err != nil {
-		return err
+		return nil, err
 	} else if err := resp.CheckStatus(http.StatusOK); err != nil {
-		return err
+		return nil, err
 	}
 	etag := resp.Header.Get("Etag")
 
-	for i := 0; i < txnRetries; i++ {
-		new, err := fn(&transactionNodeImpl{resp.Body})
-		if err != nil {
-			return err
+	for i := 0; i < retries; i++ {
+		if i > 0 {
+			if err := waitForRetry(ctx, opts.backoff(i)); err != nil {
+				return nil, err
+			}
+		}
+		new, err := fn(&transactionNodeImpl{resp.Body, r.client.getCodec()})
+		if err == ErrAbortTransaction {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
 		}
 		resp, err = r.sendWithBody(ctx, "PUT", new, internal.WithHeader("If-Match", etag))
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if resp.Status == http.StatusOK {
-			return nil
+			return &transactionNodeImpl{resp.Body, r.client.getCodec()}, nil
 		} else if err := resp.CheckStatus(http.StatusPreconditionFailed); err != nil {
-			return err
+			return nil, err
 		}
 		etag = resp.Header.Get("ETag")
 	}
-	return fmt.Errorf("transaction aborted after failed retries")
+	return nil, fmt.Errorf("transaction aborted after failed retries")
+}
+
+func waitForRetry(ctx context.Context, delay time.Duration) error {
+	if delay > 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+	return ctx.Err()
 }
 
 // Delete removes this node from the database.
@@ -248,7 +435,7 @@ func (r *Ref) send(
 	method string,
 	opts ...internal.HTTPOption) (*internal.Response, error) {
 
-	return r.client.send(ctx, method, r.Path, nil, opts...)
+	return r.client.sendWithParams(ctx, method, r.Path, nil, r.params, opts...)
 }
 
 func (r *Ref) sendWithBody(
@@ -257,5 +444,6 @@ func (r *Ref) sendWithBody(
 	body interface{},
 	opts ...internal.HTTPOption) (*internal.Response, error) {
 
-	return r.client.send(ctx, method, r.Path, internal.NewJSONEntity(body), opts...)
+	entity := r.client.newEntity(body)
+	return r.client.sendWithParams(ctx, method, r.Path, entity, r.params, opts...)
 }
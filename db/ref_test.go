@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type refOp func(r *Ref) error
@@ -719,6 +720,217 @@ func TestTransactionAbort(t *testing.T) {
 	checkAllRequests(t, mock.Reqs, wanted)
 }
 
+func TestTransactionWithOptions(t *testing.T) {
+	mock := &mockServer{
+		Resp:   &person{"Peter Parker", 17},
+		Header: map[string]string{"ETag": "mock-etag1"},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	cnt := 0
+	var fn UpdateFn = func(t TransactionNode) (interface{}, error) {
+		if cnt == 0 {
+			mock.Status = http.StatusPreconditionFailed
+			mock.Header = map[string]string{"ETag": "mock-etag2"}
+			mock.Resp = &person{"Peter Parker", 19}
+		} else if cnt == 1 {
+			mock.Status = http.StatusOK
+			mock.Resp = &person{"Peter Parker", 20}
+		}
+		cnt++
+		var p person
+		if err := t.Unmarshal(&p); err != nil {
+			return nil, err
+		}
+		p.Age++
+		return &p, nil
+	}
+	opts := &TransactionOptions{MaxRetries: 2, InitialBackoff: time.Millisecond}
+	node, err := testref.TransactionWithOptions(context.Background(), fn, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got person
+	if err := node.Unmarshal(&got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (person{"Peter Parker", 20}); got != want {
+		t.Errorf("TransactionWithOptions() = %v; want = %v", got, want)
+	}
+	if cnt != 2 {
+		t.Errorf("TransactionWithOptions() retries = %d; want = %d", cnt, 2)
+	}
+}
+
+func TestTransactionWithOptionsMaxRetries(t *testing.T) {
+	mock := &mockServer{
+		Resp:   &person{"Peter Parker", 17},
+		Header: map[string]string{"ETag": "mock-etag1"},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	cnt := 0
+	var fn UpdateFn = func(t TransactionNode) (interface{}, error) {
+		mock.Status = http.StatusPreconditionFailed
+		cnt++
+		return 1, nil
+	}
+	opts := &TransactionOptions{MaxRetries: 3}
+	node, err := testref.TransactionWithOptions(context.Background(), fn, opts)
+	if node != nil || err == nil {
+		t.Errorf("TransactionWithOptions() = (%v, %v); want = (nil, error)", node, err)
+	}
+	if cnt != 3 {
+		t.Errorf("TransactionWithOptions() retries = %d; want = %d", cnt, 3)
+	}
+	if len(mock.Reqs) != 4 {
+		t.Errorf("Requests = %d; want = %d", len(mock.Reqs), 4)
+	}
+
+	if _, err := testref.TransactionWithOptions(
+		context.Background(), fn, &TransactionOptions{MaxRetries: -1}); err == nil {
+		t.Errorf("TransactionWithOptions(MaxRetries: -1) = nil; want error")
+	}
+}
+
+func TestTransactionWithOptionsContextCancel(t *testing.T) {
+	mock := &mockServer{
+		Resp:   &person{"Peter Parker", 17},
+		Header: map[string]string{"ETag": "mock-etag1"},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var fn UpdateFn = func(t TransactionNode) (interface{}, error) {
+		mock.Status = http.StatusPreconditionFailed
+		cancel()
+		return 1, nil
+	}
+	opts := &TransactionOptions{InitialBackoff: time.Hour}
+	if _, err := testref.TransactionWithOptions(ctx, fn, opts); err != context.Canceled {
+		t.Errorf("TransactionWithOptions() = %v; want = %v", err, context.Canceled)
+	}
+}
+
+func TestTransactionAbortSentinel(t *testing.T) {
+	mock := &mockServer{
+		Resp:   &person{"Peter Parker", 17},
+		Header: map[string]string{"ETag": "mock-etag1"},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	var fn UpdateFn = func(t TransactionNode) (interface{}, error) {
+		return nil, ErrAbortTransaction
+	}
+	if err := testref.Transaction(context.Background(), fn); err != nil {
+		t.Errorf("Transaction() = %v; want = nil", err)
+	}
+	node, err := testref.TransactionWithOptions(context.Background(), fn, nil)
+	if node != nil || err != nil {
+		t.Errorf("TransactionWithOptions() = (%v, %v); want = (nil, nil)", node, err)
+	}
+	for _, r := range mock.Reqs {
+		if r.Method != "GET" {
+			t.Errorf("Method = %q; want = %q", r.Method, "GET")
+		}
+	}
+}
+
+func TestTransactionBackoff(t *testing.T) {
+	cases := []struct {
+		opts  *TransactionOptions
+		retry int
+		want  time.Duration
+	}{
+		{nil, 1, 0},
+		{&TransactionOptions{}, 3, 0},
+		{&TransactionOptions{InitialBackoff: time.Second}, 1, time.Second},
+		{&TransactionOptions{InitialBackoff: time.Second}, 4, 8 * time.Second},
+		{&TransactionOptions{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}, 3, 4 * time.Second},
+		{&TransactionOptions{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}, 4, 5 * time.Second},
+		{&TransactionOptions{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}, 100, 5 * time.Second},
+	}
+	for _, tc := range cases {
+		if got := tc.opts.backoff(tc.retry); got != tc.want {
+			t.Errorf("backoff(%d) = %v; want = %v", tc.retry, got, tc.want)
+		}
+	}
+}
+
+func TestRequestParams(t *testing.T) {
+	mock := &mockServer{Resp: "test"}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	ref := testref.WithTimeout(3 * time.Second).WithWriteSizeLimit(WriteSizeLimitSmall)
+	if testref.params != (requestParams{}) {
+		t.Errorf("WithTimeout() modified the original Ref")
+	}
+
+	var got string
+	if err := ref.Get(context.Background(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := ref.Child("child").Set(context.Background(), "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ref.Child("child").Parent().OrderByKey().Get(context.Background(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	params := map[string]string{"timeout": "3000ms", "writeSizeLimit": "small"}
+	checkAllRequests(t, mock.Reqs, []*testReq{
+		{
+			Method: "GET",
+			Path:   "/peter.json",
+			Query:  params,
+		},
+		{
+			Method: "PUT",
+			Path:   "/peter/child.json",
+			Body:   serialize("foo"),
+			Query:  map[string]string{"timeout": "3000ms", "writeSizeLimit": "small", "print": "silent"},
+		},
+		{
+			Method: "GET",
+			Path:   "/peter.json",
+			Query:  map[string]string{"timeout": "3000ms", "writeSizeLimit": "small", "orderBy": "\"$key\""},
+		},
+	})
+}
+
+func TestInvalidRequestParams(t *testing.T) {
+	mock := &mockServer{Resp: "test"}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	cases := []*Ref{
+		testref.WithTimeout(-time.Second),
+		testref.WithTimeout(time.Microsecond),
+		testref.WithTimeout(maxTimeout + time.Second),
+		testref.WithWriteSizeLimit("huge"),
+	}
+	for _, ref := range cases {
+		var got string
+		if err := ref.Get(context.Background(), &got); err == nil {
+			t.Errorf("Get(%v) = nil; want error", ref.params)
+		}
+		if err := ref.Set(context.Background(), "foo"); err == nil {
+			t.Errorf("Set(%v) = nil; want error", ref.params)
+		}
+		if err := ref.OrderByKey().Get(context.Background(), &got); err == nil {
+			t.Errorf("Query.Get(%v) = nil; want error", ref.params)
+		}
+	}
+	if len(mock.Reqs) != 0 {
+		t.Errorf("Requests = %d; want = 0", len(mock.Reqs))
+	}
+}
+
 func TestDelete(t *testing.T) {
 	mock := &mockServer{Resp: "null"}
 	srv := mock.Start(client)
@@ -0,0 +1,217 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"firebase.google.com/go/internal"
+)
+
+const rulesPath = "/.settings/rules.json"
+
+// GetRules retrieves the security rules of the database, and returns them as a map.
+//
+// Comments in the rules are discarded. Use GetRulesJSON() to retrieve the rules along with their
+// comments.
+func (c *Client) GetRules(ctx context.Context) (map[string]interface{}, error) {
+	b, err := c.GetRulesJSON(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var rules map[string]interface{}
+	if err := json.Unmarshal(stripComments(b), &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// GetRulesJSON retrieves the security rules of the database as a JSON document.
+//
+// The document is returned exactly as it is stored on the server, including any comments.
+func (c *Client) GetRulesJSON(ctx context.Context) ([]byte, error) {
+	resp, err := c.sendRules(ctx, "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.CheckStatus(http.StatusOK); err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// SetRules replaces the security rules of the database with the given value.
+//
+// Rules are serialized into JSON using https://golang.org/pkg/encoding/json/#Marshal. The value
+// must contain a top-level "rules" key. Use SetRulesJSON() to deploy rules that contain comments.
+func (c *Client) SetRules(ctx context.Context, rules interface{}) error {
+	b, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	return c.SetRulesJSON(ctx, b)
+}
+
+// SetRulesJSON replaces the security rules of the database with the given JSON document.
+//
+// The document is sent to the server as is, and may contain comments.
+func (c *Client) SetRulesJSON(ctx context.Context, rules []byte) error {
+	if len(bytes.TrimSpace(rules)) == 0 {
+		return fmt.Errorf("rules must not be empty")
+	}
+	resp, err := c.sendRules(ctx, "PUT", rawJSONEntity(rules))
+	if err != nil {
+		return err
+	}
+	return resp.CheckStatus(http.StatusOK)
+}
+
+// AddIndex declares an index on the given child fields of the nodes at path, by adding them to
+// the ".indexOn" rule of path in rules. Path is relative to the database root, and rules must be
+// of the form returned by GetRules().
+//
+// Nested rule maps are created as needed. Fields that are already indexed are not duplicated. Use
+// "$key" or "$value" as the field to index nodes by key or by value.
+func AddIndex(rules map[string]interface{}, path string, fields ...string) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("at least one field must be specified")
+	}
+	node, err := childRules(rules, "rules")
+	if err != nil {
+		return err
+	}
+	for _, seg := range parsePath(path) {
+		if node, err = childRules(node, seg); err != nil {
+			return err
+		}
+	}
+
+	var indexOn []interface{}
+	switch v := node[".indexOn"].(type) {
+	case nil:
+	case string:
+		indexOn = []interface{}{v}
+	case []interface{}:
+		indexOn = v
+	case []string:
+		for _, f := range v {
+			indexOn = append(indexOn, f)
+		}
+	default:
+		return fmt.Errorf("invalid .indexOn rule at %q: %v", path, v)
+	}
+
+	for _, f := range fields {
+		if f == "" {
+			return fmt.Errorf("index field must not be empty")
+		}
+		exists := false
+		for _, existing := range indexOn {
+			if existing == f {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			indexOn = append(indexOn, f)
+		}
+	}
+	node[".indexOn"] = indexOn
+	return nil
+}
+
+func childRules(node map[string]interface{}, key string) (map[string]interface{}, error) {
+	child, ok := node[key]
+	if !ok {
+		m := make(map[string]interface{})
+		node[key] = m
+		return m, nil
+	}
+	m, ok := child.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("rules at %q must be an object: %v", key, child)
+	}
+	return m, nil
+}
+
+func (c *Client) sendRules(
+	ctx context.Context, method string, body internal.HTTPEntity) (*internal.Response, error) {
+
+	return c.hc.Do(ctx, &internal.Request{
+		Method: method,
+		URL:    c.url + rulesPath,
+		Body:   body,
+	})
+}
+
+// rawJSONEntity is an HTTPEntity that sends a JSON document without re-encoding it. This
+// preserves the comments allowed in security rules.
+type rawJSONEntity []byte
+
+func (e rawJSONEntity) Bytes() ([]byte, error) {
+	return e, nil
+}
+
+func (e rawJSONEntity) Mime() string {
+	return "application/json"
+}
+
+// stripComments removes the JavaScript-style line and block comments from a JSON document, while
+// leaving string literals intact.
+func stripComments(b []byte) []byte {
+	var out bytes.Buffer
+	inString := false
+	for i := 0; i < len(b); i++ {
+		ch := b[i]
+		if inString {
+			out.WriteByte(ch)
+			if ch == '\\' && i+1 < len(b) {
+				i++
+				out.WriteByte(b[i])
+			} else if ch == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		if ch == '/' && i+1 < len(b) && b[i+1] == '/' {
+			for i < len(b) && b[i] != '\n' {
+				i++
+			}
+			if i < len(b) {
+				out.WriteByte('\n')
+			}
+			continue
+		}
+		if ch == '/' && i+1 < len(b) && b[i+1] == '*' {
+			end := bytes.Index(b[i+2:], []byte("*/"))
+			if end < 0 {
+				break
+			}
+			i += end + 3
+			out.WriteByte(' ')
+			continue
+		}
+		if ch == '"' {
+			inString = true
+		}
+		out.WriteByte(ch)
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,202 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const testRulesJSON = `{
+  // Only authenticated users can read.
+  "rules": {
+    ".read": "auth != null", /* block comment */
+    "messages": {
+      ".indexOn": "timestamp",
+      "note": "http://example.com // not a comment",
+      "escaped": "quote \" /* not a comment */"
+    }
+  }
+}`
+
+var testRules = map[string]interface{}{
+	"rules": map[string]interface{}{
+		".read": "auth != null",
+		"messages": map[string]interface{}{
+			".indexOn": "timestamp",
+			"note":     "http://example.com // not a comment",
+			"escaped":  "quote \" /* not a comment */",
+		},
+	},
+}
+
+func TestGetRules(t *testing.T) {
+	mock := &mockServer{Resp: []byte(testRulesJSON)}
+	srv := mock.Start(aoClient)
+	defer srv.Close()
+
+	rules, err := aoClient.GetRules(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rules, testRules) {
+		t.Errorf("GetRules() = %v; want = %v", rules, testRules)
+	}
+
+	b, err := aoClient.GetRulesJSON(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != testRulesJSON {
+		t.Errorf("GetRulesJSON() = %q; want = %q", string(b), testRulesJSON)
+	}
+
+	req := &testReq{Method: "GET", Path: "/.settings/rules.json"}
+	checkAllRequests(t, mock.Reqs, []*testReq{req, req})
+}
+
+func TestSetRules(t *testing.T) {
+	mock := &mockServer{Resp: map[string]string{"status": "ok"}}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	if err := client.SetRules(context.Background(), testRules); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetRulesJSON(context.Background(), []byte(testRulesJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	checkOnlyRequest(t, mock.Reqs[:1], &testReq{
+		Method: "PUT",
+		Path:   "/.settings/rules.json",
+		Body:   serialize(testRules),
+	})
+	if len(mock.Reqs) != 2 {
+		t.Fatalf("Requests = %d; want = 2", len(mock.Reqs))
+	}
+	if got := string(mock.Reqs[1].Body); got != testRulesJSON {
+		t.Errorf("SetRulesJSON() body = %q; want = %q", got, testRulesJSON)
+	}
+	if h := mock.Reqs[1].Header.Get("Content-Type"); h != "application/json" {
+		t.Errorf("Content-Type = %q; want = %q", h, "application/json")
+	}
+}
+
+func TestRulesErrors(t *testing.T) {
+	mock := &mockServer{
+		Resp:   map[string]string{"error": "Permission denied"},
+		Status: http.StatusUnauthorized,
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	want := "http error status: 401; reason: Permission denied"
+	if _, err := client.GetRules(context.Background()); err == nil || err.Error() != want {
+		t.Errorf("GetRules() = %v; want = %q", err, want)
+	}
+	if err := client.SetRules(context.Background(), testRules); err == nil || err.Error() != want {
+		t.Errorf("SetRules() = %v; want = %q", err, want)
+	}
+	if err := client.SetRulesJSON(context.Background(), []byte("  ")); err == nil {
+		t.Errorf("SetRulesJSON(empty) = nil; want error")
+	}
+	if err := client.SetRules(context.Background(), func() {}); err == nil {
+		t.Errorf("SetRules(func) = nil; want error")
+	}
+
+	mock.Status = http.StatusOK
+	mock.Resp = []byte(`{"rules": /* unterminated`)
+	if _, err := client.GetRules(context.Background()); err == nil {
+		t.Errorf("GetRules(malformed) = nil; want error")
+	}
+}
+
+func TestAddIndex(t *testing.T) {
+	rules := map[string]interface{}{
+		"rules": map[string]interface{}{
+			"messages": map[string]interface{}{".indexOn": "timestamp"},
+			"scores":   map[string]interface{}{".indexOn": []interface{}{"$value"}},
+		},
+	}
+	if err := AddIndex(rules, "messages", "timestamp", "author"); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddIndex(rules, "scores", "$value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddIndex(rules, "/users/$uid/posts/", "createdAt"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"rules": map[string]interface{}{
+			"messages": map[string]interface{}{".indexOn": []interface{}{"timestamp", "author"}},
+			"scores":   map[string]interface{}{".indexOn": []interface{}{"$value"}},
+			"users": map[string]interface{}{
+				"$uid": map[string]interface{}{
+					"posts": map[string]interface{}{".indexOn": []interface{}{"createdAt"}},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("AddIndex() = %v; want = %v", rules, want)
+	}
+
+	empty := map[string]interface{}{}
+	if err := AddIndex(empty, "messages", "timestamp"); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]interface{}{
+		"rules": map[string]interface{}{
+			"messages": map[string]interface{}{".indexOn": []interface{}{"timestamp"}},
+		},
+	}
+	if !reflect.DeepEqual(empty, want) {
+		t.Errorf("AddIndex() = %v; want = %v", empty, want)
+	}
+}
+
+func TestAddIndexErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		rules  map[string]interface{}
+		fields []string
+	}{
+		{"NoFields", map[string]interface{}{}, nil},
+		{"EmptyField", map[string]interface{}{}, []string{""}},
+		{"InvalidRules", map[string]interface{}{"rules": true}, []string{"a"}},
+		{
+			"InvalidChild",
+			map[string]interface{}{"rules": map[string]interface{}{"messages": "x"}},
+			[]string{"a"},
+		},
+		{
+			"InvalidIndexOn",
+			map[string]interface{}{
+				"rules": map[string]interface{}{"messages": map[string]interface{}{".indexOn": 1}},
+			},
+			[]string{"a"},
+		},
+	}
+	for _, tc := range cases {
+		if err := AddIndex(tc.rules, "messages", tc.fields...); err == nil {
+			t.Errorf("%s; AddIndex() = nil; want error", tc.name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const serverValueKey = ".sv"
+
+// ServerValue is a placeholder value that is replaced by the Realtime Database server when it is
+// written.
+//
+// Server values can be used anywhere in the values passed to Set(), SetIfUnchanged(), Update(),
+// Push() and Transaction(), including nested inside maps, slices and structs.
+type ServerValue struct {
+	v interface{}
+}
+
+// ServerTimestamp is a placeholder value that is replaced by the current time of the server, in
+// milliseconds since the epoch.
+var ServerTimestamp = ServerValue{v: "timestamp"}
+
+// Increment returns a placeholder value that atomically increments the current numeric value of a
+// database node by delta. If the node does not exist, or does not contain a numeric value, it is
+// set to delta.
+func Increment(delta float64) ServerValue {
+	return ServerValue{v: map[string]interface{}{"increment": delta}}
+}
+
+// MarshalJSON encodes the ServerValue into the JSON format expected by the server.
+func (s ServerValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{serverValueKey: s.v})
+}
+
+// resolveServerValue returns a local estimate of the value that the server would write in place of
+// v, if v is a server value placeholder. Other values are returned as is.
+//
+// Server timestamps resolve to the current local time, and increments resolve to the increment
+// delta. This enables the query sort code to order nodes that contain unresolved server values.
+func resolveServerValue(v interface{}) interface{} {
+	var sv interface{}
+	switch t := v.(type) {
+	case ServerValue:
+		sv = t.v
+	case *ServerValue:
+		if t == nil {
+			return v
+		}
+		sv = t.v
+	case map[string]interface{}:
+		if len(t) != 1 {
+			return v
+		}
+		var ok bool
+		if sv, ok = t[serverValueKey]; !ok {
+			return v
+		}
+	default:
+		return v
+	}
+
+	switch t := sv.(type) {
+	case string:
+		if t == "timestamp" {
+			return float64(time.Now().UnixNano() / int64(time.Millisecond))
+		}
+	case map[string]interface{}:
+		if delta, ok := t["increment"].(float64); ok {
+			return delta
+		}
+	}
+	return v
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type post struct {
+	Title     string      `json:"title"`
+	Timestamp interface{} `json:"timestamp"`
+	Likes     interface{} `json:"likes"`
+}
+
+func TestServerValueJSON(t *testing.T) {
+	cases := []struct {
+		value interface{}
+		want  string
+	}{
+		{ServerTimestamp, `{".sv":"timestamp"}`},
+		{&ServerTimestamp, `{".sv":"timestamp"}`},
+		{Increment(1), `{".sv":{"increment":1}}`},
+		{Increment(-2.5), `{".sv":{"increment":-2.5}}`},
+		{
+			map[string]interface{}{"a": []interface{}{ServerTimestamp}},
+			`{"a":[{".sv":"timestamp"}]}`,
+		},
+		{
+			&post{Title: "hello", Timestamp: ServerTimestamp, Likes: Increment(1)},
+			`{"title":"hello","timestamp":{".sv":"timestamp"},"likes":{".sv":{"increment":1}}}`,
+		},
+	}
+	for _, tc := range cases {
+		b, err := json.Marshal(tc.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tc.want {
+			t.Errorf("Marshal(%v) = %s; want = %s", tc.value, string(b), tc.want)
+		}
+	}
+}
+
+func TestWriteServerValues(t *testing.T) {
+	mock := &mockServer{Resp: map[string]string{"name": "new_key"}}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	p := &post{Title: "hello", Timestamp: ServerTimestamp, Likes: Increment(1)}
+	wantBody := `{"title":"hello","timestamp":{".sv":"timestamp"},"likes":{".sv":{"increment":1}}}`
+	if err := testref.Set(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testref.Push(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+
+	update := map[string]interface{}{"lastSeen": ServerTimestamp, "visits": Increment(1)}
+	if err := testref.Update(context.Background(), update); err != nil {
+		t.Fatal(err)
+	}
+
+	checkAllRequests(t, mock.Reqs, []*testReq{
+		{
+			Method: "PUT",
+			Path:   "/peter.json",
+			Body:   []byte(wantBody),
+			Query:  map[string]string{"print": "silent"},
+		},
+		{
+			Method: "POST",
+			Path:   "/peter.json",
+			Body:   []byte(wantBody),
+		},
+		{
+			Method: "PATCH",
+			Path:   "/peter.json",
+			Body:   []byte(`{"lastSeen":{".sv":"timestamp"},"visits":{".sv":{"increment":1}}}`),
+			Query:  map[string]string{"print": "silent"},
+		},
+	})
+}
+
+func TestTransactionServerValue(t *testing.T) {
+	mock := &mockServer{
+		Resp:   map[string]interface{}{"visits": 1.0},
+		Header: map[string]string{"ETag": "mock-etag"},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	fn := func(t TransactionNode) (interface{}, error) {
+		return map[string]interface{}{"visits": Increment(1), "updated": ServerTimestamp}, nil
+	}
+	if err := testref.Transaction(context.Background(), fn); err != nil {
+		t.Fatal(err)
+	}
+	checkAllRequests(t, mock.Reqs, []*testReq{
+		{
+			Method: "GET",
+			Path:   "/peter.json",
+			Header: http.Header{"X-Firebase-ETag": []string{"true"}},
+		},
+		{
+			Method: "PUT",
+			Path:   "/peter.json",
+			Body:   []byte(`{"updated":{".sv":"timestamp"},"visits":{".sv":{"increment":1}}}`),
+			Header: http.Header{"If-Match": []string{"mock-etag"}},
+		},
+	})
+}
+
+func TestGetOrderedServerValues(t *testing.T) {
+	mock := &mockServer{
+		Resp: map[string]interface{}{
+			"a": map[string]interface{}{"ts": 1000.0},
+			"b": map[string]interface{}{"ts": map[string]interface{}{".sv": "timestamp"}},
+			"c": map[string]interface{}{"ts": "later"},
+			"d": map[string]interface{}{"ts": map[string]interface{}{".sv": map[string]interface{}{"increment": 5.0}}},
+		},
+	}
+	srv := mock.Start(client)
+	defer srv.Close()
+
+	result, err := testref.OrderByChild("ts").GetOrdered(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotKeys []string
+	for _, r := range result {
+		gotKeys = append(gotKeys, r.Key())
+	}
+
+	wantKeys := []string{"d", "a", "b", "c"}
+	if !reflect.DeepEqual(gotKeys, wantKeys) {
+		t.Errorf("GetOrdered() = %v; want = %v", gotKeys, wantKeys)
+	}
+}
+
+func TestResolveServerValue(t *testing.T) {
+	cases := []interface{}{
+		nil,
+		1.0,
+		"timestamp",
+		map[string]interface{}{".sv": "unknown"},
+		map[string]interface{}{".sv": "timestamp", "other": true},
+		map[string]interface{}{"sv": "timestamp"},
+	}
+	for _, tc := range cases {
+		if got := resolveServerValue(tc); !reflect.DeepEqual(got, tc) {
+			t.Errorf("resolveServerValue(%v) = %v; want = %v", tc, got, tc)
+		}
+	}
+
+	if got := resolveServerValue(Increment(3)); got != 3.0 {
+		t.Errorf("resolveServerValue(Increment(3)) = %v; want = %v", got, 3.0)
+	}
+	if got, ok := resolveServerValue(ServerTimestamp).(float64); !ok || got <= 0 {
+		t.Errorf("resolveServerValue(ServerTimestamp) = %v; want = timestamp", got)
+	}
+}
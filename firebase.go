@@ -22,7 +22,10 @@ import (
 	"encoding/json"
 	"errors"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
 
 	"cloud.google.com/go/firestore"
 	"firebase.google.com/go/auth"
@@ -53,6 +56,9 @@ type App struct {
 	serviceAccountID string
 	storageBucket    string
 	opts             []option.ClientOption
+
+	dbMu      sync.Mutex
+	dbClients map[string]*db.Client
 }
 
 // Config represents the configuration used to initialize an App.
@@ -84,14 +90,60 @@ func (a *App) Database(ctx context.Context) (*db.Client, error) {
 
 // DatabaseWithURL returns an instance of db.Client to interact with the Firebase Database
 // identified by the given URL.
+//
+// The URL may refer to any database instance of the project, including databases hosted outside
+// the us-central1 region on firebasedatabase.app. The App creates one db.Client per database, and
+// returns the same db.Client from subsequent calls with a URL of that database. URLs that only
+// differ in letter case, path or trailing slash refer to the same database.
 func (a *App) DatabaseWithURL(ctx context.Context, url string) (*db.Client, error) {
+	a.dbMu.Lock()
+	defer a.dbMu.Unlock()
+	key := databaseKey(url)
+	if c, ok := a.dbClients[key]; ok {
+		return c, nil
+	}
+
 	conf := &internal.DatabaseConfig{
 		AuthOverride: a.authOverride,
 		URL:          url,
 		Opts:         a.opts,
 		Version:      Version,
 	}
-	return db.NewClient(ctx, conf)
+	c, err := db.NewClient(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	if a.dbClients == nil {
+		a.dbClients = make(map[string]*db.Client)
+	}
+	a.dbClients[key] = c
+	return c, nil
+}
+
+// databaseKey returns the key that identifies the database of the given URL in the db.Client
+// cache of an App. The key consists of the scheme, the host and the "ns" query parameter of the
+// URL, if present.
+func databaseKey(rawURL string) string {
+	p, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	key := strings.ToLower(p.Scheme + "://" + p.Host)
+	if ns := p.Query().Get("ns"); ns != "" {
+		key += "?ns=" + ns
+	}
+	return key
+}
+
+// DatabaseInstances returns an instance of db.InstanceClient for managing the Realtime Database
+// instances of the project.
+func (a *App) DatabaseInstances(ctx context.Context) (*db.InstanceClient, error) {
+	conf := &internal.DatabaseInstanceConfig{
+		ProjectID: a.projectID,
+		Opts:      a.opts,
+		Version:   Version,
+	}
+	return db.NewInstanceClient(ctx, conf)
 }
 
 // Storage returns a new instance of storage.Client.
@@ -253,6 +253,64 @@ func TestDatabase(t *testing.T) {
 	}
 }
 
+func TestDatabaseClientPerURL(t *testing.T) {
+	ctx := context.Background()
+	conf := &Config{DatabaseURL: "https://mock-db.firebaseio.com"}
+	app, err := NewApp(ctx, conf, option.WithCredentialsFile("testdata/service_account.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c1, err := app.Database(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := app.DatabaseWithURL(ctx, "https://mock-db.firebaseio.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1 != c2 {
+		t.Errorf("DatabaseWithURL() = %p; want = %p", c2, c1)
+	}
+	for _, u := range []string{
+		"https://mock-db.firebaseio.com/",
+		"https://MOCK-DB.firebaseio.com",
+		"https://mock-db.firebaseio.com/users",
+	} {
+		if c, err := app.DatabaseWithURL(ctx, u); c != c1 || err != nil {
+			t.Errorf("DatabaseWithURL(%q) = (%p, %v); want = (%p, nil)", u, c, err, c1)
+		}
+	}
+
+	regional := "https://mock-db.europe-west1.firebasedatabase.app"
+	c3, err := app.DatabaseWithURL(ctx, regional)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c3 == c1 {
+		t.Errorf("DatabaseWithURL(%q) = %p; want a different client", regional, c3)
+	}
+	if c4, err := app.DatabaseWithURL(ctx, regional); c4 != c3 || err != nil {
+		t.Errorf("DatabaseWithURL(%q) = (%p, %v); want = (%p, nil)", regional, c4, err, c3)
+	}
+
+	if c, err := app.DatabaseWithURL(ctx, "https://mock-db.example.com"); c != nil || err == nil {
+		t.Errorf("DatabaseWithURL(invalid) = (%v, %v); want (nil, error)", c, err)
+	}
+}
+
+func TestDatabaseInstances(t *testing.T) {
+	ctx := context.Background()
+	app, err := NewApp(ctx, nil, option.WithCredentialsFile("testdata/service_account.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := app.DatabaseInstances(ctx); c == nil || err != nil {
+		t.Errorf("DatabaseInstances() = (%v, %v); want (db, nil)", c, err)
+	}
+}
+
 func TestDatabaseAuthOverrides(t *testing.T) {
 	cases := []map[string]interface{}{
 		nil,
@@ -521,6 +521,110 @@ func TestPasswordResetLink(t *testing.T) {
 	}
 }
 
+func TestConfirmPasswordReset(t *testing.T) {
+	user := newUserWithParams(t)
+	defer deleteUser(user.UID)
+	link, err := client.PasswordResetLinkWithSettings(context.Background(), user.Email, &auth.ActionCodeSettings{
+		URL:             continueURL,
+		HandleCodeInApp: false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := auth.ParseActionLink(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Mode != auth.ActionModeResetPassword {
+		t.Errorf("ParseActionLink() Mode = %q; want = %q", parsed.Mode, auth.ActionModeResetPassword)
+	}
+	if parsed.ContinueURL != continueURL {
+		t.Errorf("ParseActionLink() ContinueURL = %q; want = %q", parsed.ContinueURL, continueURL)
+	}
+
+	info, err := client.CheckActionCode(context.Background(), parsed.OOBCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Operation != "PASSWORD_RESET" || info.Email != user.Email {
+		t.Errorf("CheckActionCode() = %#v; want = {PASSWORD_RESET, %q}", info, user.Email)
+	}
+
+	if err := client.ConfirmPasswordReset(context.Background(), parsed.OOBCode, "newPassword"); err != nil {
+		t.Fatalf("ConfirmPasswordReset() = %v; want = nil", err)
+	}
+	if err := client.ConfirmPasswordReset(context.Background(), parsed.OOBCode, "newPassword"); err == nil {
+		t.Errorf("ConfirmPasswordReset(used code) = nil; want error")
+	}
+}
+
+func TestApplyActionCode(t *testing.T) {
+	user := newUserWithParams(t)
+	defer deleteUser(user.UID)
+	if user.EmailVerified {
+		t.Fatalf("CreateUser() EmailVerified = true; want = false")
+	}
+	link, err := client.EmailVerificationLinkWithSettings(context.Background(), user.Email, &auth.ActionCodeSettings{
+		URL:             continueURL,
+		HandleCodeInApp: false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := auth.ParseActionLink(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Mode != auth.ActionModeVerifyEmail {
+		t.Errorf("ParseActionLink() Mode = %q; want = %q", parsed.Mode, auth.ActionModeVerifyEmail)
+	}
+
+	if err := client.ApplyActionCode(context.Background(), parsed.OOBCode); err != nil {
+		t.Fatalf("ApplyActionCode() = %v; want = nil", err)
+	}
+	user, err = client.GetUser(context.Background(), user.UID)
+	if err != nil {
+		t.Fatalf("GetUser() = %v; want = nil", err)
+	}
+	if !user.EmailVerified {
+		t.Error("ApplyActionCode() EmailVerified = false; want = true")
+	}
+	if err := client.ApplyActionCode(context.Background(), parsed.OOBCode); err == nil {
+		t.Errorf("ApplyActionCode(used code) = nil; want error")
+	}
+}
+
+func TestVerifyAndChangeEmailLink(t *testing.T) {
+	user := newUserWithParams(t)
+	defer deleteUser(user.UID)
+	newEmail := "new-" + user.Email
+	link, err := client.VerifyAndChangeEmailLinkWithSettings(
+		context.Background(), user.Email, newEmail, &auth.ActionCodeSettings{
+			URL:             continueURL,
+			HandleCodeInApp: false,
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := url.ParseRequestURI(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := parsed.Query()
+	if got := query.Get(continueURLKey); got != continueURL {
+		t.Errorf("VerifyAndChangeEmailLinkWithSettings() %s = %q; want = %q", continueURLKey, got, continueURL)
+	}
+
+	const verifyAndChangeEmail = "verifyAndChangeEmail"
+	if got := query.Get(modeKey); got != verifyAndChangeEmail {
+		t.Errorf("VerifyAndChangeEmailLinkWithSettings() %s = %q; want = %q", modeKey, got, verifyAndChangeEmail)
+	}
+}
+
 func TestEmailSignInLink(t *testing.T) {
 	user := newUserWithParams(t)
 	defer deleteUser(user.UID)
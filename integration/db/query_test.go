@@ -135,6 +135,34 @@ func TestEqualTo(t *testing.T) {
 	compareValues(t, results)
 }
 
+func TestRangeQueriesWithKey(t *testing.T) {
+	q := dinos.OrderByChild("height")
+	cases := []struct {
+		name string
+		q    *db.Query
+		want []string
+	}{
+		{"StartAtWithKey", q.StartAtWithKey(0.6, "pterodactyl"), heightSorted[1:]},
+		{"StartAfterWithKey", q.StartAfterWithKey(0.6, "linhenykus"), heightSorted[1:]},
+		{"EndAtWithKey", q.EndAtWithKey(0.6, "linhenykus"), heightSorted[:1]},
+		{"EndBeforeWithKey", q.EndBeforeWithKey(0.6, "pterodactyl"), heightSorted[:1]},
+		{"EqualToWithKey", q.EqualToWithKey(0.6, "pterodactyl"), heightSorted[1:2]},
+	}
+
+	for _, tc := range cases {
+		results, err := tc.q.GetOrdered(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		got := getNames(results)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s = %v; want = %v", tc.name, got, tc.want)
+		}
+		compareValues(t, results)
+	}
+}
+
 func TestOrderByNestedChild(t *testing.T) {
 	results, err := dinos.OrderByChild("ratings/pos").StartAt(4).GetOrdered(context.Background())
 	if err != nil {
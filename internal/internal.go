@@ -63,6 +63,14 @@ type DatabaseConfig struct {
 	AuthOverride map[string]interface{}
 }
 
+// DatabaseInstanceConfig represents the configuration of the Firebase Realtime Database management
+// service.
+type DatabaseInstanceConfig struct {
+	Opts      []option.ClientOption
+	ProjectID string
+	Version   string
+}
+
 // StorageConfig represents the configuration of Google Cloud Storage service.
 type StorageConfig struct {
 	Opts   []option.ClientOption
@@ -133,6 +133,8 @@ type Client struct {
 	client        *internal.HTTPClient
 	project       string
 	version       string
+	batchRetry    *batchRetrier
+	tokenHandler  InvalidTokenHandler
 }
 
 // Message to be sent via Firebase Cloud Messaging.
@@ -691,6 +693,28 @@ func NewClient(ctx context.Context, c *internal.MessagingConfig) (*Client, error
 	}, nil
 }
 
+// InvalidTokenHandler is a function that is called with a registration token that FCM reported
+// as no longer registered or invalid, along with the error returned for it.
+//
+// Applications typically use it to remove the token from their token store.
+type InvalidTokenHandler func(token string, err error)
+
+// WithInvalidTokenHandler returns a copy of this Client that calls the given handler for each
+// registration token that FCM reports as no longer registered or invalid.
+//
+// The handler is called by `Send()`, `SendAll()`, `SendMulticast()`, `SendEach()`,
+// `SendEachForMulticast()`, their bulk variants, `SubscribeToTopic()` and
+// `UnsubscribeFromTopic()`, before they return. It is called for messages that fail with a
+// registration-token-not-registered error, or with an error that reports a field violation on
+// `message.token`. Dry run sends only validate messages, and never call the handler. Bulk sends
+// may call the handler from multiple goroutines at the same time, so it must be safe for
+// concurrent use. A nil handler returns a copy that does not call any handler.
+func (c *Client) WithInvalidTokenHandler(h InvalidTokenHandler) *Client {
+	cp := *c
+	cp.tokenHandler = h
+	return &cp
+}
+
 // Send sends a Message to Firebase Cloud Messaging.
 //
 // The Message must specify exactly one of Token, Topic and Condition fields. FCM will
@@ -803,8 +827,11 @@ type fcmError struct {
 		Status  string `json:"status"`
 		Message string `json:"message"`
 		Details []struct {
-			Type      string `json:"@type"`
-			ErrorCode string `json:"errorCode"`
+			Type            string `json:"@type"`
+			ErrorCode       string `json:"errorCode"`
+			FieldViolations []struct {
+				Field string `json:"field"`
+			} `json:"fieldViolations"`
 		}
 	} `json:"error"`
 }
@@ -824,8 +851,17 @@ type iidError struct {
 }
 
 func (c *Client) makeSendRequest(ctx context.Context, req *fcmRequest) (string, error) {
+	resp := c.sendRequest(ctx, c.client, req)
+	return resp.MessageID, resp.Error
+}
+
+// sendRequest sends a single message using the given HTTP client, and returns its outcome as a
+// SendResponse.
+func (c *Client) sendRequest(
+	ctx context.Context, hc *internal.HTTPClient, req *fcmRequest) *SendResponse {
+
 	if err := validateMessage(req.Message); err != nil {
-		return "", err
+		return &SendResponse{Error: err}
 	}
 
 	request := &internal.Request{
@@ -838,18 +874,60 @@ func (c *Client) makeSendRequest(ctx context.Context, req *fcmRequest) (string,
 		},
 	}
 
-	resp, err := c.client.Do(ctx, request)
+	resp, err := hc.Do(ctx, request)
 	if err != nil {
-		return "", err
+		return &SendResponse{Error: err, Attempts: 1}
 	}
 
 	if resp.Status == http.StatusOK {
 		var result fcmResponse
-		err := json.Unmarshal(resp.Body, &result)
-		return result.Name, err
+		if err := json.Unmarshal(resp.Body, &result); err != nil {
+			return &SendResponse{Error: err, Attempts: 1}
+		}
+		return &SendResponse{Success: true, MessageID: result.Name, Attempts: 1}
+	}
+
+	sr := &SendResponse{
+		Error:        handleFCMError(resp),
+		Attempts:     1,
+		retryAfter:   parseRetryAfter(resp.Header),
+		invalidToken: hasTokenViolation(resp),
+	}
+	if !req.ValidateOnly {
+		c.reportInvalidToken(req.Message.Token, sr)
+	}
+	return sr
+}
+
+// reportInvalidToken calls the InvalidTokenHandler of the client, if the given response indicates
+// that the token is no longer registered or invalid.
+func (c *Client) reportInvalidToken(token string, resp *SendResponse) {
+	if c.tokenHandler == nil || token == "" || resp.Success {
+		return
+	}
+	if IsRegistrationTokenNotRegistered(resp.Error) || resp.invalidToken {
+		c.tokenHandler(token, resp.Error)
 	}
+}
 
-	return "", handleFCMError(resp)
+// hasTokenViolation checks whether the given FCM error response carries a BadRequest field
+// violation on the registration token of the message.
+func hasTokenViolation(resp *internal.Response) bool {
+	var fe fcmError
+	if err := json.Unmarshal(resp.Body, &fe); err != nil {
+		return false
+	}
+	for _, d := range fe.Error.Details {
+		if d.Type != "type.googleapis.com/google.rpc.BadRequest" {
+			continue
+		}
+		for _, fv := range d.FieldViolations {
+			if fv.Field == "message.token" {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func handleFCMError(resp *internal.Response) error {
@@ -920,6 +998,7 @@ func (c *Client) makeTopicManagementRequest(ctx context.Context, req *iidRequest
 		if err := json.Unmarshal(resp.Body, &result); err != nil {
 			return nil, err
 		}
+		c.reportInvalidTopicTokens(req.Tokens, &result)
 		return newTopicManagementResponse(&result), nil
 	}
 
@@ -935,3 +1014,18 @@ func (c *Client) makeTopicManagementRequest(ctx context.Context, req *iidRequest
 	}
 	return nil, internal.Errorf(clientCode, "http error status: %d; reason: %s", resp.Status, msg)
 }
+
+// reportInvalidTopicTokens calls the InvalidTokenHandler of the client for each token that the
+// topic management service rejected as invalid or not found.
+func (c *Client) reportInvalidTopicTokens(tokens []string, resp *iidResponse) {
+	if c.tokenHandler == nil {
+		return
+	}
+	for idx, res := range resp.Results {
+		code, _ := res["error"].(string)
+		if (code == "INVALID_ARGUMENT" || code == "NOT_FOUND") && idx < len(tokens) {
+			info := iidErrorCodes[code]
+			c.tokenHandler(tokens[idx], internal.Error(info.Code, info.Msg))
+		}
+	}
+}
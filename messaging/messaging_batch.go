@@ -27,18 +27,24 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
 
 	"firebase.google.com/go/internal"
 )
 
 const maxMessages = 100
+const maxSendEachMessages = 500
+const maxConcurrentSends = 50
 const multipartBoundary = "__END_OF_PART__"
 
 // MulticastMessage represents a message that can be sent to multiple devices via Firebase Cloud
 // Messaging (FCM).
 //
 // It contains payload information as well as the list of device registration tokens to which the
-// message should be sent. A single MulticastMessage may contain up to 100 registration tokens.
+// message should be sent. A single MulticastMessage may contain up to 100 registration tokens,
+// except when it is sent with `SendMulticastAll()`.
 type MulticastMessage struct {
 	Tokens       []string
 	Data         map[string]string
@@ -48,39 +54,50 @@ type MulticastMessage struct {
 	APNS         *APNSConfig
 }
 
-func (mm *MulticastMessage) toMessages() ([]*Message, error) {
+func (mm *MulticastMessage) toMessages(limit int) ([]*Message, error) {
 	if len(mm.Tokens) == 0 {
 		return nil, errors.New("tokens must not be nil or empty")
 	}
-	if len(mm.Tokens) > maxMessages {
-		return nil, fmt.Errorf("tokens must not contain more than %d elements", maxMessages)
+	if len(mm.Tokens) > limit {
+		return nil, fmt.Errorf("tokens must not contain more than %d elements", limit)
 	}
 
 	var messages []*Message
 	for _, token := range mm.Tokens {
-		temp := &Message{
-			Token:        token,
-			Data:         mm.Data,
-			Notification: mm.Notification,
-			Android:      mm.Android,
-			Webpush:      mm.Webpush,
-			APNS:         mm.APNS,
-		}
-		messages = append(messages, temp)
+		messages = append(messages, mm.toMessage(token))
 	}
 
 	return messages, nil
 }
 
+func (mm *MulticastMessage) toMessage(token string) *Message {
+	return &Message{
+		Token:        token,
+		Data:         mm.Data,
+		Notification: mm.Notification,
+		Android:      mm.Android,
+		Webpush:      mm.Webpush,
+		APNS:         mm.APNS,
+	}
+}
+
 // SendResponse represents the status of an individual message that was sent as part of a batch
 // request.
 type SendResponse struct {
 	Success   bool
 	MessageID string
 	Error     error
+
+	// Attempts is the number of times the message was sent to FCM. It is 0 for messages that were
+	// not sent, and may be greater than 1 for clients created with `WithBatchRetry()`.
+	Attempts int
+
+	retryAfter   time.Duration
+	invalidToken bool
 }
 
-// BatchResponse represents the response from the `SendAll()` and `SendMulticast()` APIs.
+// BatchResponse represents the response from the `SendAll()`, `SendMulticast()`, `SendEach()` and
+// `SendEachForMulticast()` APIs.
 type BatchResponse struct {
 	SuccessCount int
 	FailureCount int
@@ -123,7 +140,7 @@ func (c *Client) SendAllDryRun(ctx context.Context, messages []*Message) (*Batch
 // error from SendMulticast indicates a total failure -- i.e. the message could not be sent to any
 // of the recipients. Partial failures are indicated by a `BatchResponse` return value.
 func (c *Client) SendMulticast(ctx context.Context, message *MulticastMessage) (*BatchResponse, error) {
-	messages, err := toMessages(message)
+	messages, err := toMessages(message, maxMessages)
 	if err != nil {
 		return nil, err
 	}
@@ -143,7 +160,7 @@ func (c *Client) SendMulticast(ctx context.Context, message *MulticastMessage) (
 // indicates a total failure -- i.e. none of the messages were sent to FCM for validation. Partial
 // failures are indicated by a `BatchResponse` return value.
 func (c *Client) SendMulticastDryRun(ctx context.Context, message *MulticastMessage) (*BatchResponse, error) {
-	messages, err := toMessages(message)
+	messages, err := toMessages(message, maxMessages)
 	if err != nil {
 		return nil, err
 	}
@@ -151,12 +168,164 @@ func (c *Client) SendMulticastDryRun(ctx context.Context, message *MulticastMess
 	return c.SendAllDryRun(ctx, messages)
 }
 
-func toMessages(message *MulticastMessage) ([]*Message, error) {
+// SendEach sends the messages in the given array via Firebase Cloud Messaging.
+//
+// The messages array may contain up to 500 messages. Unlike `SendAll()`, SendEach does not use
+// the batch endpoint of FCM. Instead, it sends each message with a separate call to the FCM send
+// API, and makes up to 50 of those calls at the same time over the HTTP connections of the
+// client. The responses list obtained from the return value corresponds to the order of the input
+// messages. An error from SendEach indicates that the messages are invalid, and none of them were
+// sent. Failures to send individual messages are indicated by a `BatchResponse` return value.
+func (c *Client) SendEach(ctx context.Context, messages []*Message) (*BatchResponse, error) {
+	return c.sendEachInBatch(ctx, messages, false)
+}
+
+// SendEachDryRun sends the messages in the given array via Firebase Cloud Messaging in the
+// dry run (validation only) mode.
+//
+// This function does not actually deliver any messages to target devices. Instead, it performs all
+// the SDK-level and backend validations on the messages, and emulates the send operation.
+//
+// The messages array may contain up to 500 messages. SendEachDryRun sends each message with a
+// separate call to the FCM send API, as described for `SendEach()`. The responses list obtained
+// from the return value corresponds to the order of the input messages.
+func (c *Client) SendEachDryRun(ctx context.Context, messages []*Message) (*BatchResponse, error) {
+	return c.sendEachInBatch(ctx, messages, true)
+}
+
+// SendEachForMulticast sends the given multicast message to all the FCM registration tokens
+// specified.
+//
+// The tokens array in MulticastMessage may contain up to 500 tokens. SendEachForMulticast uses the
+// `SendEach()` function to send the given message to all the target recipients. The responses
+// list obtained from the return value corresponds to the order of the input tokens. An error from
+// SendEachForMulticast indicates that the message is invalid, and it was not sent to any of the
+// recipients.
+func (c *Client) SendEachForMulticast(ctx context.Context, message *MulticastMessage) (*BatchResponse, error) {
+	messages, err := toMessages(message, maxSendEachMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.SendEach(ctx, messages)
+}
+
+// SendEachForMulticastDryRun sends the given multicast message to all the specified FCM
+// registration tokens in the dry run (validation only) mode.
+//
+// This function does not actually deliver any messages to target devices. Instead, it performs all
+// the SDK-level and backend validations on the messages, and emulates the send operation.
+//
+// The tokens array in MulticastMessage may contain up to 500 tokens. SendEachForMulticastDryRun
+// uses the `SendEachDryRun()` function to send the given message. The responses list obtained
+// from the return value corresponds to the order of the input tokens.
+func (c *Client) SendEachForMulticastDryRun(
+	ctx context.Context, message *MulticastMessage) (*BatchResponse, error) {
+
+	messages, err := toMessages(message, maxSendEachMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.SendEachDryRun(ctx, messages)
+}
+
+func toMessages(message *MulticastMessage, limit int) ([]*Message, error) {
 	if message == nil {
 		return nil, errors.New("message must not be nil")
 	}
 
-	return message.toMessages()
+	return message.toMessages(limit)
+}
+
+func (c *Client) sendEachInBatch(
+	ctx context.Context, messages []*Message, dryRun bool) (*BatchResponse, error) {
+
+	if len(messages) == 0 {
+		return nil, errors.New("messages must not be nil or empty")
+	}
+
+	if len(messages) > maxSendEachMessages {
+		return nil, fmt.Errorf("messages must not contain more than %d elements", maxSendEachMessages)
+	}
+
+	for idx, m := range messages {
+		if err := validateMessage(m); err != nil {
+			return nil, fmt.Errorf("invalid message at index %d: %v", idx, err)
+		}
+	}
+
+	sem := make(chan struct{}, maxConcurrentSends)
+	return newBatchResponseOf(c.sendEach(ctx, messages, dryRun, sem)), nil
+}
+
+// sendEach sends each of the given messages with a separate request, and retries the messages that
+// fail with a retryable error if the Client is configured to do so. The number of concurrent
+// requests is bounded by the capacity of sem, which may be shared by multiple sendEach calls.
+// Returns a response for each message, in the order of the messages.
+func (c *Client) sendEach(
+	ctx context.Context, messages []*Message, dryRun bool, sem chan struct{}) []*SendResponse {
+
+	responses := c.sendEachOnce(ctx, messages, dryRun, sem)
+	if c.batchRetry == nil {
+		return responses
+	}
+
+	br := c.batchRetry.retry(ctx, messages, newBatchResponseOf(responses),
+		func(resend []*Message) (*BatchResponse, error) {
+			return newBatchResponseOf(c.sendEachOnce(ctx, resend, dryRun, sem)), nil
+		})
+	return br.Responses
+}
+
+func (c *Client) sendEachOnce(
+	ctx context.Context, messages []*Message, dryRun bool, sem chan struct{}) []*SendResponse {
+
+	hc := c.client
+	if c.batchRetry != nil {
+		hc = c.batchRetry.hc
+	}
+	responses := make([]*SendResponse, len(messages))
+	workers := cap(sem)
+	if len(messages) < workers {
+		workers = len(messages)
+	}
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indices {
+				req := &fcmRequest{
+					Message:      messages[idx],
+					ValidateOnly: dryRun,
+				}
+				sem <- struct{}{}
+				responses[idx] = c.sendRequest(ctx, hc, req)
+				<-sem
+			}
+		}()
+	}
+	for idx := range messages {
+		indices <- idx
+	}
+	close(indices)
+	wg.Wait()
+	return responses
+}
+
+// newBatchResponseOf creates a BatchResponse from the responses of individual messages.
+func newBatchResponseOf(responses []*SendResponse) *BatchResponse {
+	br := &BatchResponse{Responses: responses}
+	for _, r := range responses {
+		if r.Success {
+			br.SuccessCount++
+		}
+	}
+	br.FailureCount = len(responses) - br.SuccessCount
+	return br
 }
 
 func (c *Client) sendBatch(
@@ -170,6 +339,29 @@ func (c *Client) sendBatch(
 		return nil, fmt.Errorf("messages must not contain more than %d elements", maxMessages)
 	}
 
+	br, err := c.sendBatchRequest(ctx, messages, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.batchRetry != nil {
+		br = c.batchRetry.retry(ctx, messages, br, func(resend []*Message) (*BatchResponse, error) {
+			return c.sendBatchRequest(ctx, resend, dryRun)
+		})
+	}
+	if !dryRun {
+		for idx, resp := range br.Responses {
+			if idx < len(messages) {
+				c.reportInvalidToken(messages[idx].Token, resp)
+			}
+		}
+	}
+	return br, nil
+}
+
+func (c *Client) sendBatchRequest(
+	ctx context.Context, messages []*Message, dryRun bool) (*BatchResponse, error) {
+
 	request, err := c.newBatchRequest(messages, dryRun)
 	if err != nil {
 		return nil, err
@@ -187,6 +379,167 @@ func (c *Client) sendBatch(
 	return newBatchResponse(resp)
 }
 
+// BatchRetryConfig specifies how the messages that fail with a retryable error in a batch are
+// retried.
+//
+// Messages that fail because the FCM backend is unavailable, encountered an internal error, or
+// exceeded a quota are retried with exponential backoff. If FCM specifies a Retry-After delay
+// for a failed message, the messages are not retried before that delay.
+type BatchRetryConfig struct {
+	// MaxRetries is the maximum number of times a failed message is retried. Defaults to 3 when set
+	// to 0.
+	MaxRetries int
+
+	// InitialBackoff is the delay before the first retry. The delay is doubled for each following
+	// retry. Defaults to 1 second when set to 0.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the maximum delay before a retry. Messages are not retried when FCM asks for a
+	// longer delay. Defaults to 1 minute when set to 0.
+	MaxBackoff time.Duration
+}
+
+// WithBatchRetry returns a copy of this Client that automatically retries the messages that fail
+// with a retryable error in `SendAll()`, `SendMulticast()`, `SendEach()`,
+// `SendEachForMulticast()`, their dry run variants, and the bulk send functions.
+//
+// Only the failed messages are retried. `SendAll()` and `SendMulticast()` resend them in a single
+// batch request per retry, and `SendEach()` and `SendEachForMulticast()` resend them with a
+// separate request per message. The `BatchResponse` returned by the copy reports the final outcome
+// of each message, along with the number of times it was sent. If a retry request fails as a
+// whole, the outcomes of the previous attempt are reported. A nil config returns a copy that does
+// not retry.
+func (c *Client) WithBatchRetry(config *BatchRetryConfig) (*Client, error) {
+	cp := *c
+	cp.batchRetry = nil
+	if config == nil {
+		return &cp, nil
+	}
+	if config.MaxRetries < 0 || config.InitialBackoff < 0 || config.MaxBackoff < 0 {
+		return nil, errors.New("batch retry config must not contain negative values")
+	}
+
+	r := &batchRetrier{
+		maxRetries:     3,
+		initialBackoff: time.Second,
+		maxBackoff:     time.Minute,
+		sleep:          sleepWithContext,
+	}
+	if config.MaxRetries > 0 {
+		r.maxRetries = config.MaxRetries
+	}
+	if config.InitialBackoff > 0 {
+		r.initialBackoff = config.InitialBackoff
+	}
+	if config.MaxBackoff > 0 {
+		r.maxBackoff = config.MaxBackoff
+	}
+
+	// Individual sends are retried by the batchRetrier, so that each retry is counted in the
+	// Attempts of the message. Only network errors are retried by the HTTP client.
+	hc := *c.client
+	if hc.RetryConfig != nil {
+		rc := *hc.RetryConfig
+		rc.CheckForRetry = func(resp *http.Response, networkErr error) bool {
+			return networkErr != nil
+		}
+		hc.RetryConfig = &rc
+	}
+	r.hc = &hc
+	cp.batchRetry = r
+	return &cp, nil
+}
+
+type batchRetrier struct {
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	sleep          func(ctx context.Context, d time.Duration) error
+	hc             *internal.HTTPClient
+}
+
+// retry resends the messages that failed with a retryable error, and returns the final outcome
+// of all the messages.
+func (r *batchRetrier) retry(
+	ctx context.Context, messages []*Message, br *BatchResponse,
+	send func([]*Message) (*BatchResponse, error)) *BatchResponse {
+
+	for retries := 0; retries < r.maxRetries; retries++ {
+		delay := r.backoff(retries)
+		var pending []int
+		for i, resp := range br.Responses {
+			if !resp.Success && isRetryable(resp.Error) {
+				pending = append(pending, i)
+				if resp.retryAfter > delay {
+					delay = resp.retryAfter
+				}
+			}
+		}
+		if len(pending) == 0 || delay > r.maxBackoff {
+			break
+		}
+		if err := r.sleep(ctx, delay); err != nil {
+			break
+		}
+
+		var resend []*Message
+		for _, i := range pending {
+			resend = append(resend, messages[i])
+		}
+		rb, err := send(resend)
+		if err != nil || len(rb.Responses) != len(pending) {
+			break
+		}
+		for j, i := range pending {
+			rb.Responses[j].Attempts += br.Responses[i].Attempts
+			br.Responses[i] = rb.Responses[j]
+		}
+	}
+	return newBatchResponseOf(br.Responses)
+}
+
+func (r *batchRetrier) backoff(retries int) time.Duration {
+	delay := r.initialBackoff
+	for i := 0; i < retries && delay < r.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.maxBackoff {
+		delay = r.maxBackoff
+	}
+	return delay
+}
+
+func isRetryable(err error) bool {
+	return IsServerUnavailable(err) || IsInternal(err) || IsMessageRateExceeded(err)
+}
+
+// parseRetryAfter returns the delay specified by the Retry-After header, which may contain a
+// number of seconds or an HTTP date.
+func parseRetryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // part represents a HTTP request that can be sent embedded in a multipart batch request.
 //
 // See https://cloud.google.com/compute/docs/api/how-tos/batch for details on how GCP APIs support multipart batch
@@ -291,8 +644,11 @@ func newSendResponse(part *multipart.Part) (*SendResponse, error) {
 			Body:   b,
 		}
 		return &SendResponse{
-			Success: false,
-			Error:   handleFCMError(resp),
+			Success:      false,
+			Error:        handleFCMError(resp),
+			Attempts:     1,
+			retryAfter:   parseRetryAfter(hr.Header),
+			invalidToken: hasTokenViolation(resp),
 		}, nil
 	}
 
@@ -304,6 +660,7 @@ func newSendResponse(part *multipart.Part) (*SendResponse, error) {
 	return &SendResponse{
 		Success:   true,
 		MessageID: result.Name,
+		Attempts:  1,
 	}, nil
 }
 
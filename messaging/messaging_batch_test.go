@@ -26,7 +26,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/textproto"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var testMessages = []*Message{
@@ -776,3 +782,561 @@ func writeResponsePart(writer *multipart.Writer, data []byte, idx int) error {
 	_, err = part.Write(data)
 	return err
 }
+
+func TestSendEach(t *testing.T) {
+	s := &bulkServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	messages := topicMessages(3)
+	messages[1] = &Message{Token: "invalid-token"}
+	br, err := client.SendEach(context.Background(), messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBulkResponse(t, br, []string{"topic0", "invalid-token", "topic2"})
+	if len(s.batches) != 0 || len(s.sends) != 3 {
+		t.Errorf("Requests = (%d batches, %d sends); want = (0, 3)", len(s.batches), len(s.sends))
+	}
+	for _, req := range s.sends {
+		if req.ValidateOnly {
+			t.Errorf("ValidateOnly = true; want = false")
+		}
+	}
+}
+
+func TestSendEachDryRun(t *testing.T) {
+	s := &bulkServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	br, err := client.SendEachDryRun(context.Background(), testMessages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBulkResponse(t, br, []string{"topic1", "topic2"})
+	for _, req := range s.sends {
+		if !req.ValidateOnly {
+			t.Errorf("ValidateOnly = false; want = true")
+		}
+	}
+}
+
+func TestSendEachConcurrency(t *testing.T) {
+	s := &bulkServer{delay: 20 * time.Millisecond}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	messages := topicMessages(maxSendEachMessages)
+	br, err := client.SendEach(context.Background(), messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if br.SuccessCount != maxSendEachMessages {
+		t.Errorf("SuccessCount = %d; want = %d", br.SuccessCount, maxSendEachMessages)
+	}
+	if s.maxSeen > maxConcurrentSends {
+		t.Errorf("Concurrent requests = %d; want <= %d", s.maxSeen, maxConcurrentSends)
+	}
+}
+
+func TestSendEachInvalidArgs(t *testing.T) {
+	s := &bulkServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	cases := map[string][]*Message{
+		"nil":      nil,
+		"empty":    {},
+		"too many": topicMessages(maxSendEachMessages + 1),
+		"invalid":  {{Topic: "topic1"}, {}},
+	}
+	for name, tc := range cases {
+		if br, err := client.SendEach(context.Background(), tc); br != nil || err == nil {
+			t.Errorf("SendEach(%s) = (%v, %v); want = (nil, error)", name, br, err)
+		}
+	}
+	if len(s.sends) != 0 {
+		t.Errorf("Requests = %d; want = 0", len(s.sends))
+	}
+}
+
+func TestSendEachForMulticast(t *testing.T) {
+	s := &bulkServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	var tokens []string
+	for i := 0; i < 300; i++ {
+		tokens = append(tokens, fmt.Sprintf("token%d", i))
+	}
+	br, err := client.SendEachForMulticast(context.Background(), &MulticastMessage{Tokens: tokens})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBulkResponse(t, br, tokens)
+
+	br, err = client.SendEachForMulticastDryRun(context.Background(), testMulticastMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBulkResponse(t, br, testMulticastMessage.Tokens)
+	if last := s.sends[len(s.sends)-1]; !last.ValidateOnly {
+		t.Errorf("ValidateOnly = false; want = true")
+	}
+}
+
+func TestSendEachForMulticastInvalidArgs(t *testing.T) {
+	client, err := NewClient(context.Background(), testMessagingConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tokens []string
+	for i := 0; i < maxSendEachMessages+1; i++ {
+		tokens = append(tokens, fmt.Sprintf("token%d", i))
+	}
+	cases := []*MulticastMessage{
+		nil,
+		{},
+		{Tokens: tokens},
+		{Tokens: []string{"token1", ""}},
+	}
+	for _, tc := range cases {
+		if br, err := client.SendEachForMulticast(context.Background(), tc); br != nil || err == nil {
+			t.Errorf("SendEachForMulticast(%v) = (%v, %v); want = (nil, error)", tc, br, err)
+		}
+	}
+}
+
+const unavailableResponse = `{
+	"error": {
+		"status": "UNAVAILABLE",
+		"message": "test error",
+		"details": [
+			{
+				"@type": "type.googleapis.com/google.firebase.fcm.v1.FcmError",
+				"errorCode": "UNAVAILABLE"
+			}
+		]
+	}
+}`
+
+const quotaExceededResponse = `{
+	"error": {
+		"status": "RESOURCE_EXHAUSTED",
+		"message": "test error",
+		"details": [
+			{
+				"@type": "type.googleapis.com/google.firebase.fcm.v1.FcmError",
+				"errorCode": "QUOTA_EXCEEDED"
+			}
+		]
+	}
+}`
+
+const invalidArgumentResponse = `{
+	"error": {
+		"status": "INVALID_ARGUMENT",
+		"message": "test error"
+	}
+}`
+
+// flakyBatchServer is a fake batch and send endpoint that fails messages sent to targets of the
+// form "<kind>-<n>" the first n times they are sent. Unavailable and quota errors are retryable,
+// while invalid errors are not.
+type flakyBatchServer struct {
+	mu       sync.Mutex
+	sent     map[string]int
+	batches  [][]string
+	quotaHdr string
+}
+
+func (s *flakyBatchServer) handle(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, ":send") {
+		s.handleSend(w, r)
+		return
+	}
+
+	reqs, err := parseBatchRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var topics []string
+	var buffer bytes.Buffer
+	writer := multipart.NewWriter(&buffer)
+	writer.SetBoundary(multipartBoundary)
+	for idx, req := range reqs {
+		topic := req.Message.Topic + req.Message.Token
+		topics = append(topics, topic)
+		if err := writeResponsePart(writer, s.respond(topic), idx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writer.Close()
+	s.batches = append(s.batches, topics)
+	w.Header().Set("Content-Type", wantMime)
+	w.Write(buffer.Bytes())
+}
+
+// handleSend handles requests to the single message send endpoint, by writing the same response
+// that would be embedded in a batch response.
+func (s *flakyBatchServer) handleSend(w http.ResponseWriter, r *http.Request) {
+	var req fcmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	part := s.respond(req.Message.Topic + req.Message.Token)
+	s.mu.Unlock()
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(part)), r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// respond records a message sent to the given target, and returns the HTTP response for it.
+func (s *flakyBatchServer) respond(topic string) []byte {
+	s.sent[topic]++
+	var kind string
+	var failures int
+	if i := strings.LastIndex(topic, "-"); i > 0 {
+		kind = topic[:i]
+		failures, _ = strconv.Atoi(topic[i+1:])
+	}
+
+	var part bytes.Buffer
+	if s.sent[topic] > failures {
+		b, _ := json.Marshal(&fcmResponse{Name: "projects/test-project/messages/" + topic})
+		part.WriteString("HTTP/1.1 200 OK\r\n")
+		part.WriteString("Content-Type: application/json\r\n\r\n")
+		part.Write(b)
+		return part.Bytes()
+	}
+	switch kind {
+	case "unavailable":
+		part.WriteString("HTTP/1.1 503 Service Unavailable\r\n")
+		part.WriteString("Content-Type: application/json\r\n\r\n")
+		part.WriteString(unavailableResponse)
+	case "quota":
+		part.WriteString("HTTP/1.1 429 Too Many Requests\r\n")
+		part.WriteString("Content-Type: application/json\r\n")
+		part.WriteString("Retry-After: " + s.quotaHdr + "\r\n\r\n")
+		part.WriteString(quotaExceededResponse)
+	default:
+		part.WriteString("HTTP/1.1 400 Bad Request\r\n")
+		part.WriteString("Content-Type: application/json\r\n\r\n")
+		part.WriteString(invalidArgumentResponse)
+	}
+	return part.Bytes()
+}
+
+func newRetryClient(
+	t *testing.T, s *flakyBatchServer, config *BatchRetryConfig) (*Client, *[]time.Duration, *httptest.Server) {
+
+	s.sent = make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(s.handle))
+	client, err := NewClient(context.Background(), testMessagingConfig)
+	if err != nil {
+		ts.Close()
+		t.Fatal(err)
+	}
+	client.batchEndpoint = ts.URL
+	client.fcmEndpoint = ts.URL
+	client, err = client.WithBatchRetry(config)
+	if err != nil {
+		ts.Close()
+		t.Fatal(err)
+	}
+
+	var delays []time.Duration
+	if client.batchRetry != nil {
+		client.batchRetry.sleep = func(ctx context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return ctx.Err()
+		}
+	}
+	return client, &delays, ts
+}
+
+func TestSendAllWithBatchRetry(t *testing.T) {
+	s := &flakyBatchServer{}
+	client, delays, ts := newRetryClient(t, s, &BatchRetryConfig{InitialBackoff: 10 * time.Millisecond})
+	defer ts.Close()
+
+	messages := []*Message{
+		{Topic: "ok"},
+		{Topic: "unavailable-2"},
+		{Topic: "invalid-1"},
+		{Topic: "unavailable-1"},
+		{Topic: "unavailable-5"},
+	}
+	br, err := client.SendAll(context.Background(), messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantAttempts := []int{1, 3, 1, 2, 4}
+	wantSuccess := []bool{true, true, false, true, false}
+	for i, r := range br.Responses {
+		if r.Attempts != wantAttempts[i] || r.Success != wantSuccess[i] {
+			t.Errorf("Responses[%d] = (%v, %d); want = (%v, %d)",
+				i, r.Success, r.Attempts, wantSuccess[i], wantAttempts[i])
+		}
+	}
+	if !IsInvalidArgument(br.Responses[2].Error) {
+		t.Errorf("Responses[2].Error = %v; want = invalid argument", br.Responses[2].Error)
+	}
+	if !IsServerUnavailable(br.Responses[4].Error) {
+		t.Errorf("Responses[4].Error = %v; want = server unavailable", br.Responses[4].Error)
+	}
+	if br.SuccessCount != 3 || br.FailureCount != 2 {
+		t.Errorf("BatchResponse = (%d, %d); want = (3, 2)", br.SuccessCount, br.FailureCount)
+	}
+
+	wantBatches := "[[ok unavailable-2 invalid-1 unavailable-1 unavailable-5] " +
+		"[unavailable-2 unavailable-1 unavailable-5] [unavailable-2 unavailable-5] [unavailable-5]]"
+	if got := fmt.Sprint(s.batches); got != wantBatches {
+		t.Errorf("Batches = %s; want = %s", got, wantBatches)
+	}
+	wantDelays := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond}
+	if fmt.Sprint(*delays) != fmt.Sprint(wantDelays) {
+		t.Errorf("Delays = %v; want = %v", *delays, wantDelays)
+	}
+}
+
+func TestSendMulticastWithBatchRetry(t *testing.T) {
+	s := &flakyBatchServer{}
+	client, _, ts := newRetryClient(t, s, nil)
+	defer ts.Close()
+
+	br, err := client.SendAll(context.Background(), []*Message{{Topic: "unavailable-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := br.Responses[0]; r.Success || r.Attempts != 1 {
+		t.Errorf("SendAll() = (%v, %d); want = (false, 1)", r.Success, r.Attempts)
+	}
+
+	client, _, ts2 := newRetryClient(t, s, &BatchRetryConfig{MaxRetries: 1})
+	defer ts2.Close()
+	mm := &MulticastMessage{Tokens: []string{"invalid-1", "unavailable-1", "unavailable-2"}}
+	br, err = client.SendMulticastDryRun(context.Background(), mm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantAttempts := []int{1, 2, 2}
+	wantSuccess := []bool{false, true, false}
+	for i, r := range br.Responses {
+		if r.Success != wantSuccess[i] || r.Attempts != wantAttempts[i] {
+			t.Errorf("Responses[%d] = (%v, %d); want = (%v, %d)",
+				i, r.Success, r.Attempts, wantSuccess[i], wantAttempts[i])
+		}
+	}
+}
+
+func TestSendEachWithBatchRetry(t *testing.T) {
+	s := &flakyBatchServer{quotaHdr: "2"}
+	client, delays, ts := newRetryClient(t, s, &BatchRetryConfig{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+	})
+	defer ts.Close()
+
+	messages := []*Message{
+		{Topic: "ok"},
+		{Topic: "unavailable-2"},
+		{Topic: "invalid-1"},
+		{Topic: "quota-1"},
+		{Topic: "unavailable-5"},
+	}
+	br, err := client.SendEach(context.Background(), messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantAttempts := []int{1, 3, 1, 2, 4}
+	wantSuccess := []bool{true, true, false, true, false}
+	for i, r := range br.Responses {
+		if r.Attempts != wantAttempts[i] || r.Success != wantSuccess[i] {
+			t.Errorf("Responses[%d] = (%v, %d); want = (%v, %d)",
+				i, r.Success, r.Attempts, wantSuccess[i], wantAttempts[i])
+		}
+	}
+	if br.SuccessCount != 3 || br.FailureCount != 2 {
+		t.Errorf("BatchResponse = (%d, %d); want = (3, 2)", br.SuccessCount, br.FailureCount)
+	}
+	if len(s.batches) != 0 {
+		t.Errorf("Batches = %d; want = 0", len(s.batches))
+	}
+	wantDelays := []time.Duration{2 * time.Second, 20 * time.Millisecond, 40 * time.Millisecond}
+	if fmt.Sprint(*delays) != fmt.Sprint(wantDelays) {
+		t.Errorf("Delays = %v; want = %v", *delays, wantDelays)
+	}
+
+	mm := &MulticastMessage{Tokens: []string{"unavailable-1"}}
+	br, err = client.SendEachForMulticastDryRun(context.Background(), mm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := br.Responses[0]; !r.Success || r.Attempts != 2 {
+		t.Errorf("SendEachForMulticastDryRun() = (%v, %d); want = (true, 2)", r.Success, r.Attempts)
+	}
+}
+
+func TestBatchRetryAfter(t *testing.T) {
+	s := &flakyBatchServer{quotaHdr: "2"}
+	client, delays, ts := newRetryClient(t, s, &BatchRetryConfig{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+	})
+	defer ts.Close()
+
+	messages := []*Message{{Topic: "quota-1"}, {Topic: "unavailable-1"}}
+	br, err := client.SendAll(context.Background(), messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if br.SuccessCount != 2 {
+		t.Errorf("SuccessCount = %d; want = 2", br.SuccessCount)
+	}
+	if fmt.Sprint(*delays) != "[2s]" {
+		t.Errorf("Delays = %v; want = [2s]", *delays)
+	}
+
+	// Retry-After delays longer than MaxBackoff are not honored by retrying sooner.
+	s.quotaHdr = "60"
+	br, err = client.SendAll(context.Background(), []*Message{{Topic: "quota-5"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := br.Responses[0]; r.Success || r.Attempts != 1 || !IsMessageRateExceeded(r.Error) {
+		t.Errorf("SendAll() = (%v, %d, %v); want = (false, 1, quota exceeded)",
+			r.Success, r.Attempts, r.Error)
+	}
+}
+
+func TestBatchRetryCancelled(t *testing.T) {
+	s := &flakyBatchServer{}
+	client, _, ts := newRetryClient(t, s, &BatchRetryConfig{})
+	defer ts.Close()
+	client.batchRetry.sleep = sleepWithContext
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	br, err := client.SendAll(ctx, []*Message{{Topic: "unavailable-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := br.Responses[0]; r.Success || r.Attempts != 1 {
+		t.Errorf("SendAll() = (%v, %d); want = (false, 1)", r.Success, r.Attempts)
+	}
+}
+
+func TestWithBatchRetryInvalidConfig(t *testing.T) {
+	client, err := NewClient(context.Background(), testMessagingConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []*BatchRetryConfig{
+		{MaxRetries: -1},
+		{InitialBackoff: -1},
+		{MaxBackoff: -1},
+	}
+	for _, tc := range cases {
+		if c, err := client.WithBatchRetry(tc); c != nil || err == nil {
+			t.Errorf("WithBatchRetry(%+v) = (%v, %v); want = (nil, error)", tc, c, err)
+		}
+	}
+	if client.batchRetry != nil {
+		t.Errorf("WithBatchRetry() modified the original client")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	cases := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"30", 30 * time.Second},
+		{"invalid", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), -time.Hour},
+	}
+	for _, tc := range cases {
+		h := http.Header{}
+		if tc.header != "" {
+			h.Set("Retry-After", tc.header)
+		}
+		got := parseRetryAfter(h)
+		if diff := got - tc.want; diff < -2*time.Second || diff > 2*time.Second {
+			t.Errorf("parseRetryAfter(%q) = %v; want = %v", tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestInvalidTokenHandlerBatch(t *testing.T) {
+	s := &bulkServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	var mu sync.Mutex
+	var got []string
+	client = client.WithInvalidTokenHandler(func(token string, err error) {
+		if !IsRegistrationTokenNotRegistered(err) {
+			t.Errorf("InvalidTokenHandler(%q) error = %v; want not registered", token, err)
+		}
+		mu.Lock()
+		got = append(got, token)
+		mu.Unlock()
+	})
+
+	ctx := context.Background()
+	mm := &MulticastMessage{Tokens: []string{"token1", "invalid1", "token2"}}
+	if _, err := client.SendMulticast(ctx, mm); err != nil {
+		t.Fatal(err)
+	}
+	messages := []*Message{{Token: "invalid2"}, {Topic: "invalid-topic"}, {Token: "token3"}}
+	if _, err := client.SendAll(ctx, messages); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.SendEach(ctx, []*Message{{Token: "invalid3"}}); err != nil {
+		t.Fatal(err)
+	}
+	// Dry run sends do not call the handler.
+	if _, err := client.SendAllDryRun(ctx, []*Message{{Token: "invalid7"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.SendEachDryRun(ctx, []*Message{{Token: "invalid8"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.SendEachForMulticast(ctx, &MulticastMessage{Tokens: []string{"invalid4"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.SendMulticastAll(ctx, &MulticastMessage{
+		Tokens: []string{"invalid5", "invalid6", "token4"},
+	}, &BulkOptions{BatchSize: 1, MaxConcurrency: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(got)
+	want := []string{"invalid1", "invalid2", "invalid3", "invalid4", "invalid5", "invalid6"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InvalidTokenHandler tokens = %v; want = %v", got, want)
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BulkOptions specifies how the bulk send functions split messages into batches, and send them.
+type BulkOptions struct {
+	// BatchSize is the number of messages sent in each batch request. Must not be greater than
+	// 100, or 500 when UseSendEach is set. Defaults to the maximum when set to 0.
+	BatchSize int
+
+	// MaxConcurrency is the maximum number of batches sent at the same time. Defaults to 1 when set
+	// to 0. When UseSendEach is set, the individual requests of all batches additionally share a
+	// limit of 50 concurrent requests.
+	MaxConcurrency int
+
+	// MessagesPerSecond limits the average rate at which messages are sent. A batch request is
+	// delayed until sending all of its messages stays within the limit. Set to 0 for no limit.
+	MessagesPerSecond float64
+
+	// DryRun sends the messages in the dry run (validation only) mode.
+	DryRun bool
+
+	// UseSendEach sends each batch with `SendEach()`, which makes a separate call to the FCM send
+	// API for each message, instead of the batch endpoint used by `SendAll()`.
+	UseSendEach bool
+}
+
+// SendAllInBatches sends the messages in the given array via Firebase Cloud Messaging.
+//
+// Unlike `SendAll()`, the messages array may contain any number of messages. The messages are
+// split into batches, which are sent as specified by the options. The responses list obtained
+// from the return value corresponds to the order of the input messages. Invalid messages, and
+// messages in batches that could not be sent, are reported as failures in the `BatchResponse`.
+// An error from SendAllInBatches indicates that the arguments are invalid, and no messages were
+// sent.
+func (c *Client) SendAllInBatches(
+	ctx context.Context, messages []*Message, opts *BulkOptions) (*BatchResponse, error) {
+
+	if len(messages) == 0 {
+		return nil, errors.New("messages must not be nil or empty")
+	}
+
+	idx := 0
+	next := func() (*Message, bool) {
+		if idx == len(messages) {
+			return nil, false
+		}
+		idx++
+		return messages[idx-1], true
+	}
+	return c.sendBulk(ctx, next, opts)
+}
+
+// SendMulticastAll sends the given multicast message to all the FCM registration tokens
+// specified.
+//
+// Unlike `SendMulticast()`, the tokens array in MulticastMessage may contain any number of tokens.
+// The message is sent to the tokens in batches, as specified by the options. The responses list
+// obtained from the return value corresponds to the order of the input tokens. An error from
+// SendMulticastAll indicates that the arguments are invalid, and the message was not sent to any
+// of the recipients.
+func (c *Client) SendMulticastAll(
+	ctx context.Context, message *MulticastMessage, opts *BulkOptions) (*BatchResponse, error) {
+
+	if message == nil {
+		return nil, errors.New("message must not be nil")
+	}
+	if len(message.Tokens) == 0 {
+		return nil, errors.New("tokens must not be nil or empty")
+	}
+
+	idx := 0
+	next := func() (*Message, bool) {
+		if idx == len(message.Tokens) {
+			return nil, false
+		}
+		idx++
+		return message.toMessage(message.Tokens[idx-1]), true
+	}
+	return c.sendBulk(ctx, next, opts)
+}
+
+// SendAllFromChannel sends the messages received from the given channel via Firebase Cloud
+// Messaging.
+//
+// Messages are read from the channel until it is closed, and sent in batches as specified by the
+// options. The responses list obtained from the return value corresponds to the order in which
+// the messages were received. If the context is cancelled before the channel is closed,
+// SendAllFromChannel stops reading from the channel, and returns the responses of the messages
+// received so far along with the error of the context.
+func (c *Client) SendAllFromChannel(
+	ctx context.Context, messages <-chan *Message, opts *BulkOptions) (*BatchResponse, error) {
+
+	if messages == nil {
+		return nil, errors.New("messages channel must not be nil")
+	}
+
+	next := func() (*Message, bool) {
+		select {
+		case m, ok := <-messages:
+			return m, ok
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+	br, err := c.sendBulk(ctx, next, opts)
+	if err != nil {
+		return nil, err
+	}
+	return br, ctx.Err()
+}
+
+// bulkChunk is a batch of messages, along with the position of its first message in the input.
+type bulkChunk struct {
+	start    int
+	messages []*Message
+}
+
+// sendBulk reads messages from next until it returns false, and sends them in batches.
+func (c *Client) sendBulk(
+	ctx context.Context, next func() (*Message, bool), opts *BulkOptions) (*BatchResponse, error) {
+
+	limit := maxMessages
+	if opts != nil && opts.UseSendEach {
+		limit = maxSendEachMessages
+	}
+	batchSize, concurrency := limit, 1
+	var limiter *rateLimiter
+	var dryRun, useSendEach bool
+	if opts != nil {
+		if opts.BatchSize < 0 || opts.BatchSize > limit {
+			return nil, fmt.Errorf("batch size must be between 1 and %d", limit)
+		}
+		if opts.MaxConcurrency < 0 {
+			return nil, errors.New("max concurrency must not be negative")
+		}
+		if opts.MessagesPerSecond < 0 {
+			return nil, errors.New("messages per second must not be negative")
+		}
+		if opts.BatchSize > 0 {
+			batchSize = opts.BatchSize
+		}
+		if opts.MaxConcurrency > 0 {
+			concurrency = opts.MaxConcurrency
+		}
+		limiter = newRateLimiter(opts.MessagesPerSecond)
+		dryRun = opts.DryRun
+		useSendEach = opts.UseSendEach
+	}
+
+	// All batches share the concurrency limit of the individual send requests.
+	var sem chan struct{}
+	if useSendEach {
+		sem = make(chan struct{}, maxConcurrentSends)
+	}
+	var mu sync.Mutex
+	var responses []*SendResponse
+	chunks := make(chan *bulkChunk)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunks {
+				results := c.sendChunk(ctx, chunk.messages, dryRun, sem, limiter)
+				mu.Lock()
+				copy(responses[chunk.start:], results)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	start := 0
+	var batch []*Message
+	dispatch := func() {
+		mu.Lock()
+		responses = append(responses, make([]*SendResponse, len(batch))...)
+		mu.Unlock()
+		chunks <- &bulkChunk{start: start, messages: batch}
+		start += len(batch)
+		batch = nil
+	}
+	for {
+		m, ok := next()
+		if !ok {
+			break
+		}
+		batch = append(batch, m)
+		if len(batch) == batchSize {
+			dispatch()
+		}
+	}
+	if len(batch) > 0 {
+		dispatch()
+	}
+	close(chunks)
+	wg.Wait()
+
+	return newBatchResponseOf(responses), nil
+}
+
+// sendChunk sends a batch of messages, and returns a response for each message. Invalid messages
+// are not sent, and are reported as failures. Messages are sent with sendEach when sem is not nil,
+// and as a single batch request otherwise.
+func (c *Client) sendChunk(
+	ctx context.Context, messages []*Message, dryRun bool, sem chan struct{},
+	limiter *rateLimiter) []*SendResponse {
+
+	results := make([]*SendResponse, len(messages))
+	var valid []*Message
+	var positions []int
+	for i, m := range messages {
+		if err := validateMessage(m); err != nil {
+			results[i] = &SendResponse{Error: err}
+			continue
+		}
+		valid = append(valid, m)
+		positions = append(positions, i)
+	}
+	if len(valid) == 0 {
+		return results
+	}
+
+	fail := func(err error, attempts int) []*SendResponse {
+		for _, i := range positions {
+			results[i] = &SendResponse{Error: err, Attempts: attempts}
+		}
+		return results
+	}
+	if err := limiter.wait(ctx, len(valid)); err != nil {
+		return fail(err, 0)
+	}
+	if err := ctx.Err(); err != nil {
+		return fail(err, 0)
+	}
+	if sem != nil {
+		for j, r := range c.sendEach(ctx, valid, dryRun, sem) {
+			results[positions[j]] = r
+		}
+		return results
+	}
+	br, err := c.sendBatch(ctx, valid, dryRun)
+	if err != nil {
+		return fail(err, 1)
+	}
+	if len(br.Responses) != len(valid) {
+		return fail(fmt.Errorf("batch response contains %d responses; want %d",
+			len(br.Responses), len(valid)), 1)
+	}
+	for j, i := range positions {
+		results[i] = br.Responses[j]
+	}
+	return results
+}
+
+// rateLimiter spaces out requests so that the number of messages sent per second does not
+// exceed a limit on average. A nil rateLimiter does not limit the rate.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait blocks until n more messages can be sent, or the context is done.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(time.Duration(n) * l.interval)
+	l.mu.Unlock()
+
+	delay := start.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
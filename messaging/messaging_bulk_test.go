@@ -0,0 +1,566 @@
+// Copyright 2019 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package messaging
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const notRegisteredResponse = `{
+	"error": {
+		"status": "NOT_FOUND",
+		"message": "test error",
+		"details": [
+			{
+				"@type": "type.googleapis.com/google.firebase.fcm.v1.FcmError",
+				"errorCode": "UNREGISTERED"
+			}
+		]
+	}
+}`
+
+// bulkServer is a fake of the send and batch endpoints of FCM. It responds to each message with a
+// message ID derived from the target of the message, and fails messages sent to targets that start
+// with "invalid".
+type bulkServer struct {
+	mu       sync.Mutex
+	batches  [][]*fcmRequest
+	sends    []*fcmRequest
+	inFlight int
+	maxSeen  int
+	delay    time.Duration
+}
+
+func (s *bulkServer) start(t *testing.T) (*Client, *httptest.Server) {
+	ts := httptest.NewServer(http.HandlerFunc(s.handle))
+	client, err := NewClient(context.Background(), testMessagingConfig)
+	if err != nil {
+		ts.Close()
+		t.Fatal(err)
+	}
+	client.batchEndpoint = ts.URL
+	client.fcmEndpoint = ts.URL
+	return client, ts
+}
+
+func (s *bulkServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxSeen {
+		s.maxSeen = s.inFlight
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+	time.Sleep(s.delay)
+
+	if strings.HasSuffix(r.URL.Path, ":send") {
+		s.handleSend(w, r)
+		return
+	}
+	reqs, err := parseBatchRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.batches = append(s.batches, reqs)
+	s.mu.Unlock()
+
+	var buffer bytes.Buffer
+	writer := multipart.NewWriter(&buffer)
+	writer.SetBoundary(multipartBoundary)
+	for idx, req := range reqs {
+		status, body := s.respond(req)
+		var part bytes.Buffer
+		fmt.Fprintf(&part, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+		part.WriteString("Content-Type: application/json\r\n\r\n")
+		part.WriteString(body)
+		if err := writeResponsePart(writer, part.Bytes(), idx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writer.Close()
+	w.Header().Set("Content-Type", wantMime)
+	w.Write(buffer.Bytes())
+}
+
+func (s *bulkServer) handleSend(w http.ResponseWriter, r *http.Request) {
+	var req fcmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.sends = append(s.sends, &req)
+	s.mu.Unlock()
+
+	status, body := s.respond(&req)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+}
+
+func (s *bulkServer) respond(req *fcmRequest) (int, string) {
+	target := req.Message.Token + req.Message.Topic
+	if strings.HasPrefix(target, "invalid") {
+		return http.StatusNotFound, notRegisteredResponse
+	}
+	b, _ := json.Marshal(&fcmResponse{Name: "projects/test-project/messages/" + target})
+	return http.StatusOK, string(b)
+}
+
+func (s *bulkServer) batchSizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sizes []int
+	for _, b := range s.batches {
+		sizes = append(sizes, len(b))
+	}
+	return sizes
+}
+
+func parseBatchRequest(r *http.Request) ([]*fcmRequest, error) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	var reqs []*fcmRequest
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return reqs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		hr, err := http.ReadRequest(bufio.NewReader(part))
+		if err != nil {
+			return nil, err
+		}
+		var req fcmRequest
+		if err := json.NewDecoder(hr.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, &req)
+	}
+}
+
+func topicMessages(n int) []*Message {
+	var messages []*Message
+	for i := 0; i < n; i++ {
+		messages = append(messages, &Message{Topic: fmt.Sprintf("topic%d", i)})
+	}
+	return messages
+}
+
+func checkBulkResponse(t *testing.T, br *BatchResponse, targets []string) {
+	if len(br.Responses) != len(targets) {
+		t.Fatalf("Responses = %d; want = %d", len(br.Responses), len(targets))
+	}
+	failures := 0
+	for i, target := range targets {
+		r := br.Responses[i]
+		if strings.HasPrefix(target, "invalid") {
+			failures++
+			if r.Success || !IsRegistrationTokenNotRegistered(r.Error) {
+				t.Errorf("Responses[%d] = %+v; want not registered error", i, r)
+			}
+			continue
+		}
+		if err := checkSuccessfulSendResponse(r, "projects/test-project/messages/"+target); err != nil {
+			t.Errorf("Responses[%d]: %v", i, err)
+		}
+	}
+	if br.SuccessCount != len(targets)-failures || br.FailureCount != failures {
+		t.Errorf("BatchResponse = (%d, %d); want = (%d, %d)",
+			br.SuccessCount, br.FailureCount, len(targets)-failures, failures)
+	}
+}
+
+func TestSendAllInBatches(t *testing.T) {
+	s := &bulkServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	messages := topicMessages(250)
+	br, err := client.SendAllInBatches(context.Background(), messages, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets []string
+	for _, m := range messages {
+		targets = append(targets, m.Topic)
+	}
+	checkBulkResponse(t, br, targets)
+	if sizes := s.batchSizes(); fmt.Sprint(sizes) != "[100 100 50]" {
+		t.Errorf("Batches = %v; want = [100 100 50]", sizes)
+	}
+	for _, b := range s.batches {
+		for _, req := range b {
+			if req.ValidateOnly {
+				t.Errorf("ValidateOnly = true; want = false")
+			}
+		}
+	}
+}
+
+func TestSendAllInBatchesConcurrency(t *testing.T) {
+	s := &bulkServer{delay: 20 * time.Millisecond}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	messages := topicMessages(100)
+	messages[17] = &Message{Token: "invalid-token"}
+	br, err := client.SendAllInBatches(context.Background(), messages, &BulkOptions{
+		BatchSize:      10,
+		MaxConcurrency: 3,
+		DryRun:         true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets []string
+	for _, m := range messages {
+		targets = append(targets, m.Topic+m.Token)
+	}
+	checkBulkResponse(t, br, targets)
+	if len(s.batches) != 10 {
+		t.Errorf("Batches = %d; want = 10", len(s.batches))
+	}
+	if s.maxSeen < 2 || s.maxSeen > 3 {
+		t.Errorf("Concurrent requests = %d; want = 2 or 3", s.maxSeen)
+	}
+	for _, b := range s.batches {
+		for _, req := range b {
+			if !req.ValidateOnly {
+				t.Errorf("ValidateOnly = false; want = true")
+			}
+		}
+	}
+}
+
+func TestSendAllInBatchesInvalidMessage(t *testing.T) {
+	s := &bulkServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	messages := []*Message{{Topic: "topic0"}, nil, {Topic: "topic2"}, {}}
+	br, err := client.SendAllInBatches(context.Background(), messages, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if br.SuccessCount != 2 || br.FailureCount != 2 {
+		t.Errorf("BatchResponse = (%d, %d); want = (2, 2)", br.SuccessCount, br.FailureCount)
+	}
+	for _, i := range []int{1, 3} {
+		if r := br.Responses[i]; r.Success || r.Error == nil {
+			t.Errorf("Responses[%d] = %+v; want error", i, r)
+		}
+	}
+	if sizes := s.batchSizes(); fmt.Sprint(sizes) != "[2]" {
+		t.Errorf("Batches = %v; want = [2]", sizes)
+	}
+}
+
+func TestSendAllInBatchesBatchFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error": {"status": "PERMISSION_DENIED", "message": "test error"}}`))
+	}))
+	defer ts.Close()
+	client, err := NewClient(context.Background(), testMessagingConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.batchEndpoint = ts.URL
+
+	br, err := client.SendAllInBatches(context.Background(), topicMessages(3), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if br.SuccessCount != 0 || br.FailureCount != 3 {
+		t.Errorf("BatchResponse = (%d, %d); want = (0, 3)", br.SuccessCount, br.FailureCount)
+	}
+	for i, r := range br.Responses {
+		if !IsMismatchedCredential(r.Error) {
+			t.Errorf("Responses[%d] = %v; want = mismatched credential error", i, r.Error)
+		}
+	}
+}
+
+func TestSendAllInBatchesInvalidArgs(t *testing.T) {
+	client, err := NewClient(context.Background(), testMessagingConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.SendAllInBatches(context.Background(), nil, nil); err == nil {
+		t.Errorf("SendAllInBatches(nil) = nil; want error")
+	}
+	cases := []*BulkOptions{
+		{BatchSize: -1},
+		{BatchSize: 101},
+		{MaxConcurrency: -1},
+		{MessagesPerSecond: -1},
+	}
+	for _, tc := range cases {
+		if _, err := client.SendAllInBatches(context.Background(), testMessages, tc); err == nil {
+			t.Errorf("SendAllInBatches(%+v) = nil; want error", tc)
+		}
+	}
+}
+
+func TestSendAllInBatchesRateLimit(t *testing.T) {
+	s := &bulkServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	begin := time.Now()
+	br, err := client.SendAllInBatches(context.Background(), topicMessages(30), &BulkOptions{
+		BatchSize:         10,
+		MaxConcurrency:    3,
+		MessagesPerSecond: 200,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first batch is sent immediately, and each following batch 50ms after the previous one.
+	if elapsed := time.Since(begin); elapsed < 100*time.Millisecond {
+		t.Errorf("SendAllInBatches() took %v; want >= 100ms", elapsed)
+	}
+	if br.SuccessCount != 30 {
+		t.Errorf("SuccessCount = %d; want = 30", br.SuccessCount)
+	}
+}
+
+func TestSendAllInBatchesCancelled(t *testing.T) {
+	s := &bulkServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	br, err := client.SendAllInBatches(ctx, topicMessages(5), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if br.FailureCount != 5 {
+		t.Errorf("FailureCount = %d; want = 5", br.FailureCount)
+	}
+	for i, r := range br.Responses {
+		if r.Error != context.Canceled {
+			t.Errorf("Responses[%d] = %v; want = %v", i, r.Error, context.Canceled)
+		}
+	}
+	if len(s.batches) != 0 {
+		t.Errorf("Batches = %d; want = 0", len(s.batches))
+	}
+}
+
+func TestSendAllInBatchesUseSendEach(t *testing.T) {
+	s := &bulkServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	messages := topicMessages(120)
+	messages[110] = &Message{Token: "invalid-token"}
+	br, err := client.SendAllInBatches(context.Background(), messages, &BulkOptions{
+		BatchSize:   60,
+		UseSendEach: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets []string
+	for _, m := range messages {
+		targets = append(targets, m.Topic+m.Token)
+	}
+	checkBulkResponse(t, br, targets)
+	if len(s.batches) != 0 || len(s.sends) != 120 {
+		t.Errorf("Requests = (%d batches, %d sends); want = (0, 120)", len(s.batches), len(s.sends))
+	}
+
+	if _, err := client.SendAllInBatches(context.Background(), messages, &BulkOptions{
+		BatchSize:   501,
+		UseSendEach: true,
+	}); err == nil {
+		t.Errorf("SendAllInBatches(BatchSize: 501) = nil; want error")
+	}
+}
+
+func TestSendAllInBatchesUseSendEachConcurrency(t *testing.T) {
+	s := &bulkServer{delay: 20 * time.Millisecond}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	messages := topicMessages(400)
+	br, err := client.SendAllInBatches(context.Background(), messages, &BulkOptions{
+		BatchSize:      100,
+		MaxConcurrency: 4,
+		UseSendEach:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if br.SuccessCount != len(messages) {
+		t.Errorf("SuccessCount = %d; want = %d", br.SuccessCount, len(messages))
+	}
+	if s.maxSeen > maxConcurrentSends {
+		t.Errorf("Concurrent requests = %d; want <= %d", s.maxSeen, maxConcurrentSends)
+	}
+}
+
+func TestSendMulticastAll(t *testing.T) {
+	s := &bulkServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	var tokens []string
+	for i := 0; i < 205; i++ {
+		tokens = append(tokens, fmt.Sprintf("token%d", i))
+	}
+	tokens[150] = "invalid-token"
+	br, err := client.SendMulticastAll(context.Background(), &MulticastMessage{
+		Tokens: tokens,
+		Data:   map[string]string{"k": "v"},
+	}, &BulkOptions{MaxConcurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBulkResponse(t, br, tokens)
+	if sizes := s.batchSizes(); len(sizes) != 3 {
+		t.Errorf("Batches = %v; want = 3 batches", sizes)
+	}
+	for _, b := range s.batches {
+		for _, req := range b {
+			if req.Message.Data["k"] != "v" {
+				t.Errorf("Data = %v; want = {k: v}", req.Message.Data)
+			}
+		}
+	}
+}
+
+func TestSendMulticastAllInvalidArgs(t *testing.T) {
+	client, err := NewClient(context.Background(), testMessagingConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.SendMulticastAll(context.Background(), nil, nil); err == nil {
+		t.Errorf("SendMulticastAll(nil) = nil; want error")
+	}
+	if _, err := client.SendMulticastAll(
+		context.Background(), &MulticastMessage{}, nil); err == nil {
+		t.Errorf("SendMulticastAll(no tokens) = nil; want error")
+	}
+}
+
+func TestSendAllFromChannel(t *testing.T) {
+	s := &bulkServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	messages := topicMessages(25)
+	ch := make(chan *Message)
+	go func() {
+		for _, m := range messages {
+			ch <- m
+		}
+		close(ch)
+	}()
+
+	br, err := client.SendAllFromChannel(context.Background(), ch, &BulkOptions{BatchSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets []string
+	for _, m := range messages {
+		targets = append(targets, m.Topic)
+	}
+	checkBulkResponse(t, br, targets)
+	if sizes := s.batchSizes(); fmt.Sprint(sizes) != "[10 10 5]" {
+		t.Errorf("Batches = %v; want = [10 10 5]", sizes)
+	}
+}
+
+func TestSendAllFromChannelCancelled(t *testing.T) {
+	s := &bulkServer{}
+	client, ts := s.start(t)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan *Message)
+	go func() {
+		for _, m := range topicMessages(3) {
+			ch <- m
+		}
+		cancel()
+	}()
+
+	br, err := client.SendAllFromChannel(ctx, ch, nil)
+	if err != context.Canceled {
+		t.Errorf("SendAllFromChannel() = %v; want = %v", err, context.Canceled)
+	}
+	if br == nil || len(br.Responses) != 3 {
+		t.Fatalf("SendAllFromChannel() = %v; want 3 responses", br)
+	}
+
+	if _, err := client.SendAllFromChannel(context.Background(), nil, nil); err == nil {
+		t.Errorf("SendAllFromChannel(nil) = nil; want error")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	var l *rateLimiter
+	if err := l.wait(context.Background(), 100); err != nil {
+		t.Errorf("wait(nil limiter) = %v; want nil", err)
+	}
+
+	l = newRateLimiter(1000)
+	begin := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.wait(context.Background(), 20); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(begin); elapsed < 40*time.Millisecond {
+		t.Errorf("wait() took %v; want >= 40ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l.wait(ctx, 1000)
+	if err := l.wait(ctx, 1); err != context.Canceled {
+		t.Errorf("wait(cancelled) = %v; want = %v", err, context.Canceled)
+	}
+}
@@ -1296,3 +1296,135 @@ var httpErrors = []struct {
 		check: IsUnknown,
 	},
 }
+
+// invalidTokens records the calls made to an InvalidTokenHandler.
+type invalidTokens struct {
+	tokens []string
+	errs   []error
+}
+
+func (it *invalidTokens) handle(token string, err error) {
+	it.tokens = append(it.tokens, token)
+	it.errs = append(it.errs, err)
+}
+
+func TestInvalidTokenHandlerSend(t *testing.T) {
+	var resp string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(resp))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	client, err := NewClient(ctx, testMessagingConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.fcmEndpoint = ts.URL
+	invalid := &invalidTokens{}
+	handlerClient := client.WithInvalidTokenHandler(invalid.handle)
+
+	cases := []struct {
+		resp    string
+		message *Message
+		want    bool
+	}{
+		{
+			resp:    `{"error": {"status": "NOT_FOUND", "message": "test error"}}`,
+			message: &Message{Token: "token1"},
+			want:    true,
+		},
+		{
+			resp: `{"error": {"status": "INVALID_ARGUMENT", ` +
+				`"message": "The registration token is not a valid FCM registration token", "details": [` +
+				`{"@type": "type.googleapis.com/google.rpc.BadRequest", ` +
+				`"fieldViolations": [{"field": "message.token", "description": "Invalid registration token"}]}]}}`,
+			message: &Message{Token: "token2"},
+			want:    true,
+		},
+		{
+			resp: `{"error": {"status": "INVALID_ARGUMENT", ` +
+				`"message": "The registration token is not a valid FCM registration token"}}`,
+			message: &Message{Token: "token2a"},
+		},
+		{
+			resp:    `{"error": {"status": "INVALID_ARGUMENT", "message": "Invalid value at 'message.data'"}}`,
+			message: &Message{Token: "token3"},
+		},
+		{
+			resp: `{"error": {"status": "NOT_FOUND", "message": "test error", "details": [` +
+				`{"@type": "type.googleapis.com/google.firebase.fcm.v1.FcmError", "errorCode": "UNREGISTERED"}]}}`,
+			message: &Message{Token: "token4"},
+			want:    true,
+		},
+		{
+			resp: `{"error": {"status": "NOT_FOUND", "message": "test error", "details": [` +
+				`{"@type": "type.googleapis.com/google.firebase.fcm.v1.FcmError", "errorCode": "UNREGISTERED"}]}}`,
+			message: &Message{Topic: "topic"},
+		},
+	}
+	var want []string
+	for _, tc := range cases {
+		resp = tc.resp
+		if _, err := handlerClient.Send(ctx, tc.message); err == nil {
+			t.Errorf("Send(%v) = nil; want error", tc.message)
+		}
+		if tc.want {
+			want = append(want, tc.message.Token)
+		}
+	}
+	if _, err := handlerClient.SendDryRun(ctx, &Message{Token: "token5"}); err == nil {
+		t.Errorf("SendDryRun() = nil; want error")
+	}
+
+	if !reflect.DeepEqual(invalid.tokens, want) {
+		t.Errorf("InvalidTokenHandler tokens = %v; want = %v", invalid.tokens, want)
+	}
+	if !IsRegistrationTokenNotRegistered(invalid.errs[0]) || !IsInvalidArgument(invalid.errs[1]) {
+		t.Errorf("InvalidTokenHandler errors = %v", invalid.errs)
+	}
+
+	// The original client does not call the handler.
+	if _, err := client.Send(ctx, &Message{Token: "token6"}); err == nil {
+		t.Errorf("Send() = nil; want error")
+	}
+	if len(invalid.tokens) != len(want) {
+		t.Errorf("InvalidTokenHandler tokens = %v; want = %v", invalid.tokens, want)
+	}
+}
+
+func TestInvalidTokenHandlerTopicManagement(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"results": [{}, {"error": "NOT_FOUND"}, {"error": "INTERNAL"}, ` +
+			`{"error": "INVALID_ARGUMENT"}]}`))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	client, err := NewClient(ctx, testMessagingConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.iidEndpoint = ts.URL
+	invalid := &invalidTokens{}
+	client = client.WithInvalidTokenHandler(invalid.handle)
+
+	tokens := []string{"id1", "id2", "id3", "id4"}
+	if _, err := client.SubscribeToTopic(ctx, tokens, "test-topic"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UnsubscribeFromTopic(ctx, tokens, "test-topic"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"id2", "id4", "id2", "id4"}
+	if !reflect.DeepEqual(invalid.tokens, want) {
+		t.Errorf("InvalidTokenHandler tokens = %v; want = %v", invalid.tokens, want)
+	}
+	if !IsRegistrationTokenNotRegistered(invalid.errs[0]) || !IsInvalidArgument(invalid.errs[1]) {
+		t.Errorf("InvalidTokenHandler errors = %v", invalid.errs)
+	}
+}